@@ -27,8 +27,34 @@ const (
 	ReadSeqSize = 1000
 )
 
+// the orientation of pair reads
+const (
+	OrientFR = iota // read1 and read2 face each other
+	OrientRF        // read1 and read2 face outward, long-jump mate pairs
+	OrientFF        // read1 and read2 in the same strand
+	OrientNum
+	OrientAuto = -1 // detected by the pairs mapped to the same long edge
+)
+
+// OrientName is the name of pair reads orientation
+var OrientName = [OrientNum]string{"FR", "RF", "FF"}
+
+// GetOrient return the orientation of the name, "auto" for OrientAuto
+func GetOrient(name string) (orient int, err error) {
+	if strings.EqualFold(name, "auto") {
+		return OrientAuto, nil
+	}
+	for i, n := range OrientName {
+		if strings.EqualFold(name, n) {
+			return i, nil
+		}
+	}
+	return OrientAuto, fmt.Errorf("unknown orientation: %s, must be FR, RF, FF or auto", name)
+}
+
 type LibInfo struct {
 	Name          string // name of library
+	Sample        string // sample of library, default same as Name, used for coloured DBG
 	NumberReads   int64  // the number of reads
 	Diverse       uint8
 	Paired        uint8
@@ -37,12 +63,32 @@ type LibInfo struct {
 	QualBenchmark uint8 // the benchmark of quality score, strength encourage use phred+33
 	TotalBasesNum int64
 	ReadLen       int
-	InsertSize    int // paired read insert size
-	InsertSD      int // Standard Deviation
+	InsertSize    int      // paired read insert size
+	InsertSD      int      // Standard Deviation
+	MinQual       int      // the mismatch of base quality lower than MinQual corrected freely
+	MaxErrRate    int      // the max percent of high quality mismatches in the read mapping
+	MinMapRate    int      // the min percent of read bases mapped
+	TrimQual      int      // the quality threshold of trimming 3' end
+	Adapters      []string // the adapter sequences trimmed from reads
+	Orient        int      // the orientation of pair reads, OrientAuto detected by mapping
 	//	fnNum         int      // the number of files
 	FnName []string // the files name slice
 }
 
+// the default correct thresholds of library
+const (
+	DefaultMinQual    = 20
+	DefaultMaxErrRate = 5
+	DefaultMinMapRate = 90
+	DefaultTrimQual   = 20
+)
+
+// NewLibInfo return the library with the default correct and trim thresholds, orientation FR,
+// the detection of orientation enabled by "orient = auto"
+func NewLibInfo() LibInfo {
+	return LibInfo{MinQual: DefaultMinQual, MaxErrRate: DefaultMaxErrRate, MinMapRate: DefaultMinMapRate, TrimQual: DefaultTrimQual, Orient: OrientFR}
+}
+
 type CfgInfo struct {
 	MaxRdLen int // maximum read length
 	MinRdLen int // minimum read length
@@ -121,7 +167,7 @@ func ParseCfg(fn string, correct bool) (cfgInfo CfgInfo, e error) {
 	if inFile, err = os.Open(fn); err != nil {
 		log.Fatal(err)
 	}
-	var libInfo LibInfo
+	libInfo := NewLibInfo()
 	defer inFile.Close()
 	reader := bufio.NewReader(inFile)
 	eof := false
@@ -144,8 +190,7 @@ func ParseCfg(fn string, correct bool) (cfgInfo CfgInfo, e error) {
 		case "[LIB]":
 			if libInfo.Name != "" {
 				cfgInfo.Libs = append(cfgInfo.Libs, libInfo)
-				var nli LibInfo
-				libInfo = nli
+				libInfo = NewLibInfo()
 			}
 		case "max_rd_len":
 			v, err = strconv.Atoi(fields[2])
@@ -155,12 +200,36 @@ func ParseCfg(fn string, correct bool) (cfgInfo CfgInfo, e error) {
 			cfgInfo.MinRdLen = v
 		case "name":
 			libInfo.Name = fields[2]
+		case "sample":
+			libInfo.Sample = fields[2]
 		case "avg_insert_len":
 			v, err = strconv.Atoi(fields[2])
 			libInfo.InsertSize = v
 		case "insert_SD":
 			v, err = strconv.Atoi(fields[2])
 			libInfo.InsertSD = v
+		case "min_qual":
+			v, err = strconv.Atoi(fields[2])
+			libInfo.MinQual = v
+		case "max_err_rate":
+			v, err = strconv.Atoi(fields[2])
+			libInfo.MaxErrRate = v
+		case "min_map_rate":
+			v, err = strconv.Atoi(fields[2])
+			libInfo.MinMapRate = v
+		case "trim_qual":
+			v, err = strconv.Atoi(fields[2])
+			libInfo.TrimQual = v
+		case "adapter":
+			libInfo.Adapters = append(libInfo.Adapters, strings.ToUpper(fields[2]))
+		case "orient":
+			libInfo.Orient, err = GetOrient(fields[2])
+		case "reverse_seq":
+			v, err = strconv.Atoi(fields[2])
+			libInfo.Orient = OrientFR
+			if v == 1 {
+				libInfo.Orient = OrientRF
+			}
 		case "diverse_rd_len":
 			v, err = strconv.Atoi(fields[2])
 			libInfo.Diverse = uint8(v)
@@ -199,6 +268,11 @@ func ParseCfg(fn string, correct bool) (cfgInfo CfgInfo, e error) {
 	if libInfo.Name != "" {
 		cfgInfo.Libs = append(cfgInfo.Libs, libInfo)
 	}
+	for i, lib := range cfgInfo.Libs {
+		if lib.Sample == "" {
+			cfgInfo.Libs[i].Sample = lib.Name
+		}
+	}
 
 	return
 }
@@ -735,6 +809,75 @@ func GetReadSeqBucket(fn string, cs chan<- ReadSeqBucket, kmerlen int) {
 	close(cs)
 }
 
+// ConstructCFFromFiles add the kmers of reads files to the cf, and write the kmers that
+// count reach MIN_KMER_COUNT to the wrfn
+func ConstructCFFromFiles(cf cuckoofilter.CuckooFilter, fnArr []string, wrfn string, numCPU, kmerlen int) {
+	bufsize := 60000
+	wc := make(chan KmerBntBucket, bufsize)
+	defer close(wc)
+	totalFileNum := len(fnArr)
+	//concurrentNum := 6
+	//totalNumT := opt.NumCPU/(concurrentNum+1) + 1
+	concurrentNum := 6
+	totalNumT := numCPU/(concurrentNum+1) + 1
+	if totalNumT > totalFileNum {
+		totalNumT = totalFileNum
+	}
+
+	processT := make(chan int, totalNumT)
+	defer close(processT)
+	for i := 0; i < totalNumT; i++ {
+		processT <- 1
+	}
+
+	// write goroutinue
+	go WriteKmer(wrfn, wc, kmerlen, totalFileNum*concurrentNum)
+
+	for _, fn := range fnArr {
+		<-processT
+		//fmt.Printf("[CCF] processing file: %v\n", lib.FnName[i])
+		go ConcurrentConstructCF(fn, cf, wc, concurrentNum, kmerlen, processT)
+	}
+
+	for i := 0; i < totalNumT; i++ {
+		<-processT
+	}
+	time.Sleep(time.Second * 3)
+}
+
+// AppendUniqKmerFile append the kmers of addfn to the end of uniqfn, both files compressed by brotli
+func AppendUniqKmerFile(uniqfn, addfn string) {
+	tmpfn := uniqfn + ".tmp"
+	outfp, err := os.Create(tmpfn)
+	if err != nil {
+		log.Fatalf("[AppendUniqKmerFile] create file: %s err: %v\n", tmpfn, err)
+	}
+	brfp := cbrotli.NewWriter(outfp, cbrotli.WriterOptions{Quality: 1})
+	buffp := bufio.NewWriterSize(brfp, 1<<25)
+	for _, fn := range []string{uniqfn, addfn} {
+		fp, err := os.Open(fn)
+		if err != nil {
+			log.Fatalf("[AppendUniqKmerFile] open file: %s err: %v\n", fn, err)
+		}
+		infp := cbrotli.NewReaderSize(fp, 1<<25)
+		if _, err := io.Copy(buffp, infp); err != nil {
+			log.Fatalf("[AppendUniqKmerFile] copy file: %s err: %v\n", fn, err)
+		}
+		infp.Close()
+		fp.Close()
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[AppendUniqKmerFile] write file: %s err: %v\n", tmpfn, err)
+	}
+	if err := brfp.Close(); err != nil {
+		log.Fatalf("[AppendUniqKmerFile] write file: %s err: %v\n", tmpfn, err)
+	}
+	outfp.Close()
+	if err := os.Rename(tmpfn, uniqfn); err != nil {
+		log.Fatalf("[AppendUniqKmerFile] rename file: %s to %s err: %v\n", tmpfn, uniqfn, err)
+	}
+}
+
 func CCF(c cli.Command) {
 	fmt.Println(c.Flags(), c.Parent().Flags())
 	//argsCheck(c)
@@ -763,17 +906,6 @@ func CCF(c cli.Command) {
 	}
 	fmt.Println(cfgInfo)
 
-	// make CuckooFilter
-
-	t0 := time.Now()
-	cf := cuckoofilter.MakeCuckooFilter(uint64(opt.CFSize), opt.Kmer)
-	numCPU := opt.NumCPU
-	runtime.GOMAXPROCS(numCPU + 2)
-	bufsize := 60000
-	wc := make(chan KmerBntBucket, bufsize)
-	defer close(wc)
-	//we := make(chan int)
-	//defer close(we)
 	var fnArr []string
 	for _, lib := range cfgInfo.Libs {
 		if lib.AsmFlag != AllState && lib.SeqProfile != 1 {
@@ -781,37 +913,20 @@ func CCF(c cli.Command) {
 		}
 		fnArr = append(fnArr, lib.FnName...)
 	}
-
 	//fmt.Printf("[CCF] fileName array: %v\n", fnArr)
-	totalFileNum := len(fnArr)
-	//concurrentNum := 6
-	//totalNumT := opt.NumCPU/(concurrentNum+1) + 1
-	concurrentNum := 6
-	totalNumT := opt.NumCPU/(concurrentNum+1) + 1
-	if totalNumT > totalFileNum {
-		totalNumT = totalFileNum
-	}
+	ConstructCFToFiles(opt, fnArr)
+}
 
-	processT := make(chan int, totalNumT)
-	defer close(processT)
-	for i := 0; i < totalNumT; i++ {
-		processT <- 1
-	}
+// ConstructCFToFiles construct the cuckoofilter by the reads files, write the cuckoofilter
+// and the uniq kmers to the files with opt.Prefix
+func ConstructCFToFiles(opt Options, fnArr []string) cuckoofilter.CuckooFilter {
+	// make CuckooFilter
 
-	// write goroutinue
+	t0 := time.Now()
+	cf := cuckoofilter.MakeCuckooFilter(uint64(opt.CFSize), opt.Kmer)
+	runtime.GOMAXPROCS(opt.NumCPU + 2)
 	wrfn := opt.Prefix + ".uniqkmerseq.br"
-	go WriteKmer(wrfn, wc, opt.Kmer, totalFileNum*concurrentNum)
-
-	for _, fn := range fnArr {
-		<-processT
-		//fmt.Printf("[CCF] processing file: %v\n", lib.FnName[i])
-		go ConcurrentConstructCF(fn, cf, wc, concurrentNum, opt.Kmer, processT)
-	}
-
-	for i := 0; i < totalNumT; i++ {
-		<-processT
-	}
-	time.Sleep(time.Second * 3)
+	ConstructCFFromFiles(cf, fnArr, wrfn, opt.NumCPU, opt.Kmer)
 
 	// end signal from write goroutinue
 	// prefix := c.Parent().Flag("p").String()
@@ -820,7 +935,7 @@ func CCF(c cli.Command) {
 	// 	log.Fatal(err)
 	// }
 	cfinfofn := opt.Prefix + ".cf.Info"
-	err = cf.WriteCuckooFilterInfo(cfinfofn)
+	err := cf.WriteCuckooFilterInfo(cfinfofn)
 	if err != nil {
 		log.Fatalf("[CCF]WriteCuckooFilterInfo file: %v error: %v\n", cfinfofn, err)
 	}
@@ -833,8 +948,5 @@ func CCF(c cli.Command) {
 	cf.GetStat()
 	t1 := time.Now()
 	fmt.Printf("[CCF] construct CuckooFilter took %v to run\n", t1.Sub(t0))
-
-	if err != nil {
-		log.Fatal("error found in the CCF")
-	}
+	return cf
 }
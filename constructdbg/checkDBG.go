@@ -0,0 +1,251 @@
+package constructdbg
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/jwaldrip/odin/cli"
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/utils"
+)
+
+// the codes of DBG invariant violations
+const (
+	VioIDMismatch      = "idMismatch"      // nodesArr[i].ID or edgesArr[i].ID != i
+	VioNodeSeqLen      = "nodeSeqLen"      // node Seq length not match K
+	VioEdgeTooShort    = "edgeTooShort"    // edge sequence shorter than K
+	VioQualLen         = "qualLen"         // edge quality length not equal to sequence length
+	VioDeadNodeRef     = "deadNodeRef"     // edge end reference not exist or deleted node
+	VioEndKmerMismatch = "endKmerMismatch" // edge end K-1 bases not match node kmer of both strands
+	VioSlotMismatch    = "slotMismatch"    // edge not in the node slot decided by the strand and next base
+	VioPlaceholder     = "placeholder"     // node slot still the placeholder of edge that not walked
+	VioDeadEdgeRef     = "deadEdgeRef"     // node slot reference not exist or deleted edge
+	VioNoBackRef       = "noBackRef"       // edge referenced by node slot but not link to the node
+	VioMultiSlot       = "multiSlot"       // edge referenced by more slots of the node than its ends
+	VioIsolatedNode    = "isolatedNode"    // live node not link to any edge
+)
+
+// DBGViolation is a violation of the DBG invariants
+type DBGViolation struct {
+	Kind string // "node" or "edge"
+	ID   DBG_MAX_INT
+	Code string
+	Msg  string
+}
+
+func getNodeKmer(nd DBGNode, kmerlen int) []byte {
+	return constructcf.ExtendKmerBnt2Byte(constructcf.KmerBnt{Seq: nd.Seq, Len: kmerlen - 1})
+}
+
+// check the end of edge link to node nID, start denote the start end of edge, return the
+// expected slot(coming and base) that edge should be in the node
+func checkEdgeEnd(nodesArr []DBGNode, e DBGEdge, nID DBG_MAX_INT, start bool, kmerlen int, vArr []DBGViolation) ([]DBGViolation, []int) {
+	end := "end"
+	if start {
+		end = "start"
+	}
+	if int(nID) >= len(nodesArr) || nodesArr[nID].ID != nID || nodesArr[nID].GetDeleteFlag() > 0 {
+		return append(vArr, DBGViolation{"edge", e.ID, VioDeadNodeRef, fmt.Sprintf("%s node: %d", end, nID)}), nil
+	}
+	nd := nodesArr[nID]
+	if len(nd.Seq) != GetNodeSeqLen(kmerlen) || len(e.Utg.Ks) < kmerlen {
+		return vArr, nil
+	}
+	nk := getNodeKmer(nd, kmerlen)
+	rk := GetReverseCompByteArr(nk)
+	// slot encode: incoming base b => b, outcoming base b => b + bnt.BaseTypeNum
+	var slots []int
+	if start {
+		ek := e.Utg.Ks[:kmerlen-1]
+		b := int(e.Utg.Ks[kmerlen-1])
+		if reflect.DeepEqual(ek, nk) {
+			slots = append(slots, bnt.BaseTypeNum+b)
+		}
+		if reflect.DeepEqual(ek, rk) {
+			slots = append(slots, int(bnt.BntRev[b]))
+		}
+	} else {
+		el := len(e.Utg.Ks)
+		ek := e.Utg.Ks[el-(kmerlen-1):]
+		b := int(e.Utg.Ks[el-kmerlen])
+		if reflect.DeepEqual(ek, nk) {
+			slots = append(slots, b)
+		}
+		if reflect.DeepEqual(ek, rk) {
+			slots = append(slots, bnt.BaseTypeNum+int(bnt.BntRev[b]))
+		}
+	}
+	if len(slots) == 0 {
+		return append(vArr, DBGViolation{"edge", e.ID, VioEndKmerMismatch, fmt.Sprintf("%s node: %d", end, nID)}), nil
+	}
+	for _, s := range slots {
+		if getNodeSlot(nd, s) == e.ID {
+			return vArr, slots
+		}
+	}
+	return append(vArr, DBGViolation{"edge", e.ID, VioSlotMismatch, fmt.Sprintf("%s node: %d, expect slot: %s", end, nID, slotName(slots[0]))}), slots
+}
+
+func getNodeSlot(nd DBGNode, s int) DBG_MAX_INT {
+	if s < bnt.BaseTypeNum {
+		return nd.EdgeIDIncoming[s]
+	}
+	return nd.EdgeIDOutcoming[s-bnt.BaseTypeNum]
+}
+
+func slotName(s int) string {
+	if s < bnt.BaseTypeNum {
+		return fmt.Sprintf("in[%c]", bnt.BitNtCharUp[s])
+	}
+	return fmt.Sprintf("out[%c]", bnt.BitNtCharUp[s-bnt.BaseTypeNum])
+}
+
+// CheckDBGInvariants check the consistency of nodes and edges, return all violations found,
+// the DBG will not be changed
+func CheckDBGInvariants(nodesArr []DBGNode, edgesArr []DBGEdge, kmerlen int) (vArr []DBGViolation) {
+	seqLen := GetNodeSeqLen(kmerlen)
+	for i, nd := range nodesArr {
+		if nd.ID == 0 || nd.GetDeleteFlag() > 0 {
+			continue
+		}
+		if int(nd.ID) != i {
+			vArr = append(vArr, DBGViolation{"node", DBG_MAX_INT(i), VioIDMismatch, fmt.Sprintf("ID: %d", nd.ID)})
+			continue
+		}
+		if i < 2 {
+			continue
+		}
+		if len(nd.Seq) != seqLen {
+			vArr = append(vArr, DBGViolation{"node", nd.ID, VioNodeSeqLen, fmt.Sprintf("len(Seq): %d, expect: %d", len(nd.Seq), seqLen)})
+		}
+		var linkNum int
+		for s := 0; s < 2*bnt.BaseTypeNum; s++ {
+			eID := getNodeSlot(nd, s)
+			if eID == 1 {
+				vArr = append(vArr, DBGViolation{"node", nd.ID, VioPlaceholder, slotName(s)})
+				continue
+			} else if eID < 2 {
+				continue
+			}
+			linkNum++
+			if int(eID) >= len(edgesArr) || edgesArr[eID].ID != eID || edgesArr[eID].GetDeleteFlag() > 0 {
+				vArr = append(vArr, DBGViolation{"node", nd.ID, VioDeadEdgeRef, fmt.Sprintf("%s edge: %d", slotName(s), eID)})
+				continue
+			}
+			e := edgesArr[eID]
+			if e.StartNID != nd.ID && e.EndNID != nd.ID {
+				vArr = append(vArr, DBGViolation{"node", nd.ID, VioNoBackRef, fmt.Sprintf("%s edge: %d, StartNID: %d, EndNID: %d", slotName(s), eID, e.StartNID, e.EndNID)})
+				continue
+			}
+			// an edge link to the node once for every end
+			var refNum, endNum int
+			for t := 0; t < 2*bnt.BaseTypeNum; t++ {
+				if getNodeSlot(nd, t) == eID {
+					refNum++
+				}
+			}
+			if e.StartNID == nd.ID {
+				endNum++
+			}
+			if e.EndNID == nd.ID {
+				endNum++
+			}
+			if refNum > endNum && s == firstSlot(nd, eID) {
+				vArr = append(vArr, DBGViolation{"node", nd.ID, VioMultiSlot, fmt.Sprintf("edge: %d in %d slots, link ends: %d", eID, refNum, endNum)})
+			}
+		}
+		if linkNum == 0 {
+			vArr = append(vArr, DBGViolation{"node", nd.ID, VioIsolatedNode, ""})
+		}
+	}
+
+	for i, e := range edgesArr {
+		if e.ID == 0 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		if int(e.ID) != i {
+			vArr = append(vArr, DBGViolation{"edge", DBG_MAX_INT(i), VioIDMismatch, fmt.Sprintf("ID: %d", e.ID)})
+			continue
+		}
+		if i < 2 {
+			continue
+		}
+		if len(e.Utg.Ks) < kmerlen {
+			vArr = append(vArr, DBGViolation{"edge", e.ID, VioEdgeTooShort, fmt.Sprintf("len: %d", len(e.Utg.Ks))})
+		}
+		if len(e.Utg.Kq) > 0 && len(e.Utg.Kq) != len(e.Utg.Ks) {
+			vArr = append(vArr, DBGViolation{"edge", e.ID, VioQualLen, fmt.Sprintf("len(Kq): %d, len(Ks): %d", len(e.Utg.Kq), len(e.Utg.Ks))})
+		}
+		var startSlots []int
+		if e.StartNID > 0 {
+			vArr, startSlots = checkEdgeEnd(nodesArr, e, e.StartNID, true, kmerlen, vArr)
+		}
+		if e.EndNID > 0 {
+			var endSlots []int
+			vArr, endSlots = checkEdgeEnd(nodesArr, e, e.EndNID, false, kmerlen, vArr)
+			// self cycle edge both ends link to the same node must use different slots
+			if e.StartNID == e.EndNID && len(startSlots) == 1 && len(endSlots) == 1 && startSlots[0] == endSlots[0] {
+				vArr = append(vArr, DBGViolation{"edge", e.ID, VioSlotMismatch, fmt.Sprintf("self cycle both ends in slot: %s", slotName(startSlots[0]))})
+			}
+		}
+	}
+	return
+}
+
+func firstSlot(nd DBGNode, eID DBG_MAX_INT) int {
+	for s := 0; s < 2*bnt.BaseTypeNum; s++ {
+		if getNodeSlot(nd, s) == eID {
+			return s
+		}
+	}
+	return -1
+}
+
+// DBGViolationsWriter write violations to the tab separated file, columns: kind, ID, code and message
+func DBGViolationsWriter(vArr []DBGViolation, checkfn string) {
+	fp, err := os.Create(checkfn)
+	if err != nil {
+		log.Fatalf("[DBGViolationsWriter] create file: %s failed, err: %v\n", checkfn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriter(fp)
+	fmt.Fprintf(buffp, "#kind\tID\tcode\tmessage\n")
+	for _, v := range vArr {
+		fmt.Fprintf(buffp, "%s\t%d\t%s\t%s\n", v.Kind, v.ID, v.Code, v.Msg)
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[DBGViolationsWriter] write file: %s failed, err: %v\n", checkfn, err)
+	}
+}
+
+// CheckDBG check the invariants of the stage DBG and write violations to the file: prefix.<stage>.check
+func CheckDBG(c cli.Command) {
+	opt, suc := utils.CheckGlobalArgs(c.Parent())
+	if suc == false {
+		log.Fatalf("[CheckDBG] check global Arguments error, opt: %v\n", opt)
+	}
+	stage := c.Flag("stage").String()
+	nodesArr, edgesArr := LoadStageDBG(opt.Prefix, stage, opt.Kmer, opt.NumCPU)
+	vArr := CheckDBGInvariants(nodesArr, edgesArr, opt.Kmer)
+	checkfn := opt.Prefix + "." + stage + ".check"
+	DBGViolationsWriter(vArr, checkfn)
+
+	codeCount := make(map[string]int)
+	for _, v := range vArr {
+		codeCount[v.Code]++
+	}
+	var codes []string
+	for code := range codeCount {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Printf("[CheckDBG] %s: %d\n", code, codeCount[code])
+	}
+	fmt.Printf("[CheckDBG] stage: %s, violations number: %d, written to file: %s\n", stage, len(vArr), checkfn)
+}
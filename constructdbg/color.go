@@ -0,0 +1,348 @@
+package constructdbg
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/io/seqio/fasta"
+	"github.com/biogo/biogo/seq/linear"
+	"github.com/jwaldrip/odin/cli"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/utils"
+)
+
+// MaxColorNum is the max number of samples of coloured DBG, every sample occupy one bit of ColorSet
+const MaxColorNum = 64
+
+// ColorSet bit i set denote the edge found in the sample i
+type ColorSet uint64
+
+// DBGColors store the colour set of every edge, Colors index by edge ID
+type DBGColors struct {
+	Samples []string
+	Colors  []ColorSet
+	Hits    [][]uint32 // Hits[sample][edge ID], number of sampled kmers of edge hit by the reads of sample
+}
+
+func (cs ColorSet) Has(c int) bool {
+	return cs&(1<<uint(c)) > 0
+}
+
+func (cs ColorSet) Count() (n int) {
+	for ; cs > 0; cs &= cs - 1 {
+		n++
+	}
+	return
+}
+
+// GetColorLabel return the samples name of the edge separated by ',', "-" if no sample found
+func (dc *DBGColors) GetColorLabel(eID DBG_MAX_INT) string {
+	var names []string
+	for i, s := range dc.Samples {
+		if dc.Colors[eID].Has(i) {
+			names = append(names, s)
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
+
+// GetCfgSamples return the samples name of cfg libraries and reads files of every sample,
+// libraries with the same sample name share one colour
+func GetCfgSamples(cfgInfo constructcf.CfgInfo) (samples []string, fnArr [][]string) {
+	for _, lib := range cfgInfo.Libs {
+		if lib.AsmFlag != constructcf.AllState && lib.SeqProfile != 1 {
+			continue
+		}
+		c := -1
+		for i, s := range samples {
+			if s == lib.Sample {
+				c = i
+				break
+			}
+		}
+		if c < 0 {
+			samples = append(samples, lib.Sample)
+			fnArr = append(fnArr, nil)
+			c = len(samples) - 1
+		}
+		fnArr[c] = append(fnArr[c], lib.FnName...)
+	}
+	if len(samples) > MaxColorNum {
+		log.Fatalf("[GetCfgSamples] samples number: %d bigger than MaxColorNum: %d\n", len(samples), MaxColorNum)
+	}
+	return
+}
+
+// lookupEdgeKmer return the edge ID that contain the canonical kmer kb, zero if not found
+func lookupEdgeKmer(cf CuckooFilter, kb []byte, edgesArr []DBGEdge) DBG_MAX_INT {
+	for _, d := range cf.Contain(hk2uint64(sha1.Sum(kb))) {
+		eb := edgesArr[d.ID].Utg.Ks[d.Pos : int(d.Pos)+cf.Kmerlen]
+		if d.Strand == MINUS {
+			eb = GetReverseCompByteArr(eb)
+		}
+		if reflect.DeepEqual(kb, eb) {
+			return d.ID
+		}
+	}
+	return 0
+}
+
+// paraColorReads count the sampled kmers of edges hit by the reads
+func paraColorReads(cs <-chan constructcf.ReadInfo, cf CuckooFilter, edgesArr []DBGEdge, hits []uint32, done chan<- int) {
+	var num int
+	rseq := make([]byte, 0, 1000)
+	for ri := range cs {
+		sl := len(ri.Seq)
+		if sl < cf.Kmerlen {
+			continue
+		}
+		rseq = append(rseq[:0], ri.Seq...)
+		ReverseCompByteArr(rseq)
+		for i := 0; i < sl-cf.Kmerlen+1; i++ {
+			kb := ri.Seq[i : i+cf.Kmerlen]
+			rb := rseq[sl-cf.Kmerlen-i : sl-i]
+			if BiggerThan(kb, rb) {
+				kb = rb
+			}
+			if eID := lookupEdgeKmer(cf, kb, edgesArr); eID > 0 {
+				atomic.AddUint32(&hits[eID], 1)
+			}
+		}
+		num++
+	}
+	done <- num
+}
+
+// ColorDBGEdges map the reads of every sample to the edges, the edge coloured by the sample
+// if the number of sampled kmers hit by the reads of sample not smaller than minHits
+func ColorDBGEdges(edgesArr []DBGEdge, samples []string, fnArr [][]string, kmerlen, winSize, minHits, numCPU int) (dc DBGColors) {
+	// sample the whole edges
+	cfSize := GetCuckoofilterDBGSampleSize(edgesArr, int64(winSize), int64(math.MaxInt32), int64(kmerlen))
+	cf := MakeCuckooFilter(uint64(cfSize*7), kmerlen)
+	count := ConstructCFDBGMinimizers(cf, edgesArr, winSize, math.MaxInt32)
+	fmt.Printf("[ColorDBGEdges] construct Sample of DBG edges cuckoofilter number is : %v\n", count)
+
+	dc.Samples = samples
+	dc.Colors = make([]ColorSet, len(edgesArr))
+	dc.Hits = make([][]uint32, len(samples))
+	for c, s := range samples {
+		dc.Hits[c] = make([]uint32, len(edgesArr))
+		cs := make(chan constructcf.ReadInfo, 60000)
+		done := make(chan int, numCPU)
+		for i := 0; i < numCPU; i++ {
+			go paraColorReads(cs, cf, edgesArr, dc.Hits[c], done)
+		}
+		we := make(chan int, 1)
+		var readsNum int
+		for _, fn := range fnArr[c] {
+			paraLoadNGSReads(fn, cs, kmerlen, we)
+			readsNum += <-we
+		}
+		close(cs)
+		for i := 0; i < numCPU; i++ {
+			<-done
+		}
+		var colorNum int
+		for i, h := range dc.Hits[c] {
+			if h >= uint32(minHits) && edgesArr[i].ID > 0 && edgesArr[i].GetDeleteFlag() == 0 {
+				dc.Colors[i] |= 1 << uint(c)
+				colorNum++
+			}
+		}
+		fmt.Printf("[ColorDBGEdges] sample: %s, reads number: %d, coloured edges number: %d\n", s, readsNum, colorNum)
+	}
+	return
+}
+
+// DBGColorsWriter write the colour of edges to the tab separated file, the first line
+// store the edges hash of DBG, columns: edge ID, colour set(hex bits) and the hits number of every sample
+func DBGColorsWriter(dc DBGColors, edgesArr []DBGEdge, colorsfn string) {
+	fp, err := os.Create(colorsfn)
+	if err != nil {
+		log.Fatalf("[DBGColorsWriter] create file: %s failed, err: %v\n", colorsfn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriter(fp)
+	fmt.Fprintf(buffp, "#EdgesHash\t%x\n", GetEdgesHash(edgesArr))
+	fmt.Fprintf(buffp, "#ID\tcolors\t%s\n", strings.Join(dc.Samples, "\t"))
+	for _, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		fmt.Fprintf(buffp, "%d\t%x", e.ID, uint64(dc.Colors[e.ID]))
+		for c := range dc.Samples {
+			fmt.Fprintf(buffp, "\t%d", dc.Hits[c][e.ID])
+		}
+		fmt.Fprintf(buffp, "\n")
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[DBGColorsWriter] write file: %s failed, err: %v\n", colorsfn, err)
+	}
+}
+
+// DBGColorsReader read the colours file written by DBGColorsWriter, return error if the file
+// not written for the edgesArr
+func DBGColorsReader(colorsfn string, edgesArr []DBGEdge) (dc DBGColors, err error) {
+	fp, err := os.Open(colorsfn)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	buffp := bufio.NewReader(fp)
+	line, err := buffp.ReadString('\n')
+	var hash uint64
+	if _, err1 := fmt.Sscanf(line, "#EdgesHash\t%x\n", &hash); err != nil || err1 != nil {
+		return dc, fmt.Errorf("file: %s header: %q not found edges hash", colorsfn, line)
+	}
+	if h := GetEdgesHash(edgesArr); hash != h {
+		return dc, fmt.Errorf("file: %s edges hash: %x not match the DBG edges hash: %x, please run color again", colorsfn, hash, h)
+	}
+	edgesNum := len(edgesArr)
+	line, err = buffp.ReadString('\n')
+	fields := strings.Split(strings.TrimSuffix(line, "\n"), "\t")
+	if err != nil || len(fields) < 2 || fields[0] != "#ID" {
+		return dc, fmt.Errorf("file: %s header: %q not a colours file", colorsfn, line)
+	}
+	dc.Samples = fields[2:]
+	dc.Colors = make([]ColorSet, edgesNum)
+	dc.Hits = make([][]uint32, len(dc.Samples))
+	for c := range dc.Hits {
+		dc.Hits[c] = make([]uint32, edgesNum)
+	}
+	for line, err = buffp.ReadString('\n'); err == nil; line, err = buffp.ReadString('\n') {
+		fields = strings.Split(line[:len(line)-1], "\t")
+		if len(fields) != len(dc.Samples)+2 {
+			return dc, fmt.Errorf("file: %s line: %q columns number not match samples", colorsfn, line)
+		}
+		id, err1 := strconv.Atoi(fields[0])
+		cs, err2 := strconv.ParseUint(fields[1], 16, 64)
+		if err1 != nil || err2 != nil || id >= edgesNum {
+			return dc, fmt.Errorf("file: %s line: %q format error", colorsfn, line)
+		}
+		dc.Colors[id] = ColorSet(cs)
+		for c := range dc.Samples {
+			h, err := strconv.ParseUint(fields[c+2], 10, 32)
+			if err != nil {
+				return dc, fmt.Errorf("file: %s line: %q format error", colorsfn, line)
+			}
+			dc.Hits[c][id] = uint32(h)
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// LoadStageDBGColors load the colours file of stage if exist, return nil if the DBG not coloured
+func LoadStageDBGColors(prefix, stage string, edgesArr []DBGEdge) *DBGColors {
+	colorsfn := prefix + "." + stage + ".colors"
+	if _, err := os.Stat(colorsfn); err != nil {
+		return nil
+	}
+	dc, err := DBGColorsReader(colorsfn, edgesArr)
+	if err != nil {
+		log.Fatalf("[LoadStageDBGColors] %v\n", err)
+	}
+	return &dc
+}
+
+// StoreColorEdgesToFa write the edges with the samples name to the fasta file
+func StoreColorEdgesToFa(edgesfn string, edgesArr []DBGEdge, dc DBGColors) {
+	fp, err := os.Create(edgesfn)
+	if err != nil {
+		log.Fatalf("[StoreColorEdgesToFa] create file: %s failed, err: %v\n", edgesfn, err)
+	}
+	defer fp.Close()
+	fafp := fasta.NewWriter(fp, 80)
+	for _, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		seq := linear.NewSeq("", nil, alphabet.DNA)
+		seq.ID = strconv.Itoa(int(e.ID))
+		seq.AppendLetters(Transform2Letters(e.Utg.Ks)...)
+		ans := strconv.Itoa(int(e.StartNID)) + "\t" + strconv.Itoa(int(e.EndNID)) + "\tlen:" + strconv.Itoa(seq.Len()) + "\tcov:" + strconv.Itoa(int(e.CovD)) + "\tcolors:" + dc.GetColorLabel(e.ID)
+		seq.Annotation.SetDescription(ans)
+		if _, err := fafp.Write(seq); err != nil {
+			log.Fatalf("[StoreColorEdgesToFa] write seq: %v; err: %v\n", seq, err)
+		}
+	}
+}
+
+// print the number and length of edges found in every sample, specific to the sample and shared by all samples
+func printColorsStat(dc DBGColors, edgesArr []DBGEdge) {
+	all := ColorSet(1)<<uint(len(dc.Samples)) - 1
+	var sharedNum, sharedLen int
+	for c, s := range dc.Samples {
+		var num, totalLen, specNum, specLen int
+		for _, e := range edgesArr {
+			if e.ID < 2 || e.GetDeleteFlag() > 0 || !dc.Colors[e.ID].Has(c) {
+				continue
+			}
+			num++
+			totalLen += len(e.Utg.Ks)
+			if dc.Colors[e.ID].Count() == 1 {
+				specNum++
+				specLen += len(e.Utg.Ks)
+			}
+		}
+		fmt.Printf("[printColorsStat] sample: %s, edges number: %d, length: %d, specific edges number: %d, length: %d\n", s, num, totalLen, specNum, specLen)
+	}
+	for _, e := range edgesArr {
+		if e.ID >= 2 && e.GetDeleteFlag() == 0 && dc.Colors[e.ID] == all {
+			sharedNum++
+			sharedLen += len(e.Utg.Ks)
+		}
+	}
+	fmt.Printf("[printColorsStat] shared by all samples edges number: %d, length: %d\n", sharedNum, sharedLen)
+}
+
+// Color colour the edges of the stage DBG by the samples of cfg file, output colours file,
+// GFA and fasta with the colours of edges
+func Color(c cli.Command) {
+	opt, suc := utils.CheckGlobalArgs(c.Parent())
+	if suc == false {
+		log.Fatalf("[Color] check global Arguments error, opt: %v\n", opt)
+	}
+	stage := c.Flag("stage").String()
+	winSize := c.Flag("WinSize").Get().(int)
+	minHits := c.Flag("MinHits").Get().(int)
+	correct := c.Flag("Correct").Get().(bool)
+	if winSize < 1 || minHits < 1 {
+		log.Fatalf("[Color] argument 'WinSize': %v and 'MinHits': %v must bigger than 0\n", winSize, minHits)
+	}
+	cfgInfo, err := constructcf.ParseCfg(opt.CfgFn, correct)
+	if err != nil {
+		log.Fatalf("[Color] ParseCfg 'C': %v err :%v\n", opt.CfgFn, err)
+	}
+	samples, fnArr := GetCfgSamples(cfgInfo)
+	if len(samples) == 0 {
+		log.Fatalf("[Color] not found reads library in the cfg file: %v\n", opt.CfgFn)
+	}
+	fmt.Printf("[Color] samples: %v\n", samples)
+
+	nodesArr, edgesArr := LoadStageDBG(opt.Prefix, stage, opt.Kmer, opt.NumCPU)
+	dc := ColorDBGEdges(edgesArr, samples, fnArr, opt.Kmer, winSize, minHits, opt.NumCPU)
+	printColorsStat(dc, edgesArr)
+
+	ResetDBGEdgesUniqueFlag(edgesArr)
+	SetDBGEdgesUniqueFlag(edgesArr, nodesArr)
+	colorPrefix := opt.Prefix + "." + stage + ".colors"
+	DBGColorsWriter(dc, edgesArr, colorPrefix)
+	GFAWriter(nodesArr, edgesArr, nil, &dc, colorPrefix+".gfa", opt.Kmer)
+	StoreColorEdgesToFa(colorPrefix+".fa", edgesArr, dc)
+}
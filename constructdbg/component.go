@@ -0,0 +1,217 @@
+package constructdbg
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/jwaldrip/odin/cli"
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/utils"
+)
+
+// MaxSubGID is the DBGNode.SubGID of the nodes in the component which ID >= MaxSubGID
+const MaxSubGID = math.MaxUint8
+
+// DBGComponent is a connected component of DBG
+type DBGComponent struct {
+	ID        int
+	TotalLen  int
+	MaxLen    int
+	EdgeIDArr []DBG_MAX_INT // sorted by increase
+	NodeIDArr []DBG_MAX_INT // sorted by increase
+}
+
+// LabelDBGComponents return the connected components sorted by total length decrease, component
+// ID start from 1, compArr[edge ID] is the component ID of edge, the SubGID of nodes set to the
+// component ID, nodes not linked by any edge set SubGID to zero
+func LabelDBGComponents(nodesArr []DBGNode, edgesArr []DBGEdge) (comps []DBGComponent, compArr []int) {
+	compArr, compNum := LabelEdgesComponent(nodesArr, edgesArr)
+	comps = make([]DBGComponent, compNum)
+	for i, e := range edgesArr {
+		if compArr[i] == 0 || e.ID < 2 {
+			continue
+		}
+		c := &comps[compArr[i]-1]
+		c.EdgeIDArr = append(c.EdgeIDArr, e.ID)
+		c.TotalLen += len(e.Utg.Ks)
+		if len(e.Utg.Ks) > c.MaxLen {
+			c.MaxLen = len(e.Utg.Ks)
+		}
+	}
+	for i, nd := range nodesArr {
+		nodesArr[i].SubGID = 0
+		if i < 2 || nd.GetDeleteFlag() > 0 {
+			continue
+		}
+		for j := 0; j < bnt.BaseTypeNum; j++ {
+			var cID int
+			for _, id := range [2]DBG_MAX_INT{nd.EdgeIDIncoming[j], nd.EdgeIDOutcoming[j]} {
+				if id > 1 && compArr[id] > 0 {
+					cID = compArr[id]
+				}
+			}
+			if cID > 0 {
+				comps[cID-1].NodeIDArr = append(comps[cID-1].NodeIDArr, nd.ID)
+				break
+			}
+		}
+	}
+
+	// the component found first(smaller edge ID) go ahead if same total length
+	for i := range comps {
+		comps[i].ID = i + 1
+	}
+	sort.SliceStable(comps, func(i, j int) bool { return comps[i].TotalLen > comps[j].TotalLen })
+	newID := make([]int, compNum+1)
+	for i := range comps {
+		newID[comps[i].ID] = i + 1
+		comps[i].ID = i + 1
+	}
+	for i, c := range compArr {
+		compArr[i] = newID[c]
+	}
+	for _, c := range comps {
+		gID := uint8(MaxSubGID)
+		if c.ID < MaxSubGID {
+			gID = uint8(c.ID)
+		}
+		for _, nID := range c.NodeIDArr {
+			nodesArr[nID].SubGID = gID
+		}
+	}
+	return
+}
+
+// ParaProcessComponents call f for every component by numCPU goroutines, the components
+// share no nodes and edges, so f can modify the nodes and edges of its component freely
+func ParaProcessComponents(comps []DBGComponent, numCPU int, f func(comp DBGComponent)) {
+	if numCPU < 1 {
+		numCPU = 1
+	}
+	cc := make(chan DBGComponent, numCPU)
+	done := make(chan bool, numCPU)
+	for i := 0; i < numCPU; i++ {
+		go func() {
+			for comp := range cc {
+				f(comp)
+			}
+			done <- true
+		}()
+	}
+	for _, comp := range comps {
+		cc <- comp
+	}
+	close(cc)
+	for i := 0; i < numCPU; i++ {
+		<-done
+	}
+}
+
+// DBGComponentsWriter write the size of components to compfn and the component ID of every
+// edge to compfn + ".edges"
+func DBGComponentsWriter(comps []DBGComponent, compfn string) {
+	fp, err := os.Create(compfn)
+	if err != nil {
+		log.Fatalf("[DBGComponentsWriter] create file: %s failed, err: %v\n", compfn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriter(fp)
+	efp, err := os.Create(compfn + ".edges")
+	if err != nil {
+		log.Fatalf("[DBGComponentsWriter] create file: %s failed, err: %v\n", compfn+".edges", err)
+	}
+	defer efp.Close()
+	ebuffp := bufio.NewWriter(efp)
+	fmt.Fprintf(buffp, "#ID\tedgesNum\tnodesNum\ttotalLen\tmaxLen\n")
+	fmt.Fprintf(ebuffp, "#edgeID\tcompID\n")
+	for _, c := range comps {
+		fmt.Fprintf(buffp, "%d\t%d\t%d\t%d\t%d\n", c.ID, len(c.EdgeIDArr), len(c.NodeIDArr), c.TotalLen, c.MaxLen)
+		for _, eID := range c.EdgeIDArr {
+			fmt.Fprintf(ebuffp, "%d\t%d\n", eID, c.ID)
+		}
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[DBGComponentsWriter] write file: %s failed, err: %v\n", compfn, err)
+	}
+	if err := ebuffp.Flush(); err != nil {
+		log.Fatalf("[DBGComponentsWriter] write file: %s failed, err: %v\n", compfn+".edges", err)
+	}
+}
+
+// StoreDBGComponents label the components of DBG and write to the files with prefix: prefix.<stage>.comps
+func StoreDBGComponents(nodesArr []DBGNode, edgesArr []DBGEdge, prefix, stage string) (comps []DBGComponent) {
+	comps, _ = LabelDBGComponents(nodesArr, edgesArr)
+	DBGComponentsWriter(comps, prefix+"."+stage+".comps")
+	if len(comps) > 0 {
+		fmt.Printf("[StoreDBGComponents] stage: %s, components number: %d, the largest component edges number: %d, total length: %d\n", stage, len(comps), len(comps[0].EdgeIDArr), comps[0].TotalLen)
+	}
+	return
+}
+
+// MaskOtherComponents set delete flag to the nodes and edges not in the component compID
+func MaskOtherComponents(nodesArr []DBGNode, edgesArr []DBGEdge, compID int) DBGComponent {
+	comps, compArr := LabelDBGComponents(nodesArr, edgesArr)
+	if compID < 1 || compID > len(comps) {
+		log.Fatalf("[MaskOtherComponents] component ID: %d not in the DBG, components number: %d\n", compID, len(comps))
+	}
+	for i, e := range edgesArr {
+		if e.ID >= 2 && compArr[i] != compID {
+			edgesArr[i].SetDeleteFlag()
+		}
+	}
+	nodeSet := make([]bool, len(nodesArr))
+	for _, nID := range comps[compID-1].NodeIDArr {
+		nodeSet[nID] = true
+	}
+	for i, nd := range nodesArr {
+		if nd.ID >= 2 && !nodeSet[i] {
+			nodesArr[i].SetDeleteFlag()
+		}
+	}
+	return comps[compID-1]
+}
+
+// Comp export a connected component of DBG to the dot, GFA and fasta files, the component
+// selected by ID or by an edge in the component
+func Comp(c cli.Command) {
+	opt, suc := utils.CheckGlobalArgs(c.Parent())
+	if suc == false {
+		log.Fatalf("[Comp] check global Arguments error, opt: %v\n", opt)
+	}
+	stage := c.Flag("stage").String()
+	compID := c.Flag("c").Get().(int)
+	eID := c.Flag("e").Get().(int)
+	if (compID > 0) == (eID > 0) {
+		log.Fatalf("[Comp] must set one of argument 'c': %v and 'e': %v\n", compID, eID)
+	}
+
+	nodesArr, edgesArr := LoadStageDBG(opt.Prefix, stage, opt.Kmer, opt.NumCPU)
+	comps, compArr := LabelDBGComponents(nodesArr, edgesArr)
+	if eID > 0 {
+		if eID >= len(edgesArr) || compArr[eID] == 0 {
+			log.Fatalf("[Comp] edge ID: %d not found in the DBG\n", eID)
+		}
+		compID = compArr[eID]
+	}
+	if compID > len(comps) {
+		log.Fatalf("[Comp] component ID: %d not in the DBG, components number: %d\n", compID, len(comps))
+	}
+	comp := comps[compID-1]
+	edgeSet := make([]bool, len(edgesArr))
+	for _, id := range comp.EdgeIDArr {
+		edgeSet[id] = true
+	}
+	fmt.Printf("[Comp] component ID: %d, edges number: %d, nodes number: %d, total length: %d\n", comp.ID, len(comp.EdgeIDArr), len(comp.NodeIDArr), comp.TotalLen)
+
+	ResetDBGEdgesUniqueFlag(edgesArr)
+	SetDBGEdgesUniqueFlag(edgesArr, nodesArr)
+	compPrefix := opt.Prefix + "." + stage + ".comp" + strconv.Itoa(comp.ID)
+	GraphvizSubDBG(nodesArr, edgesArr, edgeSet, compPrefix+".dot")
+	GFAWriter(nodesArr, edgesArr, edgeSet, LoadStageDBGColors(opt.Prefix, stage, edgesArr), compPrefix+".gfa", opt.Kmer)
+	StoreSubEdgesToFa(compPrefix+".fa", edgesArr, edgeSet)
+}
@@ -3,7 +3,6 @@ package constructdbg
 import (
 	"bufio"
 	"encoding/binary"
-	"encoding/gob"
 	"fmt"
 	"io"
 	"log"
@@ -14,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mudesheng/ga/bnt"
@@ -404,6 +404,16 @@ func ExtendNodeKmer(nkb, rkb constructcf.KmerBnt, cf cuckoofilter.CuckooFilter,
 	return
 }
 
+// HasEdgeIDPlaceholder return true if the node has edge slot set 1 that need to walk
+func HasEdgeIDPlaceholder(nd DBGNode) bool {
+	for i := 0; i < bnt.BaseTypeNum; i++ {
+		if nd.EdgeIDIncoming[i] == 1 || nd.EdgeIDOutcoming[i] == 1 {
+			return true
+		}
+	}
+	return false
+}
+
 func ChangeEdgeIDComing(nd DBGNode) DBGNode {
 	for i := 0; i < bnt.BaseTypeNum; i++ {
 		if nd.EdgeIDIncoming[i] == math.MaxUint32 {
@@ -520,7 +530,7 @@ func paraLookupComplexNode(cs chan constructcf.KmerBntBucket, wc chan DBGNode, c
 					}
 					copy(wd.Seq, nkb.Seq)
 					//fmt.Printf("[paraLookupComplexNode] node: %v\n", wd)
-					wc <- nd
+					wc <- wd
 				}
 			}
 		}
@@ -1009,9 +1019,9 @@ func WritefqRecord(edgesbuffp io.Writer, ei DBGEdge) {
 }
 
 // WriteEdgesToFn write edges seq to the file
-func WriteEdgesToFn(edgesfn string, wc <-chan EdgeNode, numCPU int, nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode, anc chan<- DBGNode, kmerlen int) (edgeID DBG_MAX_INT) {
+func WriteEdgesToFn(edgesfn string, wc <-chan EdgeNode, numCPU int, nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode, anc chan<- DBGNode, kmerlen int, startEdgeID DBG_MAX_INT) (edgeID DBG_MAX_INT) {
 	//oldNodeID := nodeID
-	edgeID = DBG_MAX_INT(2)
+	edgeID = startEdgeID
 	edgesNum := 0
 	edgesfp, err := os.Create(edgesfn)
 	if err != nil {
@@ -1338,7 +1348,8 @@ func WriteEdgesToFn(edgesfn string, wc <-chan EdgeNode, numCPU int, nodeMap map[
 	}
 }*/
 
-func GenerateDBGEdges(nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode, cf cuckoofilter.CuckooFilter, edgesfn string, numCPU int, nodeID DBG_MAX_INT) (newNodeID DBG_MAX_INT, edgeID DBG_MAX_INT) {
+// GenerateDBGEdges walk the edges from the node slots set 1, the new edges ID start from startEdgeID
+func GenerateDBGEdges(nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode, cf cuckoofilter.CuckooFilter, edgesfn string, numCPU int, nodeID, startEdgeID DBG_MAX_INT) (newNodeID DBG_MAX_INT, edgeID DBG_MAX_INT) {
 	bufsize := 50
 	nc := make(chan DBGNode)
 	wc := make(chan EdgeNode, bufsize)
@@ -1347,7 +1358,7 @@ func GenerateDBGEdges(nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode, cf cuckoofilt
 	nodeArr := make([]DBGNode, nodeID)
 	idx := 0
 	for _, value := range nodeMap {
-		if len(value.Seq) > 0 && value.Flag == 0 {
+		if len(value.Seq) > 0 && value.Flag == 0 && HasEdgeIDPlaceholder(value) {
 			nodeArr[idx] = value
 			idx++
 		}
@@ -1364,7 +1375,7 @@ func GenerateDBGEdges(nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode, cf cuckoofilt
 	//totalNodeNum := make(chan DBG_MAX_INT，1)
 	go CollectAddedDBGNode(anc, nodeMap, nc, &nodeID, readNodeMapFinishedC)
 	// write edges Seq to the file
-	edgeID = WriteEdgesToFn(edgesfn, wc, numCPU, nodeMap, anc, cf.Kmerlen)
+	edgeID = WriteEdgesToFn(edgesfn, wc, numCPU, nodeMap, anc, cf.Kmerlen, startEdgeID)
 	newNodeID = nodeID
 	// Change nodeMap monitor function
 	//newNodeID, edgeID = ChangeNodeMap(nodeMap, anc, finishedC, nIEC, flagNIEC, cf.Kmerlen, nodeID)
@@ -1471,62 +1482,6 @@ func EdgesStatReader(edgesStatfn string) (edgesSize int) {
 	return
 }
 
-func NodeMapMmapWriter(nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode, nodesfn string) {
-	nodesfp, err := os.Create(nodesfn)
-	if err != nil {
-		log.Fatalf("[NodeMapMmapWriter] file %s create error, err: %v\n", nodesfn, err)
-	}
-	defer nodesfp.Close()
-	enc := gob.NewEncoder(nodesfp)
-	err = enc.Encode(nodeMap)
-	if err != nil {
-		log.Fatalf("[NodeMapMmapWriter] encode err: %v\n", err)
-	}
-}
-
-func NodeMapMmapReader(nodesfn string) (nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode) {
-	nodesfp, err := os.Open(nodesfn)
-	if err != nil {
-		log.Fatalf("[NodeMapMmapReader] open file %s failed, err:%v\n", nodesfn, err)
-	}
-	defer nodesfp.Close()
-	dec := gob.NewDecoder(nodesfp)
-	err = dec.Decode(&nodeMap)
-	if err != nil {
-		log.Fatalf("[NodeMapMmapReader] decode failed, err: %v\n", err)
-	}
-
-	return
-}
-
-func NodesArrWriter(nodesArr []DBGNode, nodesfn string) {
-	nodesfp, err := os.Create(nodesfn)
-	if err != nil {
-		log.Fatalf("[NodesArrWriter] file %s create error, err: %v\n", nodesfn, err)
-	}
-	defer nodesfp.Close()
-	enc := gob.NewEncoder(nodesfp)
-	err = enc.Encode(nodesArr)
-	if err != nil {
-		log.Fatalf("[NodeMapMmapWriter] encode err: %v\n", err)
-	}
-}
-
-func NodesArrReader(nodesfn string) (nodesArr []DBGNode) {
-	nodesfp, err := os.Open(nodesfn)
-	if err != nil {
-		log.Fatalf("[NodeMapMmapReader] open file %s failed, err:%v\n", nodesfn, err)
-	}
-	defer nodesfp.Close()
-	dec := gob.NewDecoder(nodesfp)
-	err = dec.Decode(&nodesArr)
-	if err != nil {
-		log.Fatalf("[NodeMapMmapReader] decode failed, err: %v\n", err)
-	}
-
-	return
-}
-
 func NodeMap2NodeArr(nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode, nodesArr []DBGNode) {
 	naLen := DBG_MAX_INT(len(nodesArr))
 	for _, v := range nodeMap {
@@ -1645,6 +1600,14 @@ func CDBG(c cli.Command) {
 	cf.GetStat()
 	// fmt.Printf("[CDBG] cf.Hash[0]: %v\n", cf.Hash[0])
 	//Kmerlen = cf.Kmerlen
+	deterministic := c.Flag("Deterministic").Get().(bool)
+	ConstructDBG(cf, prefix, numCPU, deterministic)
+}
+
+// ConstructDBG construct DBG from the cuckoofilter and uniq kmers file, write the nodes
+// and edges to the files with prefix, if deterministic, the nodes and edges renumbered by
+// RenumberDBGCanonical
+func ConstructDBG(cf cuckoofilter.CuckooFilter, prefix string, numCPU int, deterministic bool) {
 	bufsize := 20
 	cs := make(chan constructcf.KmerBntBucket, bufsize)
 	wc := make(chan DBGNode, bufsize*50)
@@ -1673,12 +1636,22 @@ func CDBG(c cli.Command) {
 	// parallel generate edges and write to file
 	edgefn := prefix + ".edges.fq"
 	//numCPU = 1
-	newNodeID, edgeID := GenerateDBGEdges(nodeMap, cf, edgefn, numCPU, nodeID)
+	newNodeID, edgeID := GenerateDBGEdges(nodeMap, cf, edgefn, numCPU, nodeID, 2)
+	// write DBG nodes to the file
+	nodesArr := make([]DBGNode, newNodeID)
+	NodeMap2NodeArr(nodeMap, nodesArr)
+	edgesArr := ReadEdgesFromFile(edgefn, edgeID)
+	if deterministic {
+		nodesArr, edgesArr = RenumberDBGCanonical(nodesArr, edgesArr, cf.Kmerlen)
+		WriteEdgesArrToFn(edgefn, edgesArr)
+		newNodeID, edgeID = DBG_MAX_INT(len(nodesArr)), DBG_MAX_INT(len(edgesArr))
+	}
+	EdgesArrBinWriter(edgesArr, prefix+".edges.bin", cf.Kmerlen)
 	DBGStatfn := prefix + ".DBG.stat"
 	DBGStatWriter(DBGStatfn, newNodeID, edgeID)
-	// write DBG node map to the file
+	StoreDBGComponents(nodesArr, edgesArr, prefix, "cdbg")
 	nodesfn := prefix + ".nodes.mmap"
-	NodeMapMmapWriter(nodeMap, nodesfn)
+	NodesArrWriter(nodesArr, nodesfn, cf.Kmerlen)
 }
 
 func ParseEdge(edgesbuffp *bufio.Reader) (edge DBGEdge, err error) {
@@ -2178,15 +2151,62 @@ func MakeSelfCycleEdgeOutcomingToIncoming(nodesArr []DBGNode, edgesArr []DBGEdge
 }
 
 func SmfyDBG(nodesArr []DBGNode, edgesArr []DBGEdge, opt Options) {
-	kmerlen := opt.Kmer
-	deleteNodeNum, deleteEdgeNum := 0, 0
-	longTipsEdgesNum := 0
-
 	// clean DBG EdgeIDComing
 	CleanDBGEdgeIDComing(nodesArr)
 
+	var deleteNodeNum, deleteEdgeNum, longTipsEdgesNum int64
+	if !opt.ParaSmfy {
+		nIDArr := make([]DBG_MAX_INT, 0, len(nodesArr))
+		for i := 2; i < len(nodesArr); i++ {
+			nIDArr = append(nIDArr, DBG_MAX_INT(i))
+		}
+		eIDArr := make([]DBG_MAX_INT, 0, len(edgesArr))
+		for i := 2; i < len(edgesArr); i++ {
+			eIDArr = append(eIDArr, DBG_MAX_INT(i))
+		}
+		dn, de, lt := smfyDBGComponent(nodesArr, edgesArr, nIDArr, eIDArr, opt)
+		fmt.Printf("[SmfyDBG]deleted nodes number is : %d\n", dn)
+		fmt.Printf("[SmfyDBG]deleted edges number is : %d\n", de)
+		fmt.Printf("[SmfyDBG]long tips number is : %d\n", lt)
+		return
+	}
+
+	// the components not linked each other, simplify every component in parallel,
+	// the nodes and edges not in any component simplify at last
+	comps, compArr := LabelDBGComponents(nodesArr, edgesArr)
+	ParaProcessComponents(comps, opt.NumCPU, func(comp DBGComponent) {
+		dn, de, lt := smfyDBGComponent(nodesArr, edgesArr, comp.NodeIDArr, comp.EdgeIDArr, opt)
+		atomic.AddInt64(&deleteNodeNum, int64(dn))
+		atomic.AddInt64(&deleteEdgeNum, int64(de))
+		atomic.AddInt64(&longTipsEdgesNum, int64(lt))
+	})
+	var restNArr, restEArr []DBG_MAX_INT
 	for i, v := range nodesArr {
-		if i < 2 || v.GetDeleteFlag() > 0 {
+		if i >= 2 && v.GetDeleteFlag() == 0 && v.SubGID == 0 {
+			restNArr = append(restNArr, DBG_MAX_INT(i))
+		}
+	}
+	for i, e := range edgesArr {
+		if i >= 2 && (e.ID < 2 || compArr[i] == 0) {
+			restEArr = append(restEArr, DBG_MAX_INT(i))
+		}
+	}
+	dn, de, lt := smfyDBGComponent(nodesArr, edgesArr, restNArr, restEArr, opt)
+	deleteNodeNum += int64(dn)
+	deleteEdgeNum += int64(de)
+	longTipsEdgesNum += int64(lt)
+
+	fmt.Printf("[SmfyDBG]deleted nodes number is : %d\n", deleteNodeNum)
+	fmt.Printf("[SmfyDBG]deleted edges number is : %d\n", deleteEdgeNum)
+	fmt.Printf("[SmfyDBG]long tips number is : %d\n", longTipsEdgesNum)
+}
+
+// simplify the nodes of nIDArr and the edges of eIDArr
+func smfyDBGComponent(nodesArr []DBGNode, edgesArr []DBGEdge, nIDArr, eIDArr []DBG_MAX_INT, opt Options) (deleteNodeNum, deleteEdgeNum, longTipsEdgesNum int) {
+	kmerlen := opt.Kmer
+	for _, i := range nIDArr {
+		v := nodesArr[i]
+		if v.GetDeleteFlag() > 0 {
 			continue
 		}
 		if IsContainCycleEdge(v) {
@@ -2232,6 +2252,7 @@ func SmfyDBG(nodesArr []DBGNode, edgesArr []DBGEdge, opt Options) {
 				}
 				//fmt.Printf("[SmfyDBG]v: %v\ne1.ID: %v, e1.StartNID: %v, e1.EndNID: %v, e2.ID:%v, e2.StartNID: %v, e2.EndNID: %v\n", v, e1.ID, e1.StartNID, e1.EndNID, e2.ID, e2.StartNID, e2.EndNID)
 				edgesArr[inID].Utg = ConcatEdges(u1, u2, kmerlen)
+				edgesArr[inID].CovD = GetMergedCovD(e1, e2, kmerlen)
 				edgesArr[inID].EndNID = nID
 				if nID > 0 && !SubstituteEdgeID(nodesArr, nID, e2.ID, e1.ID) {
 					log.Fatalf("[SmfyDBG]v: %v\ne2.ID: %v substitute by e1.ID: %v failed, node: %v\n", v, e2.ID, e1.ID, nodesArr[nID])
@@ -2244,6 +2265,7 @@ func SmfyDBG(nodesArr []DBGNode, edgesArr []DBGEdge, opt Options) {
 				}
 				//fmt.Printf("[SmfyDBG]v: %v\ne1.ID: %v, e1.StartNID: %v, e1.EndNID: %v, e2.ID:%v, e2.StartNID: %v, e2.EndNID: %v\n", v, e1.ID, e1.StartNID, e1.EndNID, e2.ID, e2.StartNID, e2.EndNID)
 				edgesArr[inID].Utg = ConcatEdges(u2, u1, kmerlen)
+				edgesArr[inID].CovD = GetMergedCovD(e1, e2, kmerlen)
 				edgesArr[inID].StartNID = nID
 				if nID > 0 && !SubstituteEdgeID(nodesArr, nID, e2.ID, e1.ID) {
 					log.Fatalf("[SmfyDBG]v: %v\ne2.ID: %v substitute by e1.ID: %v failed, node: %v\n", v, e2.ID, e1.ID, nodesArr[nID])
@@ -2258,8 +2280,9 @@ func SmfyDBG(nodesArr []DBGNode, edgesArr []DBGEdge, opt Options) {
 	}
 
 	// delete maybe short repeat edge than small than opt.MaxNGSReadLen
-	for i, e := range edgesArr {
-		if i < 2 || e.GetDeleteFlag() > 0 {
+	for _, i := range eIDArr {
+		e := edgesArr[i]
+		if e.GetDeleteFlag() > 0 {
 			continue
 		}
 
@@ -2280,10 +2303,7 @@ func SmfyDBG(nodesArr []DBGNode, edgesArr []DBGEdge, opt Options) {
 			}
 		}*/
 	}
-
-	fmt.Printf("[SmfyDBG]deleted nodes number is : %d\n", deleteNodeNum)
-	fmt.Printf("[SmfyDBG]deleted edges number is : %d\n", deleteEdgeNum)
-	fmt.Printf("[SmfyDBG]long tips number is : %d\n", longTipsEdgesNum)
+	return
 }
 
 func CheckDBGSelfCycle(nodesArr []DBGNode, edgesArr []DBGEdge, kmerlen int) {
@@ -2425,7 +2445,7 @@ func StoreEdgesToFn(edgesfn string, edgesArr []DBGEdge) {
 				}
 				path = path[:len(path)-1]
 			}*/
-			ans := strconv.Itoa(int(v.StartNID)) + "\t" + strconv.Itoa(int(v.EndNID)) + "\tpath:" + path + "\tlen:" + strconv.Itoa(seq.Len())
+			ans := strconv.Itoa(int(v.StartNID)) + "\t" + strconv.Itoa(int(v.EndNID)) + "\tpath:" + path + "\tlen:" + strconv.Itoa(seq.Len()) + "\tcov:" + strconv.Itoa(int(v.CovD))
 			seq.Annotation.SetDescription(ans)
 			_, err := fqfp.Write(seq)
 			if err != nil {
@@ -2502,10 +2522,18 @@ func LoadEdgesfqFromFn(fn string, edgesArr []DBGEdge, qual bool) {
 			edge.ID = DBG_MAX_INT(id)
 			var ps string
 			var lenKs int
-			_, err = fmt.Sscanf(l.Description(), "%v\t%v\t%v\tlen:%d\n", &edge.StartNID, &edge.EndNID, &ps, &lenKs)
+			_, err = fmt.Sscanf(l.Description(), "%v\t%v\t%v\tlen:%d", &edge.StartNID, &edge.EndNID, &ps, &lenKs)
 			if err != nil {
 				log.Fatalf("[LoadEdgesfqFromFn] parse Description:%s of fastq err: %v\n", l.Description(), err)
 			}
+			// the coverage field added by smfy, old edges file have not it
+			if p := strings.Index(l.Description(), "\tcov:"); p >= 0 {
+				cov, err := strconv.Atoi(strings.TrimSpace(l.Description()[p+5:]))
+				if err != nil {
+					log.Fatalf("[LoadEdgesfqFromFn] parse coverage of Description:%s err: %v\n", l.Description(), err)
+				}
+				edge.CovD = uint16(cov)
+			}
 			if len(ps) > 5 {
 				var path Path
 				for _, item := range strings.Split(ps[5:], "-") { // ps[:5] == "path:"
@@ -5159,6 +5187,10 @@ type Options struct {
 	MaxNGSReadLen int
 	MinMapFreq    int
 	Correct       bool
+	RmLowCov      bool // remove low coverage edges after SmfyDBG
+	MinEdgeCov    int  // absolute coverage threshold of removed edges
+	CovRatio      int  // relative coverage threshold(percent of neighbor edges) of removed short edges
+	ParaSmfy      bool // simplify the connected components of DBG in parallel
 	//MaxMapEdgeLen int // max length of edge that don't need cut two flank sequence to map Long Reads
 }
 
@@ -5205,6 +5237,29 @@ func checkArgs(c cli.Command) (opt Options, succ bool) {
 		opt.TipMaxLen = opt.MaxNGSReadLen
 	}
 
+	opt.RmLowCov, ok = c.Flag("RmLowCov").Get().(bool)
+	if !ok {
+		log.Fatalf("[checkArgs] argument 'RmLowCov': %v set error\n ", c.Flag("RmLowCov").String())
+	}
+	opt.MinEdgeCov, ok = c.Flag("MinEdgeCov").Get().(int)
+	if !ok {
+		log.Fatalf("[checkArgs] argument 'MinEdgeCov': %v set error\n ", c.Flag("MinEdgeCov").String())
+	}
+	if opt.MinEdgeCov < 0 {
+		log.Fatalf("[checkArgs] argument 'MinEdgeCov': %v must >= 0\n", c.Flag("MinEdgeCov").String())
+	}
+	opt.CovRatio, ok = c.Flag("CovRatio").Get().(int)
+	if !ok {
+		log.Fatalf("[checkArgs] argument 'CovRatio': %v set error\n ", c.Flag("CovRatio").String())
+	}
+	if opt.CovRatio < 0 || opt.CovRatio >= 100 {
+		log.Fatalf("[checkArgs] argument 'CovRatio': %v must between 0~99\n", c.Flag("CovRatio").String())
+	}
+	opt.ParaSmfy, ok = c.Flag("ParaSmfy").Get().(bool)
+	if !ok {
+		log.Fatalf("[checkArgs] argument 'ParaSmfy': %v set error\n ", c.Flag("ParaSmfy").String())
+	}
+
 	/*opt.MaxMapEdgeLen, ok = c.Flag("MaxMapEdgeLen").Get().(int)
 	if !ok {
 		log.Fatalf("[checkArgs] argument 'MaxMapEdgeLen': %v set error\n ", c.Flag("MaxMapEdgeLen").String())
@@ -5218,14 +5273,12 @@ func checkArgs(c cli.Command) (opt Options, succ bool) {
 }
 
 func Smfy(c cli.Command) {
-
-	t0 := time.Now()
 	// check agruments
 	gOpt, suc := utils.CheckGlobalArgs(c.Parent())
 	if suc == false {
 		log.Fatalf("[Smfy] check global Arguments error, opt: %v\n", gOpt)
 	}
-	opt := Options{gOpt, 0, 0, 0, 0, false}
+	opt := Options{gOpt, 0, 0, 0, 0, false, false, 0, 0, false}
 	tmp, suc := checkArgs(c)
 	if suc == false {
 		log.Fatalf("[Smfy] check Arguments error, opt: %v\n", tmp)
@@ -5235,34 +5288,41 @@ func Smfy(c cli.Command) {
 	opt.WinSize = tmp.WinSize
 	opt.MinMapFreq = tmp.MinMapFreq
 	opt.Correct = tmp.Correct
+	opt.RmLowCov = tmp.RmLowCov
+	opt.MinEdgeCov = tmp.MinEdgeCov
+	opt.CovRatio = tmp.CovRatio
+	opt.ParaSmfy = tmp.ParaSmfy
 	//opt.MaxMapEdgeLen = tmp.MaxMapEdgeLen
 	fmt.Printf("Arguments: %v\n", opt)
+	nodesArr, edgesArr := SmfyDBGFiles(opt)
+	StoreSmfyDBG(opt, nodesArr, edgesArr)
+}
 
+// SmfyDBGFiles load the DBG constructed by cdbg and simplify it
+func SmfyDBGFiles(opt Options) (nodesArr []DBGNode, edgesArr []DBGEdge) {
+	t0 := time.Now()
 	// set package-level variable
 	//Kmerlen = opt.Kmer
 
 	// read nodes file and transform to array mode for more quckly access
 	nodesfn := opt.Prefix + ".nodes.mmap"
-	nodeMap := NodeMapMmapReader(nodesfn)
+	nodesArr = NodesArrReader(nodesfn, opt.Kmer)
 	DBGStatfn := opt.Prefix + ".DBG.stat"
 	nodesSize, edgesSize := DBGStatReader(DBGStatfn)
-	//nodesSize := len(nodeMap)
-	fmt.Printf("[Smfy] len(nodeMap): %v, length of edge array: %v\n", nodesSize, edgesSize)
+	if len(nodesArr) != int(nodesSize) {
+		log.Fatalf("[Smfy] len(nodesArr): %v != nodes size: %v in file: %v\n", len(nodesArr), nodesSize, DBGStatfn)
+	}
+	fmt.Printf("[Smfy] len(nodesArr): %v, length of edge array: %v\n", nodesSize, edgesSize)
 	// read edges file
-	edgesfn := opt.Prefix + ".edges.fq"
-	edgesArr := ReadEdgesFromFile(edgesfn, edgesSize)
+	edgesArr = LoadCDBGEdgesArr(opt.Prefix, int(edgesSize), opt.Kmer, opt.NumCPU)
 	gfn1 := opt.Prefix + ".beforeSmfyDBG.dot"
-	GraphvizDBG(nodeMap, edgesArr, gfn1)
+	GraphvizDBGArr(nodesArr, edgesArr, gfn1)
 
 	//gfn := opt.Prefix + ".smfyDBG.dot"
 	//GraphvizDBG(nodeMap, edgesArr, gfn)
 	// reconstruct consistence De Bruijn Graph
 	// ReconstructConsistenceDBG(nodeMap, edgesArr)
 
-	nodesArr := make([]DBGNode, nodesSize)
-	NodeMap2NodeArr(nodeMap, nodesArr)
-	nodeMap = nil // nodeMap any more used
-
 	t1 := time.Now()
 	SmfyDBG(nodesArr, edgesArr, opt)
 	MakeSelfCycleEdgeOutcomingToIncoming(nodesArr, edgesArr, opt)
@@ -5273,6 +5333,9 @@ func Smfy(c cli.Command) {
 	fmt.Printf("[Smfy] the number of DBG Semi-Unique  Edges is : %d\n", semiUniqueNum)
 	fmt.Printf("[Smfy] the number of DBG twoEdgeCycleNum  Edges is : %d\n", twoEdgeCycleNum)
 	fmt.Printf("[Smfy] the number of DBG selfCycleNum  Edges is : %d\n", selfCycleNum)
+	if opt.RmLowCov {
+		CleanLowCovEdges(nodesArr, edgesArr, opt)
+	}
 
 	// map Illumina reads to the DBG and find reads map path for simplify DBG
 	/*wrFn := opt.Prefix + ".smfy.NGSAlignment"
@@ -5301,14 +5364,30 @@ func Smfy(c cli.Command) {
 	// Debug code
 	// output graphviz graph
 
+	return
+}
+
+// StorePPDBG write the DBG simplified by pp to the files with prefix, the DBG of the read paths
+// index, loaded by LoadStageDBG of stage "pp"
+func StorePPDBG(prefix string, nodesArr []DBGNode, edgesArr []DBGEdge, kmerlen int) {
+	EdgesArrBinWriter(edgesArr, prefix+".edges.pp.bin", kmerlen)
+	NodesArrWriter(nodesArr, prefix+".nodes.pp.Arr", kmerlen)
+	DBGInfoWriter(prefix+".pp.DBGInfo", len(edgesArr), len(nodesArr))
+}
+
+// StoreSmfyDBG write the simplified DBG to the files with opt.Prefix
+func StoreSmfyDBG(opt Options, nodesArr []DBGNode, edgesArr []DBGEdge) {
 	smfyEdgesfn := opt.Prefix + ".edges.smfy.fq"
 	StoreEdgesToFn(smfyEdgesfn, edgesArr)
+	smfyEdgesBinfn := opt.Prefix + ".edges.smfy.bin"
+	EdgesArrBinWriter(edgesArr, smfyEdgesBinfn, opt.Kmer)
 	//mappingEdgefn := opt.Prefix + ".edges.mapping.fa"
 	// StoreMappingEdgesToFn(mappingEdgefn, edgesArr, opt.MaxMapEdgeLen)
 	//	adpaterEdgesfn := prefix + ".edges.adapter.fq"
 	//	StoreEdgesToFn(adpaterEdgesfn, edgesArr, true)
+	StoreDBGComponents(nodesArr, edgesArr, opt.Prefix, "smfy")
 	smfyNodesfn := opt.Prefix + ".nodes.smfy.Arr"
-	NodesArrWriter(nodesArr, smfyNodesfn)
+	NodesArrWriter(nodesArr, smfyNodesfn, opt.Kmer)
 	DBGInfofn := opt.Prefix + ".smfy.DBGInfo"
 	DBGInfoWriter(DBGInfofn, len(edgesArr), len(nodesArr))
 	//EdgesStatWriter(edgesStatfn, len(edgesArr))
@@ -0,0 +1,233 @@
+package constructdbg
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math"
+	"os"
+
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/cuckoofilter"
+)
+
+// LowCovEdgeInfo note a edge removed by RemoveLowCovEdges
+type LowCovEdgeInfo struct {
+	ID, StartNID, EndNID DBG_MAX_INT
+	Len                  int
+	CovD                 uint16 // coverage depth of the removed edge
+	NeighborCovD         uint16 // max coverage depth of the edges linked by StartNID and EndNID
+	Reason               string // "absolute" or "relative"
+}
+
+// LoadCuckooFilter recover the cuckoofilter constructed by ccf
+func LoadCuckooFilter(prefix string) (cf cuckoofilter.CuckooFilter) {
+	cfInfofn := prefix + ".cf.Info"
+	cf, err := cuckoofilter.RecoverCuckooFilterInfo(cfInfofn)
+	if err != nil {
+		log.Fatalf("[LoadCuckooFilter] Read CuckooFilter info file: %v err: %v\n", cfInfofn, err)
+	}
+	cf.Hash = make([]cuckoofilter.Bucket, cf.NumItems)
+	cffn := prefix + ".cf.Hash.br"
+	err = cf.HashReader(cffn)
+	if err != nil {
+		log.Fatalf("[LoadCuckooFilter] Read CuckooFilter Hash file: %v err: %v\n", cffn, err)
+	}
+	return cf
+}
+
+// GetEdgeSampleNum return the number of kmers sampled from the edge by ConstructCFDBGMinimizers
+// with the whole edge sampled, one kmer every winSize kmers
+func GetEdgeSampleNum(e DBGEdge, kmerlen, winSize int) int {
+	kn := len(e.Utg.Ks) - kmerlen + 1
+	if kn < 1 {
+		return 0
+	}
+	return (kn + winSize - 1) / winSize
+}
+
+// GetMergedCovD return the coverage depth of the edge concatenated by e1 and e2,
+// the average of two edges weighted by the kmers number
+func GetMergedCovD(e1, e2 DBGEdge, kmerlen int) uint16 {
+	n1, n2 := len(e1.Utg.Ks)-kmerlen+1, len(e2.Utg.Ks)-kmerlen+1
+	if n1+n2 < 1 {
+		return 0
+	}
+	return uint16((int(e1.CovD)*n1 + int(e2.CovD)*n2) / (n1 + n2))
+}
+
+// ComputeEdgesCovD set DBGEdge.CovD to the kmer coverage depth counted from the reads files,
+// the edges sampled by minimizers of winSize window like ColorDBGEdges, CovD is the average
+// number of reads kmers hit the sampled kmers of edge
+func ComputeEdgesCovD(edgesArr []DBGEdge, fnArr []string, kmerlen, winSize, numCPU int) {
+	cfSize := GetCuckoofilterDBGSampleSize(edgesArr, int64(winSize), int64(math.MaxInt32), int64(kmerlen))
+	cf := MakeCuckooFilter(uint64(cfSize*7), kmerlen)
+	count := ConstructCFDBGMinimizers(cf, edgesArr, winSize, math.MaxInt32)
+	fmt.Printf("[ComputeEdgesCovD] construct Sample of DBG edges cuckoofilter number is : %v\n", count)
+
+	hits := make([]uint32, len(edgesArr))
+	cs := make(chan constructcf.ReadInfo, 60000)
+	done := make(chan int, numCPU)
+	for i := 0; i < numCPU; i++ {
+		go paraColorReads(cs, cf, edgesArr, hits, done)
+	}
+	we := make(chan int, 1)
+	var readsNum int
+	for _, fn := range fnArr {
+		paraLoadNGSReads(fn, cs, kmerlen, we)
+		readsNum += <-we
+	}
+	close(cs)
+	for i := 0; i < numCPU; i++ {
+		<-done
+	}
+
+	for i, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		cov := 0
+		if sn := GetEdgeSampleNum(e, kmerlen, winSize); sn > 0 {
+			cov = int(hits[i]) / sn
+		}
+		if cov > math.MaxUint16 {
+			cov = math.MaxUint16
+		}
+		edgesArr[i].CovD = uint16(cov)
+	}
+	fmt.Printf("[ComputeEdgesCovD] counted reads number: %d\n", readsNum)
+}
+
+// GetCfgNGSReadsFiles return the NGS reads files of the cfg libraries, same as used by ccf
+func GetCfgNGSReadsFiles(cfgFn string, correct bool) (fnArr []string) {
+	cfgInfo, err := constructcf.ParseCfg(cfgFn, correct)
+	if err != nil {
+		log.Fatalf("[GetCfgNGSReadsFiles] ParseCfg 'C': %v err :%v\n", cfgFn, err)
+	}
+	for _, lib := range cfgInfo.Libs {
+		if lib.AsmFlag != constructcf.AllState && lib.SeqProfile != 1 {
+			continue
+		}
+		fnArr = append(fnArr, lib.FnName...)
+	}
+	return
+}
+
+func getNeighborMaxCovD(nd DBGNode, eID DBG_MAX_INT, edgesArr []DBGEdge) (maxCov uint16) {
+	for i := 0; i < bnt.BaseTypeNum; i++ {
+		for _, id := range [2]DBG_MAX_INT{nd.EdgeIDIncoming[i], nd.EdgeIDOutcoming[i]} {
+			if id < 2 || id == eID || edgesArr[id].GetDeleteFlag() > 0 {
+				continue
+			}
+			if edgesArr[id].CovD > maxCov {
+				maxCov = edgesArr[id].CovD
+			}
+		}
+	}
+	return
+}
+
+func deleteEdgeFromNode(nodesArr []DBGNode, nID, eID DBG_MAX_INT) {
+	for i := 0; i < bnt.BaseTypeNum; i++ {
+		if nodesArr[nID].EdgeIDIncoming[i] == eID {
+			nodesArr[nID].EdgeIDIncoming[i] = 0
+		}
+		if nodesArr[nID].EdgeIDOutcoming[i] == eID {
+			nodesArr[nID].EdgeIDOutcoming[i] = 0
+		}
+	}
+}
+
+// RemoveLowCovEdges delete the edges that kmer coverage depth smaller than opt.MinEdgeCov,
+// and the short edges(< opt.MaxNGSReadLen) that coverage depth smaller than
+// opt.CovRatio percent of the neighbor edges, these are mostly erroneous kmer bridge edges.
+// edgesArr[].CovD must be set by ComputeEdgesCovD before call this function
+func RemoveLowCovEdges(nodesArr []DBGNode, edgesArr []DBGEdge, opt Options) (removedArr []LowCovEdgeInfo) {
+	// collect removed edges first, prevent the removed edge effect neighbor judgement
+	for i, e := range edgesArr {
+		if i < 2 || e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		var ncov uint16
+		if e.StartNID > 0 {
+			ncov = getNeighborMaxCovD(nodesArr[e.StartNID], e.ID, edgesArr)
+		}
+		if e.EndNID > 0 {
+			if c := getNeighborMaxCovD(nodesArr[e.EndNID], e.ID, edgesArr); c > ncov {
+				ncov = c
+			}
+		}
+		var r LowCovEdgeInfo
+		if int(e.CovD) < opt.MinEdgeCov {
+			r.Reason = "absolute"
+		} else if len(e.Utg.Ks) < opt.MaxNGSReadLen && int(e.CovD)*100 < int(ncov)*opt.CovRatio {
+			r.Reason = "relative"
+		} else {
+			continue
+		}
+		r.ID, r.StartNID, r.EndNID = e.ID, e.StartNID, e.EndNID
+		r.Len = len(e.Utg.Ks)
+		r.CovD, r.NeighborCovD = e.CovD, ncov
+		removedArr = append(removedArr, r)
+	}
+
+	for _, r := range removedArr {
+		if r.StartNID > 0 {
+			deleteEdgeFromNode(nodesArr, r.StartNID, r.ID)
+		}
+		if r.EndNID > 0 {
+			deleteEdgeFromNode(nodesArr, r.EndNID, r.ID)
+		}
+		edgesArr[r.ID].SetDeleteFlag()
+	}
+
+	return
+}
+
+// ResetDBGEdgesUniqueFlag clean the flags set by SetDBGEdgesUniqueFlag
+func ResetDBGEdgesUniqueFlag(edgesArr []DBGEdge) {
+	for i := range edgesArr {
+		edgesArr[i].ResetUniqueFlag()
+		edgesArr[i].ResetSemiUniqueFlag()
+		edgesArr[i].ResetTwoEdgesCycleFlag()
+	}
+}
+
+// LowCovEdgesWriter write the removed edges report
+func LowCovEdgesWriter(reportfn string, removedArr []LowCovEdgeInfo) {
+	fp, err := os.Create(reportfn)
+	if err != nil {
+		log.Fatalf("[LowCovEdgesWriter] create file: %s failed, err: %v\n", reportfn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriter(fp)
+	fmt.Fprintf(buffp, "#EdgeID\tStartNID\tEndNID\tLen\tCovD\tNeighborCovD\tReason\n")
+	for _, r := range removedArr {
+		fmt.Fprintf(buffp, "%d\t%d\t%d\t%d\t%d\t%d\t%s\n", r.ID, r.StartNID, r.EndNID, r.Len, r.CovD, r.NeighborCovD, r.Reason)
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[LowCovEdgesWriter] write file: %s failed, err: %v\n", reportfn, err)
+	}
+}
+
+// CleanLowCovEdges remove the low coverage edges after SmfyDBG, re-merge the unitigs
+// and reset the unique flag of edges, the coverage counted by an extra pass over the cfg reads
+func CleanLowCovEdges(nodesArr []DBGNode, edgesArr []DBGEdge, opt Options) {
+	fnArr := GetCfgNGSReadsFiles(opt.CfgFn, false)
+	ComputeEdgesCovD(edgesArr, fnArr, opt.Kmer, opt.WinSize, opt.NumCPU)
+	removedArr := RemoveLowCovEdges(nodesArr, edgesArr, opt)
+	fmt.Printf("[CleanLowCovEdges] removed low coverage edges number is : %d\n", len(removedArr))
+	reportfn := opt.Prefix + ".smfy.lowCovEdges"
+	LowCovEdgesWriter(reportfn, removedArr)
+
+	// SmfyDBG set the coverage of merged edges by GetMergedCovD
+	SmfyDBG(nodesArr, edgesArr, opt)
+	MakeSelfCycleEdgeOutcomingToIncoming(nodesArr, edgesArr, opt)
+	ResetDBGEdgesUniqueFlag(edgesArr)
+	uniqueNum, semiUniqueNum, twoEdgeCycleNum, selfCycleNum := SetDBGEdgesUniqueFlag(edgesArr, nodesArr)
+	fmt.Printf("[CleanLowCovEdges] the number of DBG Unique  Edges is : %d\n", uniqueNum)
+	fmt.Printf("[CleanLowCovEdges] the number of DBG Semi-Unique  Edges is : %d\n", semiUniqueNum)
+	fmt.Printf("[CleanLowCovEdges] the number of DBG twoEdgeCycleNum  Edges is : %d\n", twoEdgeCycleNum)
+	fmt.Printf("[CleanLowCovEdges] the number of DBG selfCycleNum  Edges is : %d\n", selfCycleNum)
+}
@@ -0,0 +1,55 @@
+package constructdbg
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mudesheng/ga/cbrotli"
+)
+
+func writeReadsFa(t *testing.T, fn string, reads [][]byte) {
+	fp, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	brfp := cbrotli.NewWriter(fp, cbrotli.WriterOptions{Quality: 1})
+	buffp := bufio.NewWriter(brfp)
+	for i, rd := range reads {
+		fmt.Fprintf(buffp, ">%d\n%s\n", i+1, Transform2Char(rd))
+	}
+	if err := buffp.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := brfp.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestComputeEdgesCovD(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	K := incTestKmerlen
+	edgesArr := make([]DBGEdge, 4)
+	edgesArr[2] = DBGEdge{ID: 2, Utg: Unitig{Ks: randSeq(r, 400)}}
+	edgesArr[3] = DBGEdge{ID: 3, Utg: Unitig{Ks: randSeq(r, 150)}}
+	// edge 2 covered 20 times on both strands, edge 3 once
+	var reads [][]byte
+	for i := 0; i < 10; i++ {
+		reads = append(reads, edgesArr[2].Utg.Ks, GetReverseCompByteArr(edgesArr[2].Utg.Ks))
+	}
+	reads = append(reads, edgesArr[3].Utg.Ks)
+	fn := filepath.Join(t.TempDir(), "t.fa.br")
+	writeReadsFa(t, fn, reads)
+
+	ComputeEdgesCovD(edgesArr, []string{fn}, K, 10, 2)
+	if edgesArr[2].CovD != 20 || edgesArr[3].CovD != 1 {
+		t.Fatalf("CovD of edge 2: %d, want: 20, edge 3: %d, want: 1", edgesArr[2].CovD, edgesArr[3].CovD)
+	}
+	if c := GetMergedCovD(edgesArr[2], edgesArr[3], K); c != uint16((20*(400-K+1)+(150-K+1))/(400+150-2*K+2)) {
+		t.Fatalf("merged CovD: %d", c)
+	}
+}
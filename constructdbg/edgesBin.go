@@ -0,0 +1,348 @@
+package constructdbg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// binary edges file layout(little endian):
+//	header: magic[4] | version uint32 | kmer uint32 | edgesArr size uint32 | edges number uint32 | reserved uint32 | index offset uint64
+//	record: ID, StartNID, EndNID uint32 | CovD uint16 | Flag uint8 | hasQual uint8 | seq length uint32 | path number uint32 |
+//		2-bit packed seq | Kq(if hasQual) | paths(Freq uint32, length uint32, IDArr []uint32)
+//	index: edgesArr size of uint64 record offset, zero denote the edge not in the file
+// cdbg and smfy write '-p.edges.bin' and '-p.edges.smfy.bin' beside the fastq files, the fastq files
+// kept as the export format and loaded only if the binary file not found
+const (
+	EdgesBinMagic      = "GAEB"
+	EdgesBinVersion    = 1
+	edgesBinHeaderSize = 32
+	edgesBinRecordSize = 24
+)
+
+type EdgesBinHeader struct {
+	Version     uint32
+	Kmer        uint32
+	ArrSize     uint32 // length of edgesArr
+	EdgesNum    uint32
+	IndexOffset uint64
+}
+
+// EdgesBinFile support random access of edges by ID
+type EdgesBinFile struct {
+	fp     *os.File
+	Header EdgesBinHeader
+}
+
+func packBnt(ks []byte) []byte {
+	pb := make([]byte, (len(ks)+3)/4)
+	for i, b := range ks {
+		pb[i/4] |= (b & 0x3) << uint(6-2*(i%4))
+	}
+	return pb
+}
+
+func unpackBnt(pb []byte, seqLen int) []byte {
+	ks := make([]byte, seqLen)
+	for i := 0; i < seqLen; i++ {
+		ks[i] = (pb[i/4] >> uint(6-2*(i%4))) & 0x3
+	}
+	return ks
+}
+
+func encodeEdgeRecord(e DBGEdge) []byte {
+	hasQual := len(e.Utg.Kq) == len(e.Utg.Ks) && len(e.Utg.Kq) > 0
+	size := edgesBinRecordSize + (len(e.Utg.Ks)+3)/4
+	if hasQual {
+		size += len(e.Utg.Kq)
+	}
+	for _, p := range e.PathMat {
+		size += 8 + 4*len(p.IDArr)
+	}
+	buf := make([]byte, size)
+	le := binary.LittleEndian
+	le.PutUint32(buf[0:], uint32(e.ID))
+	le.PutUint32(buf[4:], uint32(e.StartNID))
+	le.PutUint32(buf[8:], uint32(e.EndNID))
+	le.PutUint16(buf[12:], e.CovD)
+	buf[14] = e.Flag
+	if hasQual {
+		buf[15] = 1
+	}
+	le.PutUint32(buf[16:], uint32(len(e.Utg.Ks)))
+	le.PutUint32(buf[20:], uint32(len(e.PathMat)))
+	p := edgesBinRecordSize
+	p += copy(buf[p:], packBnt(e.Utg.Ks))
+	if hasQual {
+		p += copy(buf[p:], e.Utg.Kq)
+	}
+	for _, path := range e.PathMat {
+		le.PutUint32(buf[p:], uint32(path.Freq))
+		le.PutUint32(buf[p+4:], uint32(len(path.IDArr)))
+		p += 8
+		for _, id := range path.IDArr {
+			le.PutUint32(buf[p:], uint32(id))
+			p += 4
+		}
+	}
+	return buf
+}
+
+func decodeEdgeRecord(r io.Reader) (e DBGEdge, err error) {
+	var fix [edgesBinRecordSize]byte
+	if _, err = io.ReadFull(r, fix[:]); err != nil {
+		return
+	}
+	le := binary.LittleEndian
+	e.ID = DBG_MAX_INT(le.Uint32(fix[0:]))
+	e.StartNID = DBG_MAX_INT(le.Uint32(fix[4:]))
+	e.EndNID = DBG_MAX_INT(le.Uint32(fix[8:]))
+	e.CovD = le.Uint16(fix[12:])
+	e.Flag = fix[14]
+	hasQual := fix[15] > 0
+	seqLen := int(le.Uint32(fix[16:]))
+	pathNum := int(le.Uint32(fix[20:]))
+	pb := make([]byte, (seqLen+3)/4)
+	if _, err = io.ReadFull(r, pb); err != nil {
+		return
+	}
+	e.Utg.Ks = unpackBnt(pb, seqLen)
+	if hasQual {
+		e.Utg.Kq = make([]uint8, seqLen)
+		if _, err = io.ReadFull(r, e.Utg.Kq); err != nil {
+			return
+		}
+	}
+	if pathNum > 0 {
+		e.PathMat = make([]Path, pathNum)
+	}
+	for i := 0; i < pathNum; i++ {
+		var ph [8]byte
+		if _, err = io.ReadFull(r, ph[:]); err != nil {
+			return
+		}
+		e.PathMat[i].Freq = int(le.Uint32(ph[0:]))
+		ids := make([]byte, 4*le.Uint32(ph[4:]))
+		if _, err = io.ReadFull(r, ids); err != nil {
+			return
+		}
+		e.PathMat[i].IDArr = make([]DBG_MAX_INT, len(ids)/4)
+		for j := range e.PathMat[i].IDArr {
+			e.PathMat[i].IDArr[j] = DBG_MAX_INT(le.Uint32(ids[j*4:]))
+		}
+	}
+	return
+}
+
+// EdgesArrBinWriter write the not deleted edges of edgesArr to the binary edges file
+func EdgesArrBinWriter(edgesArr []DBGEdge, edgesfn string, kmerlen int) {
+	fp, err := os.Create(edgesfn)
+	if err != nil {
+		log.Fatalf("[EdgesArrBinWriter] file %s create error, err: %v\n", edgesfn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriterSize(fp, 1<<20)
+	index := make([]byte, 8*len(edgesArr))
+	offset := uint64(edgesBinHeaderSize)
+	// write a empty header first, rewrite after the index offset known
+	if _, err := buffp.Write(make([]byte, edgesBinHeaderSize)); err != nil {
+		log.Fatalf("[EdgesArrBinWriter] write file: %s err: %v\n", edgesfn, err)
+	}
+	var edgesNum uint32
+	for i, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		rec := encodeEdgeRecord(e)
+		if _, err := buffp.Write(rec); err != nil {
+			log.Fatalf("[EdgesArrBinWriter] write file: %s err: %v\n", edgesfn, err)
+		}
+		binary.LittleEndian.PutUint64(index[8*i:], offset)
+		offset += uint64(len(rec))
+		edgesNum++
+	}
+	if _, err := buffp.Write(index); err != nil {
+		log.Fatalf("[EdgesArrBinWriter] write file: %s err: %v\n", edgesfn, err)
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[EdgesArrBinWriter] write file: %s err: %v\n", edgesfn, err)
+	}
+
+	var header [edgesBinHeaderSize]byte
+	copy(header[:4], EdgesBinMagic)
+	binary.LittleEndian.PutUint32(header[4:], EdgesBinVersion)
+	binary.LittleEndian.PutUint32(header[8:], uint32(kmerlen))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(edgesArr)))
+	binary.LittleEndian.PutUint32(header[16:], edgesNum)
+	binary.LittleEndian.PutUint64(header[24:], offset)
+	if _, err := fp.WriteAt(header[:], 0); err != nil {
+		log.Fatalf("[EdgesArrBinWriter] write header of file: %s err: %v\n", edgesfn, err)
+	}
+}
+
+// OpenEdgesBin open the binary edges file and check the header, kmerlen <= 0 skip the check of K
+func OpenEdgesBin(edgesfn string, kmerlen int) (ebf *EdgesBinFile, err error) {
+	fp, err := os.Open(edgesfn)
+	if err != nil {
+		return nil, err
+	}
+	var header [edgesBinHeaderSize]byte
+	if _, err = io.ReadFull(fp, header[:]); err != nil {
+		fp.Close()
+		return nil, fmt.Errorf("read header of file: %s err: %v", edgesfn, err)
+	}
+	if string(header[:4]) != EdgesBinMagic {
+		fp.Close()
+		return nil, fmt.Errorf("file: %s is not a binary edges file", edgesfn)
+	}
+	ebf = &EdgesBinFile{fp: fp}
+	ebf.Header.Version = binary.LittleEndian.Uint32(header[4:])
+	ebf.Header.Kmer = binary.LittleEndian.Uint32(header[8:])
+	ebf.Header.ArrSize = binary.LittleEndian.Uint32(header[12:])
+	ebf.Header.EdgesNum = binary.LittleEndian.Uint32(header[16:])
+	ebf.Header.IndexOffset = binary.LittleEndian.Uint64(header[24:])
+	if ebf.Header.Version != EdgesBinVersion {
+		fp.Close()
+		return nil, fmt.Errorf("file: %s version: %d not supported, need version: %d", edgesfn, ebf.Header.Version, EdgesBinVersion)
+	}
+	if kmerlen > 0 && int(ebf.Header.Kmer) != kmerlen {
+		fp.Close()
+		return nil, fmt.Errorf("file: %s constructed by K: %d, but K set: %d", edgesfn, ebf.Header.Kmer, kmerlen)
+	}
+	return ebf, nil
+}
+
+func (ebf *EdgesBinFile) getOffset(eID DBG_MAX_INT) (uint64, error) {
+	if uint32(eID) >= ebf.Header.ArrSize {
+		return 0, fmt.Errorf("edge ID: %d >= edgesArr size: %d", eID, ebf.Header.ArrSize)
+	}
+	var b [8]byte
+	if _, err := ebf.fp.ReadAt(b[:], int64(ebf.Header.IndexOffset)+8*int64(eID)); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+// GetEdge read one edge from the file without load the whole file
+func (ebf *EdgesBinFile) GetEdge(eID DBG_MAX_INT) (e DBGEdge, err error) {
+	offset, err := ebf.getOffset(eID)
+	if err != nil {
+		return
+	}
+	if offset == 0 {
+		err = fmt.Errorf("edge ID: %d not in the file", eID)
+		return
+	}
+	sr := io.NewSectionReader(ebf.fp, int64(offset), int64(ebf.Header.IndexOffset-offset))
+	return decodeEdgeRecord(bufio.NewReader(sr))
+}
+
+func (ebf *EdgesBinFile) Close() error {
+	return ebf.fp.Close()
+}
+
+func paraLoadEdgesBin(edgesfn string, offsetArr []uint64, indexOffset uint64, edgesArr []DBGEdge, finishC chan<- int) {
+	fp, err := os.Open(edgesfn)
+	if err != nil {
+		log.Fatalf("[paraLoadEdgesBin] open file %s failed, err: %v\n", edgesfn, err)
+	}
+	defer fp.Close()
+	if len(offsetArr) == 0 {
+		finishC <- 0
+		return
+	}
+	// records of offsetArr are continuous in the file
+	sr := io.NewSectionReader(fp, int64(offsetArr[0]), int64(indexOffset-offsetArr[0]))
+	buffp := bufio.NewReaderSize(sr, 1<<20)
+	for range offsetArr {
+		e, err := decodeEdgeRecord(buffp)
+		if err != nil {
+			log.Fatalf("[paraLoadEdgesBin] decode file: %s err: %v\n", edgesfn, err)
+		}
+		if int(e.ID) >= len(edgesArr) {
+			log.Fatalf("[paraLoadEdgesBin] edge.ID:%v >= len(edgesArr):%d\n", e.ID, len(edgesArr))
+		}
+		edgesArr[e.ID] = e
+	}
+	finishC <- len(offsetArr)
+}
+
+// EdgesArrBinReader load the binary edges file by numCPU goroutines
+func EdgesArrBinReader(edgesfn string, kmerlen, numCPU int) (edgesArr []DBGEdge) {
+	ebf, err := OpenEdgesBin(edgesfn, kmerlen)
+	if err != nil {
+		log.Fatalf("[EdgesArrBinReader] open binary edges file err: %v\n", err)
+	}
+	index := make([]byte, 8*ebf.Header.ArrSize)
+	if _, err := ebf.fp.ReadAt(index, int64(ebf.Header.IndexOffset)); err != nil {
+		log.Fatalf("[EdgesArrBinReader] read index of file: %s err: %v\n", edgesfn, err)
+	}
+	indexOffset := ebf.Header.IndexOffset
+	edgesArr = make([]DBGEdge, ebf.Header.ArrSize)
+	ebf.Close()
+
+	var offsetArr []uint64
+	for i := 0; i < len(edgesArr); i++ {
+		if offset := binary.LittleEndian.Uint64(index[8*i:]); offset > 0 {
+			offsetArr = append(offsetArr, offset)
+		}
+	}
+	if numCPU < 1 {
+		numCPU = 1
+	}
+	// records are written by edge ID order, so the offsets are increasing
+	step := (len(offsetArr) + numCPU - 1) / numCPU
+	finishC := make(chan int, numCPU)
+	for i := 0; i < numCPU; i++ {
+		start, end := i*step, (i+1)*step
+		if start > len(offsetArr) {
+			start = len(offsetArr)
+		}
+		if end > len(offsetArr) {
+			end = len(offsetArr)
+		}
+		go paraLoadEdgesBin(edgesfn, offsetArr[start:end], indexOffset, edgesArr, finishC)
+	}
+	var edgesNum int
+	for i := 0; i < numCPU; i++ {
+		edgesNum += <-finishC
+	}
+	fmt.Printf("[EdgesArrBinReader] found edge number is : %v\n", edgesNum)
+	return
+}
+
+// loadEdgesArrBin load the binary edges file to the edgesArr of edgesArrSize, ok is false if the file not exist
+func loadEdgesArrBin(binfn string, edgesArrSize, kmerlen, numCPU int) (edgesArr []DBGEdge, ok bool) {
+	if _, err := os.Stat(binfn); err != nil {
+		return
+	}
+	edgesArr = EdgesArrBinReader(binfn, kmerlen, numCPU)
+	if len(edgesArr) > edgesArrSize {
+		log.Fatalf("[loadEdgesArrBin] len(edgesArr): %v > edgesArr Size: %v of file: %s\n", len(edgesArr), edgesArrSize, binfn)
+	}
+	if len(edgesArr) < edgesArrSize {
+		edgesArr = append(edgesArr, make([]DBGEdge, edgesArrSize-len(edgesArr))...)
+	}
+	return edgesArr, true
+}
+
+// LoadSmfyEdgesArr load the smfy edges from binary file, if not exist, load from the fastq file
+func LoadSmfyEdgesArr(prefix string, edgesArrSize, kmerlen, numCPU int) (edgesArr []DBGEdge) {
+	if edgesArr, ok := loadEdgesArrBin(prefix+".edges.smfy.bin", edgesArrSize, kmerlen, numCPU); ok {
+		return edgesArr
+	}
+	edgesArr = make([]DBGEdge, edgesArrSize)
+	LoadEdgesfqFromFn(prefix+".edges.smfy.fq", edgesArr, true)
+	return
+}
+
+// LoadCDBGEdgesArr load the cdbg edges from binary file, if not exist, load from the fastq file
+func LoadCDBGEdgesArr(prefix string, edgesArrSize, kmerlen, numCPU int) (edgesArr []DBGEdge) {
+	if edgesArr, ok := loadEdgesArrBin(prefix+".edges.bin", edgesArrSize, kmerlen, numCPU); ok {
+		return edgesArr
+	}
+	return ReadEdgesFromFile(prefix+".edges.fq", DBG_MAX_INT(edgesArrSize))
+}
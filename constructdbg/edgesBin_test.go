@@ -0,0 +1,55 @@
+package constructdbg
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEdgesBinRoundTrip(t *testing.T) {
+	edgesArr := make([]DBGEdge, 6)
+	edgesArr[2] = DBGEdge{ID: 2, StartNID: 1, EndNID: 3, CovD: 17, Flag: 0x4,
+		Utg: Unitig{Ks: []byte{0, 1, 2, 3, 3, 2, 1}, Kq: []uint8{30, 31, 32, 33, 34, 35, 36}}}
+	edgesArr[3] = DBGEdge{ID: 3, StartNID: 3, EndNID: 0,
+		Utg:     Unitig{Ks: []byte{3, 3, 3, 0, 1}},
+		PathMat: []Path{{IDArr: []DBG_MAX_INT{2, 3, 5}, Freq: 4}, {IDArr: []DBG_MAX_INT{3, 5}, Freq: 1}}}
+	edgesArr[4] = DBGEdge{ID: 4, StartNID: 2, EndNID: 4, Utg: Unitig{Ks: []byte{1, 2}}}
+	edgesArr[4].SetDeleteFlag()
+	edgesArr[5] = DBGEdge{ID: 5, StartNID: 4, EndNID: 1, CovD: 3, Utg: Unitig{Ks: []byte{2, 0, 1, 1, 0, 2, 3, 3, 1}}}
+
+	fn := filepath.Join(t.TempDir(), "t.edges.bin")
+	EdgesArrBinWriter(edgesArr, fn, 7)
+	want := make([]DBGEdge, len(edgesArr))
+	copy(want, edgesArr)
+	want[4] = DBGEdge{}
+	for _, numCPU := range []int{1, 2, 8} {
+		got := EdgesArrBinReader(fn, 7, numCPU)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("numCPU: %d, decoded edges:\n%v\nwant:\n%v", numCPU, got, want)
+		}
+	}
+
+	ebf, err := OpenEdgesBin(fn, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ebf.Close()
+	if ebf.Header.ArrSize != uint32(len(edgesArr)) || ebf.Header.EdgesNum != 3 {
+		t.Errorf("header: %+v", ebf.Header)
+	}
+	for _, id := range []DBG_MAX_INT{5, 2, 3} {
+		e, err := ebf.GetEdge(id)
+		if err != nil || !reflect.DeepEqual(e, want[id]) {
+			t.Errorf("GetEdge(%d): %v, err: %v", id, e, err)
+		}
+	}
+	if _, err := ebf.GetEdge(4); err == nil {
+		t.Errorf("GetEdge of deleted edge not return error")
+	}
+	if _, err := ebf.GetEdge(6); err == nil {
+		t.Errorf("GetEdge out of edgesArr not return error")
+	}
+	if _, err := OpenEdgesBin(fn, 9); err == nil {
+		t.Errorf("OpenEdgesBin not check K")
+	}
+}
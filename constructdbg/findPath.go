@@ -2872,20 +2872,40 @@ func FSpath(c cli.Command) {
 		log.Fatalf("[Fpath] argument: 't' set error: %v\n", err)
 	}
 	prefix := c.Parent().Flag("p").String()
-	// read nodes file and transform to array mode, for more quickly access
-	smfyNodesfn := prefix + ".nodes.smfy.mmap"
-	nodeMap := NodeMapMmapReader(smfyNodesfn)
-	DBGStatfn := prefix + ".DBG.stat"
-	nodesSize, edgesSize := DBGStatReader(DBGStatfn)
-	nodesArr := make([]DBGNode, nodesSize)
-	NodeMap2NodeArr(nodeMap, nodesArr)
-	nodeMap = nil
-	// Restore edges info
-	//edgesStatfn := prefix + ".edges.stat"
-	//edgesSize := EdgesStatReader(edgesStatfn)
-	edgesArr := make([]DBGEdge, edgesSize)
-	edgesfn := prefix + ".edges.smfy.fq"
-	LoadEdgesfqFromFn(edgesfn, edgesArr, false)
+	var nodesArr []DBGNode
+	var edgesArr []DBGEdge
+	if c.Flag("PathIndex").Get().(bool) {
+		// the read paths of pp indexed by the DBG of pp, the K not parsed, not check the K
+		idxfn := GetPathIndexFn(prefix)
+		if _, err := os.Stat(idxfn); err != nil {
+			log.Fatalf("[FSpath] read paths index file: %s not found, need run pp with 'PathIndex', err: %v\n", idxfn, err)
+		}
+		fmt.Printf("[FSpath] load the DBG of stage 'pp' and the read paths index: %s\n", idxfn)
+		nodesArr, edgesArr = LoadStageDBG(prefix, "pp", 0, numCPU)
+		pif, err := OpenPathIndex(idxfn, edgesArr, 0)
+		if err != nil {
+			log.Fatalf("[FSpath] open read paths index failed, err: %v\n", err)
+		}
+		SetDBGEdgesUniqueFlag(edgesArr, nodesArr)
+		pathNum := AddPathIndexToDBGEdge(edgesArr, pif)
+		pif.Close()
+		fmt.Printf("[FSpath] add read paths num: %d from file: %s\n", pathNum, idxfn)
+	} else {
+		fmt.Printf("[FSpath] load the DBG of stage 'smfy'\n")
+		// read nodes file and transform to array mode, for more quickly access
+		smfyNodesfn := prefix + ".nodes.smfy.mmap"
+		nodeMap := NodeMapMmapReader(smfyNodesfn)
+		DBGStatfn := prefix + ".DBG.stat"
+		nodesSize, edgesSize := DBGStatReader(DBGStatfn)
+		nodesArr = make([]DBGNode, nodesSize)
+		NodeMap2NodeArr(nodeMap, nodesArr)
+		nodeMap = nil
+		// Restore edges info
+		//edgesStatfn := prefix + ".edges.stat"
+		//edgesSize := EdgesStatReader(edgesStatfn)
+		// the K not parsed, not check the K of binary edges file
+		edgesArr = LoadSmfyEdgesArr(prefix, int(edgesSize), 0, numCPU)
+	}
 
 	//bamfn := prefix + ".bam"
 	//rc := make(chan []sam.Record, numCPU*2)
@@ -2908,11 +2928,11 @@ func FSpath(c cli.Command) {
 	graphfn := prefix + ".ShortPath.dot"
 	GraphvizDBGArr(nodesArr, edgesArr, graphfn)
 	// Write to files
-	edgesfn = prefix + ".edges.ShortPath.fq"
+	edgesfn := prefix + ".edges.ShortPath.fq"
 	//StoreEdgesToFn(edgesfn, edgesArr, true)
 	StoreEdgesToFn(edgesfn, edgesArr)
 	nodesfn := prefix + ".nodes.ShortPath.Arr"
-	NodesArrWriter(nodesArr, nodesfn)
+	NodesArrWriter(nodesArr, nodesfn, Kmerlen)
 }
 
 func Convert2LA(fields []string, RefIDMapArr []DBG_MAX_INT) (la LA) {
@@ -5651,15 +5671,13 @@ func Fpath(c cli.Command) {
 	nodesSize, edgesSize := DBGStatReader(DBGStatfn)
 	nodesArr := make([]DBGNode, nodesSize)
 	smfyNodesfn := prefix + ".nodes.smfy.Arr"
-	nodesArr = NodesArrReader(smfyNodesfn)
+	nodesArr = NodesArrReader(smfyNodesfn, Kmerlen)
 	// NodeMap2NodeArr(nodeMap, nodesArr)
 
 	// Restore edges info
 	//edgesStatfn := prefix + ".edges.stat"
 	//edgesSize := EdgesStatReader(edgesStatfn)
-	edgesArr := make([]DBGEdge, edgesSize)
-	edgesfn := prefix + ".edges.smfy.fq"
-	LoadEdgesfqFromFn(edgesfn, edgesArr, true)
+	edgesArr := LoadSmfyEdgesArr(prefix, int(edgesSize), 0, numCPU)
 
 	// get coverage of smfy edge
 	computeCoverageSmfyEdge(prefix)
@@ -5710,11 +5728,11 @@ func Fpath(c cli.Command) {
 	// graphfn := prefix + ".LongPath.dot"
 	// GraphvizDBG(nodesArr, edgesArr, graphfn)
 	// Write to files
-	edgesfn = prefix + ".edges.LongPath.fq"
+	edgesfn := prefix + ".edges.LongPath.fq"
 	StoreEdgesToFn(edgesfn, edgesArr)
 	// StoreEdgesToFn(edgesfn, edgesArr, false)
 	nodesfn := prefix + ".nodes.LongPath.Arr"
-	NodesArrWriter(nodesArr, nodesfn)
+	NodesArrWriter(nodesArr, nodesfn, Kmerlen)
 	// CleanDBG(edgesArr, nodesArr)
 	// // simplify DBG
 	// // SmfyDBG(edgesArr, nodesArr)
@@ -4,6 +4,6 @@ import (
 	"testing"
 )
 
-func test(t *testing.T) {
+func testFindPath(t *testing.T) {
 
 }
@@ -0,0 +1,114 @@
+package constructdbg
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GAFMissingMapQ is the mapping quality of GAF record not available
+const GAFMissingMapQ = 255
+
+// GAFRecord is an alignment of read to the DBG in the GAF format, the path is the walk of
+// oriented edges, path coordinates are on the walk sequence that neighbour edges overlap
+// kmerlen-1 bases, so the read always align to the '+' strand of path
+type GAFRecord struct {
+	QName              string
+	QLen, QStart, QEnd int
+	EIDArr             []DBG_MAX_INT
+	StrandArr          []bool
+	PLen, PStart, PEnd int
+	Match, BlockLen    int
+	MapQ               int
+	Tags               []string
+}
+
+// GetWalkLen return the sequence length of the edges walk
+func GetWalkLen(eIDArr []DBG_MAX_INT, edgesArr []DBGEdge, kmerlen int) (wl int) {
+	for i, eID := range eIDArr {
+		wl += len(edgesArr[eID].Utg.Ks)
+		if i > 0 {
+			wl -= kmerlen - 1
+		}
+	}
+	return
+}
+
+// GetGAFPath return the path column of GAF, '>' for edge PLUS strand and '<' for MINUS
+func GetGAFPath(eIDArr []DBG_MAX_INT, strandArr []bool) string {
+	var sb strings.Builder
+	for i, eID := range eIDArr {
+		if strandArr[i] == PLUS {
+			sb.WriteByte('>')
+		} else {
+			sb.WriteByte('<')
+		}
+		sb.WriteString(strconv.Itoa(int(eID)))
+	}
+	return sb.String()
+}
+
+func (g GAFRecord) String() string {
+	s := fmt.Sprintf("%s\t%d\t%d\t%d\t+\t%s\t%d\t%d\t%d\t%d\t%d\t%d", g.QName, g.QLen, g.QStart, g.QEnd, GetGAFPath(g.EIDArr, g.StrandArr), g.PLen, g.PStart, g.PEnd, g.Match, g.BlockLen, g.MapQ)
+	if len(g.Tags) > 0 {
+		s += "\t" + strings.Join(g.Tags, "\t")
+	}
+	return s
+}
+
+// GAFRecordsWriter write the records from gc to the GAF file, every producer goroutine send
+// nil at the end, the records number send to done after the file flushed
+func GAFRecordsWriter(gaffn string, gc <-chan []GAFRecord, numCPU int, done chan<- int) {
+	fp, err := os.Create(gaffn)
+	if err != nil {
+		log.Fatalf("[GAFRecordsWriter] create file: %s failed, err: %v\n", gaffn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriterSize(fp, 1<<20)
+	var finishNum, recordNum int
+	for gArr := range gc {
+		if gArr == nil {
+			finishNum++
+			if finishNum == numCPU {
+				break
+			}
+			continue
+		}
+		for _, g := range gArr {
+			fmt.Fprintln(buffp, g.String())
+			recordNum++
+		}
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[GAFRecordsWriter] write file: %s failed, err: %v\n", gaffn, err)
+	}
+	fmt.Printf("[GAFRecordsWriter] write records num: %d to file: %s\n", recordNum, gaffn)
+	done <- recordNum
+}
+
+// GetPathStrand return the strand of edges in the path, the edge path[idx] has the strand,
+// the strand of other edges deduced by the node shared with the neighbour edge
+func GetPathStrand(path []DBG_MAX_INT, idx int, strand bool, edgesArr []DBGEdge) (strandArr []bool) {
+	strandArr = make([]bool, len(path))
+	strandArr[idx] = strand
+	for i := idx + 1; i < len(path); i++ {
+		pe := edgesArr[path[i-1]]
+		nID := pe.EndNID
+		if strandArr[i-1] == MINUS {
+			nID = pe.StartNID
+		}
+		strandArr[i] = edgesArr[path[i]].StartNID == nID
+	}
+	for i := idx - 1; i >= 0; i-- {
+		ne := edgesArr[path[i+1]]
+		nID := ne.StartNID
+		if strandArr[i+1] == MINUS {
+			nID = ne.EndNID
+		}
+		strandArr[i] = edgesArr[path[i]].EndNID == nID
+	}
+	return
+}
@@ -0,0 +1,95 @@
+package constructdbg
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mudesheng/ga/bnt"
+)
+
+// GetEdgeUniqueLabel return the label of unique flags set by SetDBGEdgesUniqueFlag
+func GetEdgeUniqueLabel(e DBGEdge) string {
+	if e.StartNID > 0 && e.StartNID == e.EndNID {
+		return "selfCycle"
+	} else if e.GetTwoEdgesCycleFlag() > 0 {
+		return "twoEdgesCycle"
+	} else if e.GetUniqueFlag() > 0 {
+		return "unique"
+	} else if e.GetSemiUniqueFlag() > 0 {
+		return "semiUnique"
+	}
+	return "repeat"
+}
+
+// get the strand of edge that link to the node, incoming edge must end with the node kmer,
+// outcoming edge must start with the node kmer
+func getLinkStrand(e DBGEdge, nID DBG_MAX_INT, coming bool) string {
+	if coming {
+		if e.EndNID == nID {
+			return "+"
+		}
+	} else {
+		if e.StartNID == nID {
+			return "+"
+		}
+	}
+	return "-"
+}
+
+// GFAWriter write edges as segments and the links of nodes to the GFA(v1) file,
+// if edgeSet != nil, only the edges that edgeSet[ID] == true will be written,
+// if dc != nil, the samples of edge written to the segment tag "cl", the tag "DP" is the
+// DBGEdge.CovD, not written if zero(the coverage not counted by the stage)
+func GFAWriter(nodesArr []DBGNode, edgesArr []DBGEdge, edgeSet []bool, dc *DBGColors, gfafn string, kmerlen int) {
+	fp, err := os.Create(gfafn)
+	if err != nil {
+		log.Fatalf("[GFAWriter] create file: %s failed, err: %v\n", gfafn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriter(fp)
+	inSet := func(eID DBG_MAX_INT) bool {
+		if eID < 2 || edgesArr[eID].GetDeleteFlag() > 0 {
+			return false
+		}
+		return edgeSet == nil || edgeSet[eID]
+	}
+
+	fmt.Fprintf(buffp, "H\tVN:Z:1.0\tKM:i:%d\n", kmerlen)
+	for _, e := range edgesArr {
+		if !inSet(e.ID) {
+			continue
+		}
+		fmt.Fprintf(buffp, "S\t%d\t%s\tLN:i:%d", e.ID, Transform2Char(e.Utg.Ks), len(e.Utg.Ks))
+		if e.CovD > 0 {
+			fmt.Fprintf(buffp, "\tDP:f:%.1f", float64(e.CovD))
+		}
+		fmt.Fprintf(buffp, "\tfl:Z:%s", GetEdgeUniqueLabel(e))
+		if dc != nil {
+			fmt.Fprintf(buffp, "\tcl:Z:%s", dc.GetColorLabel(e.ID))
+		}
+		fmt.Fprintf(buffp, "\n")
+	}
+	for _, nd := range nodesArr {
+		if nd.ID < 2 || nd.GetDeleteFlag() > 0 {
+			continue
+		}
+		for i := 0; i < bnt.BaseTypeNum; i++ {
+			inID := nd.EdgeIDIncoming[i]
+			if !inSet(inID) {
+				continue
+			}
+			for j := 0; j < bnt.BaseTypeNum; j++ {
+				outID := nd.EdgeIDOutcoming[j]
+				if !inSet(outID) {
+					continue
+				}
+				fmt.Fprintf(buffp, "L\t%d\t%s\t%d\t%s\t%dM\n", inID, getLinkStrand(edgesArr[inID], nd.ID, true), outID, getLinkStrand(edgesArr[outID], nd.ID, false), kmerlen-1)
+			}
+		}
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[GFAWriter] write file: %s failed, err: %v\n", gfafn, err)
+	}
+}
@@ -0,0 +1,262 @@
+package constructdbg
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/jwaldrip/odin/cli"
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/utils"
+)
+
+// CovDBinBounds is the lower bound of edge coverage depth distribution bins
+var CovDBinBounds = []int{0, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+type DBGStats struct {
+	Stage            string                                        `json:"stage"`
+	Kmer             int                                           `json:"kmer"`
+	NodesNum         int                                           `json:"nodesNum"`
+	EdgesNum         int                                           `json:"edgesNum"`
+	TotalLen         int64                                         `json:"totalLen"`
+	MaxLen           int                                           `json:"maxLen"`
+	N50              int                                           `json:"N50"`
+	N90              int                                           `json:"N90"`
+	UniqueNum        int                                           `json:"uniqueNum"`
+	SemiUniqueNum    int                                           `json:"semiUniqueNum"`
+	TwoEdgeCycleNum  int                                           `json:"twoEdgeCycleNum"`
+	SelfCycleNum     int                                           `json:"selfCycleNum"`
+	TipsNum          int                                           `json:"tipsNum"`
+	ComponentsNum    int                                           `json:"componentsNum"`
+	MaxComponentLen  int64                                         `json:"maxComponentLen"`
+	Degree           [bnt.BaseTypeNum + 1][bnt.BaseTypeNum + 1]int `json:"degree"`             // Degree[inNum][outNum] = number of nodes
+	MeanCovD         float64                                       `json:"meanCovD,omitempty"` // weighted by edge length
+	CovDBinBounds    []int                                         `json:"covDBinBounds,omitempty"`
+	CovDDistribution []int                                         `json:"covDDistribution,omitempty"` // number of edges in every CovDBinBounds bin
+}
+
+// LoadStageDBG load the nodes and edges files written by stage "cdbg", "smfy" or "pp"
+func LoadStageDBG(prefix, stage string, kmerlen, numCPU int) (nodesArr []DBGNode, edgesArr []DBGEdge) {
+	switch stage {
+	case "cdbg":
+		nodesArr = NodesArrReader(prefix+".nodes.mmap", kmerlen)
+		_, edgesSize := DBGStatReader(prefix + ".DBG.stat")
+		edgesArr = LoadCDBGEdgesArr(prefix, int(edgesSize), kmerlen, numCPU)
+	case "smfy":
+		eSize, nSize := DBGInfoReader(prefix + ".smfy.DBGInfo")
+		nodesArr = NodesArrReader(prefix+".nodes.smfy.Arr", kmerlen)
+		if len(nodesArr) != nSize {
+			log.Fatalf("[LoadStageDBG] len(nodesArr): %v != nodesArr Size: %v in file: %v\n", len(nodesArr), nSize, prefix+".smfy.DBGInfo")
+		}
+		edgesArr = LoadSmfyEdgesArr(prefix, eSize, kmerlen, numCPU)
+	case "pp":
+		eSize, nSize := DBGInfoReader(prefix + ".pp.DBGInfo")
+		nodesArr = NodesArrReader(prefix+".nodes.pp.Arr", kmerlen)
+		if len(nodesArr) != nSize {
+			log.Fatalf("[LoadStageDBG] len(nodesArr): %v != nodesArr Size: %v in file: %v\n", len(nodesArr), nSize, prefix+".pp.DBGInfo")
+		}
+		var ok bool
+		if edgesArr, ok = loadEdgesArrBin(prefix+".edges.pp.bin", eSize, kmerlen, numCPU); !ok {
+			log.Fatalf("[LoadStageDBG] not found the edges file: %v\n", prefix+".edges.pp.bin")
+		}
+	default:
+		log.Fatalf("[LoadStageDBG] not support stage: %v, must be 'cdbg', 'smfy' or 'pp'\n", stage)
+	}
+	return
+}
+
+// LabelEdgesComponent return the connected component ID of every edge, component ID start from 1,
+// zero denote deleted or not used edge
+func LabelEdgesComponent(nodesArr []DBGNode, edgesArr []DBGEdge) (compArr []int, compNum int) {
+	compArr = make([]int, len(edgesArr))
+	var stack []DBG_MAX_INT
+	for i, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 || compArr[i] > 0 {
+			continue
+		}
+		compNum++
+		compArr[i] = compNum
+		stack = append(stack[:0], e.ID)
+		for len(stack) > 0 {
+			eID := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, nID := range [2]DBG_MAX_INT{edgesArr[eID].StartNID, edgesArr[eID].EndNID} {
+				if nID < 2 || int(nID) >= len(nodesArr) {
+					continue
+				}
+				nd := nodesArr[nID]
+				for j := 0; j < bnt.BaseTypeNum; j++ {
+					for _, id := range [2]DBG_MAX_INT{nd.EdgeIDIncoming[j], nd.EdgeIDOutcoming[j]} {
+						if id < 2 || edgesArr[id].GetDeleteFlag() > 0 || compArr[id] > 0 {
+							continue
+						}
+						compArr[id] = compNum
+						stack = append(stack, id)
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+func getNx(lenArr []int, total int64, x int) int {
+	var sum int64
+	for _, l := range lenArr {
+		sum += int64(l)
+		if sum*100 >= total*int64(x) {
+			return l
+		}
+	}
+	return 0
+}
+
+// GetDBGStats compute the statistics of DBG, the unique flags of edges will be reset,
+// the coverage statistics only if cov, DBGEdge.CovD must be set by ComputeEdgesCovD before
+func GetDBGStats(nodesArr []DBGNode, edgesArr []DBGEdge, cov bool) (st DBGStats) {
+	var lenArr []int
+	var covSum float64
+	if cov {
+		st.CovDBinBounds = CovDBinBounds
+		st.CovDDistribution = make([]int, len(CovDBinBounds))
+	}
+	for _, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		el := len(e.Utg.Ks)
+		st.EdgesNum++
+		st.TotalLen += int64(el)
+		lenArr = append(lenArr, el)
+		covSum += float64(e.CovD) * float64(el)
+		if e.StartNID == 0 || e.EndNID == 0 {
+			st.TipsNum++
+		}
+		if cov {
+			b := sort.SearchInts(CovDBinBounds, int(e.CovD)+1) - 1
+			st.CovDDistribution[b]++
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(lenArr)))
+	if len(lenArr) > 0 {
+		st.MaxLen = lenArr[0]
+		st.N50 = getNx(lenArr, st.TotalLen, 50)
+		st.N90 = getNx(lenArr, st.TotalLen, 90)
+		if cov {
+			st.MeanCovD = covSum / float64(st.TotalLen)
+		}
+	}
+
+	for _, nd := range nodesArr {
+		if nd.ID < 2 || nd.GetDeleteFlag() > 0 {
+			continue
+		}
+		inNum, _ := GetEdgeIDComing(nd.EdgeIDIncoming)
+		outNum, _ := GetEdgeIDComing(nd.EdgeIDOutcoming)
+		if inNum == 0 && outNum == 0 {
+			continue
+		}
+		st.NodesNum++
+		st.Degree[inNum][outNum]++
+	}
+
+	ResetDBGEdgesUniqueFlag(edgesArr)
+	st.UniqueNum, st.SemiUniqueNum, st.TwoEdgeCycleNum, st.SelfCycleNum = SetDBGEdgesUniqueFlag(edgesArr, nodesArr)
+
+	compArr, compNum := LabelEdgesComponent(nodesArr, edgesArr)
+	st.ComponentsNum = compNum
+	compLenArr := make([]int64, compNum+1)
+	for i, c := range compArr {
+		if c > 0 {
+			compLenArr[c] += int64(len(edgesArr[i].Utg.Ks))
+		}
+	}
+	for _, l := range compLenArr {
+		if l > st.MaxComponentLen {
+			st.MaxComponentLen = l
+		}
+	}
+
+	return
+}
+
+// DBGStatsWriter write stats as JSON to jsonfn and as "item\tvalue" lines to tsvfn
+func DBGStatsWriter(st DBGStats, jsonfn, tsvfn string) {
+	jsonfp, err := os.Create(jsonfn)
+	if err != nil {
+		log.Fatalf("[DBGStatsWriter] create file: %s failed, err: %v\n", jsonfn, err)
+	}
+	defer jsonfp.Close()
+	enc := json.NewEncoder(jsonfp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(st); err != nil {
+		log.Fatalf("[DBGStatsWriter] encode json file: %s failed, err: %v\n", jsonfn, err)
+	}
+
+	tsvfp, err := os.Create(tsvfn)
+	if err != nil {
+		log.Fatalf("[DBGStatsWriter] create file: %s failed, err: %v\n", tsvfn, err)
+	}
+	defer tsvfp.Close()
+	buffp := bufio.NewWriter(tsvfp)
+	fmt.Fprintf(buffp, "stage\t%s\n", st.Stage)
+	fmt.Fprintf(buffp, "kmer\t%d\n", st.Kmer)
+	fmt.Fprintf(buffp, "nodesNum\t%d\n", st.NodesNum)
+	fmt.Fprintf(buffp, "edgesNum\t%d\n", st.EdgesNum)
+	fmt.Fprintf(buffp, "totalLen\t%d\n", st.TotalLen)
+	fmt.Fprintf(buffp, "maxLen\t%d\n", st.MaxLen)
+	fmt.Fprintf(buffp, "N50\t%d\n", st.N50)
+	fmt.Fprintf(buffp, "N90\t%d\n", st.N90)
+	fmt.Fprintf(buffp, "uniqueNum\t%d\n", st.UniqueNum)
+	fmt.Fprintf(buffp, "semiUniqueNum\t%d\n", st.SemiUniqueNum)
+	fmt.Fprintf(buffp, "twoEdgeCycleNum\t%d\n", st.TwoEdgeCycleNum)
+	fmt.Fprintf(buffp, "selfCycleNum\t%d\n", st.SelfCycleNum)
+	fmt.Fprintf(buffp, "tipsNum\t%d\n", st.TipsNum)
+	fmt.Fprintf(buffp, "componentsNum\t%d\n", st.ComponentsNum)
+	fmt.Fprintf(buffp, "maxComponentLen\t%d\n", st.MaxComponentLen)
+	for i := range st.Degree {
+		for j := range st.Degree[i] {
+			if st.Degree[i][j] > 0 {
+				fmt.Fprintf(buffp, "degree_in%d_out%d\t%d\n", i, j, st.Degree[i][j])
+			}
+		}
+	}
+	if len(st.CovDDistribution) > 0 {
+		fmt.Fprintf(buffp, "meanCovD\t%.2f\n", st.MeanCovD)
+		for i, b := range st.CovDBinBounds {
+			fmt.Fprintf(buffp, "covD_%d\t%d\n", b, st.CovDDistribution[i])
+		}
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[DBGStatsWriter] write file: %s failed, err: %v\n", tsvfn, err)
+	}
+}
+
+func GraphStats(c cli.Command) {
+	opt, suc := utils.CheckGlobalArgs(c.Parent())
+	if suc == false {
+		log.Fatalf("[GraphStats] check global Arguments error, opt: %v\n", opt)
+	}
+	stage := c.Flag("stage").String()
+	nodesArr, edgesArr := LoadStageDBG(opt.Prefix, stage, opt.Kmer, opt.NumCPU)
+	cov := c.Flag("Cov").Get().(bool)
+	if cov {
+		winSize := c.Flag("WinSize").Get().(int)
+		if winSize < 1 {
+			log.Fatalf("[GraphStats] argument 'WinSize': %v must bigger than 0\n", winSize)
+		}
+		ComputeEdgesCovD(edgesArr, GetCfgNGSReadsFiles(opt.CfgFn, false), opt.Kmer, winSize, opt.NumCPU)
+	}
+	st := GetDBGStats(nodesArr, edgesArr, cov)
+	st.Stage = stage
+	st.Kmer = opt.Kmer
+
+	jsonfn := opt.Prefix + "." + stage + ".graphstats.json"
+	tsvfn := opt.Prefix + "." + stage + ".graphstats.tsv"
+	DBGStatsWriter(st, jsonfn, tsvfn)
+	fmt.Printf("[GraphStats] stage: %s, edges: %d, total length: %d, N50: %d, N90: %d, components: %d\n", stage, st.EdgesNum, st.TotalLen, st.N50, st.N90, st.ComponentsNum)
+	fmt.Printf("[GraphStats] unique: %d, semi-unique: %d, twoEdgeCycle: %d, selfCycle: %d\n", st.UniqueNum, st.SemiUniqueNum, st.TwoEdgeCycleNum, st.SelfCycleNum)
+}
@@ -0,0 +1,282 @@
+package constructdbg
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jwaldrip/odin/cli"
+	"github.com/mudesheng/ga/utils"
+)
+
+type viewEdge struct {
+	ID       DBG_MAX_INT `json:"id"`
+	StartNID DBG_MAX_INT `json:"s"`
+	EndNID   DBG_MAX_INT `json:"e"`
+	Len      int         `json:"len"`
+	CovD     uint16      `json:"cov"`
+	Flag     string      `json:"flag"`
+	PathMat  []Path      `json:"paths,omitempty"`
+}
+
+type viewGraph struct {
+	Kmer  int        `json:"kmer"`
+	Stage string     `json:"stage"`
+	Edges []viewEdge `json:"edges"`
+}
+
+// HTMLViewWriter write a self-contained html file, the edges of edgeSet(all edges if edgeSet == nil)
+// embedded as JSON and drawn by the inline javascript
+func HTMLViewWriter(edgesArr []DBGEdge, edgeSet []bool, htmlfn, stage string, kmerlen int) {
+	var vg viewGraph
+	vg.Kmer, vg.Stage = kmerlen, stage
+	vg.Edges = make([]viewEdge, 0)
+	for i, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 || (edgeSet != nil && !edgeSet[i]) {
+			continue
+		}
+		ve := viewEdge{e.ID, e.StartNID, e.EndNID, len(e.Utg.Ks), e.CovD, GetEdgeUniqueLabel(e), e.PathMat}
+		vg.Edges = append(vg.Edges, ve)
+	}
+	// json.Marshal escape '<' and '>', so the data is safe in the <script> element
+	data, err := json.Marshal(vg)
+	if err != nil {
+		log.Fatalf("[HTMLViewWriter] encode graph to json err: %v\n", err)
+	}
+	fp, err := os.Create(htmlfn)
+	if err != nil {
+		log.Fatalf("[HTMLViewWriter] create file: %s failed, err: %v\n", htmlfn, err)
+	}
+	defer fp.Close()
+	html := strings.Replace(htmlViewTemplate, "/*GRAPH_JSON*/", string(data), 1)
+	if _, err := fp.WriteString(html); err != nil {
+		log.Fatalf("[HTMLViewWriter] write file: %s failed, err: %v\n", htmlfn, err)
+	}
+}
+
+func HTMLView(c cli.Command) {
+	opt, suc := utils.CheckGlobalArgs(c.Parent())
+	if suc == false {
+		log.Fatalf("[HTMLView] check global Arguments error, opt: %v\n", opt)
+	}
+	stage := c.Flag("stage").String()
+	nodesArr, edgesArr := LoadStageDBG(opt.Prefix, stage, opt.Kmer, opt.NumCPU)
+	ResetDBGEdgesUniqueFlag(edgesArr)
+	SetDBGEdgesUniqueFlag(edgesArr, nodesArr)
+
+	var edgeSet []bool
+	htmlfn := opt.Prefix + "." + stage + ".view.html"
+	if es := c.Flag("e").String(); es != "" {
+		seedArr := AtoiArr(strings.Split(es, ","))
+		radius, bpMode, err := parseRadius(c.Flag("r").String())
+		if err != nil {
+			log.Fatalf("[HTMLView] argument 'r': %v set error, err: %v\n", c.Flag("r").String(), err)
+		}
+		edgeSet = ExtractSubGraph(nodesArr, edgesArr, seedArr, radius, bpMode, opt.Kmer)
+		htmlfn = opt.Prefix + "." + stage + ".subgraph.view.html"
+	}
+	HTMLViewWriter(edgesArr, edgeSet, htmlfn, stage, opt.Kmer)
+	fmt.Printf("[HTMLView] write graph view to file: %s\n", htmlfn)
+}
+
+const htmlViewTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>GA DBG view</title>
+<style>
+body { margin: 0; font-family: sans-serif; font-size: 13px; overflow: hidden; }
+#bar { position: absolute; top: 0; left: 0; right: 0; height: 32px; padding: 4px 8px; background: #eee; border-bottom: 1px solid #ccc; }
+#bar input, #bar select { margin-right: 10px; }
+#info { position: absolute; top: 42px; right: 8px; width: 300px; max-height: 80%; overflow: auto; background: #fff; border: 1px solid #ccc; padding: 6px; display: none; white-space: pre-wrap; font-family: monospace; }
+canvas { position: absolute; top: 41px; left: 0; }
+</style>
+</head>
+<body>
+<div id="bar">
+<span id="title"></span>
+edge ID: <input id="search" size="10"> <button id="go">find</button>
+color by: <select id="color"><option value="flag">unique flag</option><option value="cov">coverage</option></select>
+<button id="fit">fit</button>
+<span id="legend"></span>
+</div>
+<canvas id="cv"></canvas>
+<div id="info"></div>
+<script>
+var G = /*GRAPH_JSON*/;
+(function() {
+	var cv = document.getElementById("cv"), ctx = cv.getContext("2d");
+	var info = document.getElementById("info");
+	var flagColor = {unique: "#d62728", semiUnique: "#ff7f0e", twoEdgesCycle: "#2ca02c", selfCycle: "#9467bd", repeat: "#1f77b4"};
+	document.getElementById("title").textContent = G.stage + " K=" + G.kmer + " edges=" + G.edges.length + " ";
+
+	// the layout vertices are the DBG nodes, tips end at their own vertex
+	var vmap = {}, verts = [], links = [];
+	function vert(key) {
+		if (!(key in vmap)) {
+			vmap[key] = verts.length;
+			verts.push({x: Math.random() * 1000, y: Math.random() * 1000, dx: 0, dy: 0});
+		}
+		return vmap[key];
+	}
+	var maxCov = 1;
+	G.edges.forEach(function(e) {
+		var a = vert(e.s > 0 ? "n" + e.s : "ts" + e.id);
+		var b = vert(e.e > 0 ? "n" + e.e : "te" + e.id);
+		links.push({a: a, b: b, e: e, len: 20 + 10 * Math.log(e.len + 1)});
+		if (e.cov > maxCov) { maxCov = e.cov; }
+	});
+
+	// force directed layout, repulsion is computed in the grid cells nearby
+	var iter = 0, maxIter = 300;
+	function layoutStep() {
+		var cell = 60, grid = {};
+		verts.forEach(function(v, i) {
+			var k = Math.floor(v.x / cell) + "," + Math.floor(v.y / cell);
+			(grid[k] = grid[k] || []).push(i);
+			v.dx = 0; v.dy = 0;
+		});
+		verts.forEach(function(v, i) {
+			var gx = Math.floor(v.x / cell), gy = Math.floor(v.y / cell);
+			for (var x = gx - 1; x <= gx + 1; x++) {
+				for (var y = gy - 1; y <= gy + 1; y++) {
+					(grid[x + "," + y] || []).forEach(function(j) {
+						if (j === i) { return; }
+						var u = verts[j], ddx = v.x - u.x, ddy = v.y - u.y;
+						var d2 = ddx * ddx + ddy * ddy + 0.01;
+						v.dx += ddx * 400 / d2; v.dy += ddy * 400 / d2;
+					});
+				}
+			}
+		});
+		links.forEach(function(l) {
+			var v = verts[l.a], u = verts[l.b];
+			var ddx = u.x - v.x, ddy = u.y - v.y, d = Math.sqrt(ddx * ddx + ddy * ddy) + 0.01;
+			var f = (d - l.len) / d * 0.1;
+			v.dx += ddx * f; v.dy += ddy * f; u.dx -= ddx * f; u.dy -= ddy * f;
+		});
+		var t = 10 * (1 - iter / maxIter);
+		verts.forEach(function(v) {
+			var d = Math.sqrt(v.dx * v.dx + v.dy * v.dy) + 0.01;
+			v.x += v.dx / d * Math.min(d, t); v.y += v.dy / d * Math.min(d, t);
+		});
+		iter++;
+	}
+
+	// pan and zoom
+	var scale = 1, ox = 0, oy = 0, drag = null, selected = null, userView = false;
+	function resize() { cv.width = window.innerWidth; cv.height = window.innerHeight - 41; draw(); }
+	function fit() {
+		if (verts.length === 0) { return; }
+		var x0 = Infinity, y0 = Infinity, x1 = -Infinity, y1 = -Infinity;
+		verts.forEach(function(v) { x0 = Math.min(x0, v.x); y0 = Math.min(y0, v.y); x1 = Math.max(x1, v.x); y1 = Math.max(y1, v.y); });
+		scale = Math.min(cv.width / (x1 - x0 + 40), cv.height / (y1 - y0 + 40));
+		ox = -x0 * scale + 20; oy = -y0 * scale + 20;
+		draw();
+	}
+	function covColor(c) {
+		var r = Math.log(c + 1) / Math.log(maxCov + 1);
+		return "rgb(" + Math.round(255 * r) + ",0," + Math.round(255 * (1 - r)) + ")";
+	}
+	function draw() {
+		var mode = document.getElementById("color").value;
+		ctx.setTransform(1, 0, 0, 1, 0, 0);
+		ctx.clearRect(0, 0, cv.width, cv.height);
+		ctx.setTransform(scale, 0, 0, scale, ox, oy);
+		links.forEach(function(l) {
+			var v = verts[l.a], u = verts[l.b];
+			ctx.strokeStyle = mode === "cov" ? covColor(l.e.cov) : flagColor[l.e.flag];
+			ctx.lineWidth = (l === selected ? 5 : 1.5) / scale;
+			ctx.beginPath();
+			if (l.a === l.b) {
+				ctx.arc(v.x + 10, v.y, 10, 0, 2 * Math.PI);
+			} else {
+				ctx.moveTo(v.x, v.y); ctx.lineTo(u.x, u.y);
+				var ang = Math.atan2(u.y - v.y, u.x - v.x), mx = (v.x + u.x) / 2, my = (v.y + u.y) / 2, h = 6 / scale;
+				ctx.moveTo(mx, my); ctx.lineTo(mx - h * Math.cos(ang - 0.4), my - h * Math.sin(ang - 0.4));
+				ctx.moveTo(mx, my); ctx.lineTo(mx - h * Math.cos(ang + 0.4), my - h * Math.sin(ang + 0.4));
+			}
+			ctx.stroke();
+		});
+		ctx.fillStyle = "#555";
+		verts.forEach(function(v) { ctx.fillRect(v.x - 1.5 / scale, v.y - 1.5 / scale, 3 / scale, 3 / scale); });
+		var lg = "";
+		if (mode === "cov") {
+			lg = "coverage: <span style='color:" + covColor(0) + "'>0</span> ~ <span style='color:" + covColor(maxCov) + "'>" + maxCov + "</span>";
+		} else {
+			for (var k in flagColor) { lg += "<span style='color:" + flagColor[k] + "'>" + k + "</span> "; }
+		}
+		document.getElementById("legend").innerHTML = lg;
+	}
+	function showInfo(l) {
+		selected = l;
+		if (l === null) { info.style.display = "none"; draw(); return; }
+		var e = l.e, s = "edge ID: " + e.id + "\nlength: " + e.len + "\nStartNID: " + e.s + "\nEndNID: " + e.e +
+			"\ncoverage: " + e.cov + "\nflag: " + e.flag + "\nPathMat:";
+		(e.paths || []).forEach(function(p) { s += "\n  " + (p.IDArr || []).join("-") + " freq:" + p.Freq; });
+		info.textContent = s;
+		info.style.display = "block";
+		draw();
+	}
+	function pick(px, py) {
+		var x = (px - ox) / scale, y = (py - oy) / scale, best = null, bd = 8 / scale;
+		links.forEach(function(l) {
+			var v = verts[l.a], u = verts[l.b], ddx = u.x - v.x, ddy = u.y - v.y;
+			var t = ((x - v.x) * ddx + (y - v.y) * ddy) / (ddx * ddx + ddy * ddy + 1e-9);
+			t = Math.max(0, Math.min(1, t));
+			var d = Math.hypot(v.x + t * ddx - x, v.y + t * ddy - y);
+			if (d < bd) { bd = d; best = l; }
+		});
+		return best;
+	}
+	var moved = false;
+	cv.addEventListener("mousedown", function(ev) { drag = {x: ev.clientX, y: ev.clientY}; moved = false; });
+	window.addEventListener("mouseup", function(ev) {
+		if (drag && !moved) { showInfo(pick(ev.offsetX, ev.offsetY)); }
+		drag = null;
+	});
+	cv.addEventListener("mousemove", function(ev) {
+		if (!drag) { return; }
+		ox += ev.clientX - drag.x; oy += ev.clientY - drag.y;
+		if (Math.abs(ev.clientX - drag.x) + Math.abs(ev.clientY - drag.y) > 0) { moved = true; userView = true; }
+		drag = {x: ev.clientX, y: ev.clientY};
+		draw();
+	});
+	cv.addEventListener("wheel", function(ev) {
+		ev.preventDefault();
+		var f = ev.deltaY < 0 ? 1.2 : 1 / 1.2;
+		ox = ev.offsetX - (ev.offsetX - ox) * f; oy = ev.offsetY - (ev.offsetY - oy) * f;
+		scale *= f;
+		userView = true;
+		draw();
+	});
+	function find() {
+		var id = parseInt(document.getElementById("search").value, 10);
+		var l = links.find(function(l) { return l.e.id === id; });
+		if (!l) { alert("edge ID: " + id + " not found"); return; }
+		var v = verts[l.a], u = verts[l.b];
+		ox = cv.width / 2 - (v.x + u.x) / 2 * scale; oy = cv.height / 2 - (v.y + u.y) / 2 * scale;
+		userView = true;
+		showInfo(l);
+	}
+	document.getElementById("go").addEventListener("click", find);
+	document.getElementById("search").addEventListener("keydown", function(ev) { if (ev.key === "Enter") { find(); } });
+	document.getElementById("color").addEventListener("change", draw);
+	document.getElementById("fit").addEventListener("click", fit);
+	window.addEventListener("resize", resize);
+
+	resize();
+	function animate() {
+		for (var i = 0; i < 5 && iter < maxIter; i++) { layoutStep(); }
+		// follow the layout until the user pan or zoom the view
+		if (userView) { draw(); } else { fit(); }
+		if (iter < maxIter) { requestAnimationFrame(animate); }
+	}
+	animate();
+})();
+</script>
+</body>
+</html>
+`
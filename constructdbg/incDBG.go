@@ -0,0 +1,393 @@
+package constructdbg
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jwaldrip/odin/cli"
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/cuckoofilter"
+	"github.com/mudesheng/ga/utils"
+)
+
+func getNodeKey(kb, rb constructcf.KmerBnt) (key [NODEMAP_KEY_LEN]uint64) {
+	if kb.BiggerThan(rb) {
+		copy(key[:], rb.Seq)
+	} else {
+		copy(key[:], kb.Seq)
+	}
+	return
+}
+
+// GetKmersNodeSet return the set of canonical (K-1)-mers at the both ends of the kmers
+func GetKmersNodeSet(kmerArr []constructcf.KmerBnt, kmerlen int) (nodeSet map[[NODEMAP_KEY_LEN]uint64]bool) {
+	nodeSet = make(map[[NODEMAP_KEY_LEN]uint64]bool, len(kmerArr)*2)
+	for _, kb := range kmerArr {
+		seq := constructcf.ExtendKmerBnt2Byte(kb)
+		for _, pos := range [2]int{0, 1} {
+			nkb := constructcf.GetReadBntKmer(seq, pos, kmerlen-1)
+			nodeSet[getNodeKey(nkb, constructcf.ReverseComplet(nkb))] = true
+		}
+	}
+	return
+}
+
+// an edge will be changed if any inner (K-1)-mer of the edge found in the nodeSet,
+// the (K-1)-mer of the end linked a DBG node not need to check, but the end of tip need
+func paraMarkChangedEdges(edgesArr []DBGEdge, nodeSet map[[NODEMAP_KEY_LEN]uint64]bool, kmerlen, start, step int, changed []bool, finishC chan<- int) {
+	nl := kmerlen - 1
+	var kb1, kb2, rb1, rb2, tb constructcf.KmerBnt
+	kb1.Seq = make([]uint64, (nl+bnt.NumBaseInUint64-1)/bnt.NumBaseInUint64)
+	kb2.Seq = make([]uint64, (nl+bnt.NumBaseInUint64-1)/bnt.NumBaseInUint64)
+	rb1.Seq = make([]uint64, (nl+bnt.NumBaseInUint64-1)/bnt.NumBaseInUint64)
+	rb2.Seq = make([]uint64, (nl+bnt.NumBaseInUint64-1)/bnt.NumBaseInUint64)
+	tb.Seq = make([]uint64, (nl+bnt.NumBaseInUint64-1)/bnt.NumBaseInUint64)
+	for i := start; i < len(edgesArr); i += step {
+		e := edgesArr[i]
+		if e.ID < 2 || e.GetDeleteFlag() > 0 || len(e.Utg.Ks) < kmerlen {
+			continue
+		}
+		kb1 = constructcf.NoAllocGetReadBntKmer(e.Utg.Ks, 0, nl, kb1)
+		rb1 = constructcf.NoAllocReverseComplet(kb1, rb1, tb)
+		if e.StartNID == 0 && nodeSet[getNodeKey(kb1, rb1)] {
+			changed[i] = true
+			continue
+		}
+		for j := nl; j < len(e.Utg.Ks); j++ {
+			kb2 = constructcf.NoAllocGetNextKmer(kb1, kb2, uint64(e.Utg.Ks[j]), nl)
+			rb2 = constructcf.NoAllocGetPreviousKmer(rb1, rb2, uint64(bnt.BntRev[e.Utg.Ks[j]]), nl)
+			if (j < len(e.Utg.Ks)-1 || e.EndNID == 0) && nodeSet[getNodeKey(kb2, rb2)] {
+				changed[i] = true
+				break
+			}
+			kb1, kb2 = kb2, kb1
+			rb1, rb2 = rb2, rb1
+		}
+	}
+	finishC <- 1
+}
+
+// MarkChangedEdges return the edges that need to be walked again after added the new kmers
+func MarkChangedEdges(edgesArr []DBGEdge, nodeSet map[[NODEMAP_KEY_LEN]uint64]bool, kmerlen, numCPU int) (changed []bool) {
+	changed = make([]bool, len(edgesArr))
+	finishC := make(chan int, numCPU)
+	for i := 0; i < numCPU; i++ {
+		go paraMarkChangedEdges(edgesArr, nodeSet, kmerlen, i, numCPU, changed, finishC)
+	}
+	for i := 0; i < numCPU; i++ {
+		<-finishC
+	}
+	return
+}
+
+// CompactDBGEdgesID renumber the not deleted edges continuously from 2 and change the nodes edge ID
+func CompactDBGEdgesID(nodesArr []DBGNode, edgesArr []DBGEdge) (newEdgesArr []DBGEdge) {
+	idMap := make([]DBG_MAX_INT, len(edgesArr))
+	newEdgesArr = make([]DBGEdge, 2, len(edgesArr))
+	for _, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		idMap[e.ID] = DBG_MAX_INT(len(newEdgesArr))
+		e.ID = idMap[e.ID]
+		newEdgesArr = append(newEdgesArr, e)
+	}
+	for i := range nodesArr {
+		for j := 0; j < bnt.BaseTypeNum; j++ {
+			if id := nodesArr[i].EdgeIDIncoming[j]; id > 1 {
+				nodesArr[i].EdgeIDIncoming[j] = idMap[id]
+			}
+			if id := nodesArr[i].EdgeIDOutcoming[j]; id > 1 {
+				nodesArr[i].EdgeIDOutcoming[j] = idMap[id]
+			}
+		}
+	}
+	return
+}
+
+// walkToNode walk forward from the last (K-1)-mer of kmer kb until reach a node, a tip
+// or the circle start, the passed (K-1)-mers will be deleted from the seedSet, if reach
+// a node in the nodeMap, open the slot of the node if not set
+func walkToNode(kb constructcf.KmerBnt, seedSet map[[NODEMAP_KEY_LEN]uint64]bool, nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode, cf cuckoofilter.CuckooFilter) (opened bool) {
+	nl := cf.Kmerlen - 1
+	seq := constructcf.ExtendKmerBnt2Byte(kb)
+	bi := seq[0]
+	nkb := constructcf.GetReadBntKmer(seq, 1, nl)
+	nr := constructcf.ReverseComplet(nkb)
+	startKey := getNodeKey(nkb, nr)
+	for {
+		node := ExtendNodeKmer(nkb, nr, cf, MIN_KMER_COUNT)
+		var leftcount, rightcount int
+		var baseBnt byte
+		for i := 0; i < bnt.BaseTypeNum; i++ {
+			if node.EdgeIDIncoming[i] == 1 {
+				leftcount++
+			}
+			if node.EdgeIDOutcoming[i] == 1 {
+				baseBnt = uint8(i)
+				rightcount++
+			}
+		}
+		key := getNodeKey(nkb, nr)
+		if leftcount > 1 || rightcount > 1 {
+			v, ok := nodeMap[key]
+			if !ok {
+				return
+			}
+			if reflect.DeepEqual(v.Seq, nkb.Seq) {
+				if v.EdgeIDIncoming[bi] == 0 {
+					v.EdgeIDIncoming[bi] = 1
+					opened = true
+				}
+			} else if v.EdgeIDOutcoming[bnt.BaseTypeNum-1-int(bi)] == 0 {
+				v.EdgeIDOutcoming[bnt.BaseTypeNum-1-int(bi)] = 1
+				opened = true
+			}
+			nodeMap[key] = v
+			return
+		}
+		delete(seedSet, key)
+		if leftcount != 1 || rightcount != 1 {
+			return
+		}
+		bi = byte(constructcf.ExtendKmerBnt2Byte(nkb)[0])
+		nkb = constructcf.GetNextKmer(nkb, uint64(baseBnt), nl)
+		nr = constructcf.GetPreviousKmer(nr, uint64(bnt.BntRev[baseBnt]), nl)
+		if getNodeKey(nkb, nr) == startKey {
+			return
+		}
+	}
+}
+
+// walkNewKmers start walks from the new kmers that touch no node to both directions, return
+// the number of node slots opened by the walks
+func walkNewKmers(kmerArr []constructcf.KmerBnt, nodeSet map[[NODEMAP_KEY_LEN]uint64]bool, nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode, cf cuckoofilter.CuckooFilter) (openNum int) {
+	seedSet := make(map[[NODEMAP_KEY_LEN]uint64]bool, len(nodeSet))
+	for key := range nodeSet {
+		if _, ok := nodeMap[key]; !ok {
+			seedSet[key] = true
+		}
+	}
+	for _, kb := range kmerArr {
+		seq := constructcf.ExtendKmerBnt2Byte(kb)
+		fkb := constructcf.GetReadBntKmer(seq, 0, cf.Kmerlen-1)
+		lkb := constructcf.GetReadBntKmer(seq, 1, cf.Kmerlen-1)
+		if !seedSet[getNodeKey(fkb, constructcf.ReverseComplet(fkb))] || !seedSet[getNodeKey(lkb, constructcf.ReverseComplet(lkb))] {
+			continue
+		}
+		for _, wkb := range [2]constructcf.KmerBnt{kb, constructcf.ReverseComplet(kb)} {
+			if walkToNode(wkb, seedSet, nodeMap, cf) {
+				openNum++
+			}
+		}
+	}
+	return
+}
+
+// UpdateDBGByKmers add the new solid kmers to the DBG constructed by cdbg, the cf must
+// contain the new kmers, only the nodes and edges affected by the new kmers will be changed
+func UpdateDBGByKmers(nodesArr []DBGNode, edgesArr []DBGEdge, cf cuckoofilter.CuckooFilter, kmerArr []constructcf.KmerBnt, prefix string, numCPU int) ([]DBGNode, []DBGEdge) {
+	kmerlen := cf.Kmerlen
+	nodeSet := GetKmersNodeSet(kmerArr, kmerlen)
+	changed := MarkChangedEdges(edgesArr, nodeSet, kmerlen, numCPU)
+
+	// open the slots of changed edges
+	var changedNum int
+	for i, ok := range changed {
+		if !ok {
+			continue
+		}
+		e := edgesArr[i]
+		for _, nID := range [2]DBG_MAX_INT{e.StartNID, e.EndNID} {
+			if nID < 2 {
+				continue
+			}
+			for j := 0; j < bnt.BaseTypeNum; j++ {
+				if nodesArr[nID].EdgeIDIncoming[j] == e.ID {
+					nodesArr[nID].EdgeIDIncoming[j] = 1
+				}
+				if nodesArr[nID].EdgeIDOutcoming[j] == e.ID {
+					nodesArr[nID].EdgeIDOutcoming[j] = 1
+				}
+			}
+		}
+		edgesArr[i].SetDeleteFlag()
+		changedNum++
+	}
+
+	nodeMap := make(map[[NODEMAP_KEY_LEN]uint64]DBGNode, len(nodesArr))
+	for _, nd := range nodesArr {
+		if nd.ID < 2 {
+			continue
+		}
+		var key [NODEMAP_KEY_LEN]uint64
+		copy(key[:], nd.Seq)
+		nodeMap[key] = nd
+	}
+
+	// open the new branch slots of old nodes and add new complex nodes
+	nodeID := DBG_MAX_INT(len(nodesArr))
+	var branchNum, newNodeNum int
+	NBntUint64Len := (kmerlen - 1 + bnt.NumBaseInUint64 - 1) / bnt.NumBaseInUint64
+	for key := range nodeSet {
+		var nkb constructcf.KmerBnt
+		nkb.Len = kmerlen - 1
+		nkb.Seq = make([]uint64, NBntUint64Len)
+		copy(nkb.Seq, key[:])
+		ext := ExtendNodeKmer(nkb, constructcf.ReverseComplet(nkb), cf, MIN_KMER_COUNT)
+		if nd, ok := nodeMap[key]; ok {
+			for j := 0; j < bnt.BaseTypeNum; j++ {
+				if ext.EdgeIDIncoming[j] == 1 && nd.EdgeIDIncoming[j] == 0 {
+					nd.EdgeIDIncoming[j] = 1
+					branchNum++
+				}
+				if ext.EdgeIDOutcoming[j] == 1 && nd.EdgeIDOutcoming[j] == 0 {
+					nd.EdgeIDOutcoming[j] = 1
+					branchNum++
+				}
+			}
+			nodeMap[key] = nd
+			continue
+		}
+		var leftcount, rightcount int
+		for j := 0; j < bnt.BaseTypeNum; j++ {
+			if ext.EdgeIDIncoming[j] == 1 {
+				leftcount++
+			}
+			if ext.EdgeIDOutcoming[j] == 1 {
+				rightcount++
+			}
+		}
+		if leftcount > 1 || rightcount > 1 {
+			ext.ID = nodeID
+			nodeMap[key] = ext
+			nodeID++
+			newNodeNum++
+		}
+	}
+	branchNum += walkNewKmers(kmerArr, nodeSet, nodeMap, cf)
+	fmt.Printf("[UpdateDBGByKmers] new kmers number: %d, changed edges number: %d, new branches of old nodes: %d, new nodes number: %d\n", len(kmerArr), changedNum, branchNum, newNodeNum)
+
+	// walk the opened slots
+	addEdgesfn := prefix + ".edges.add.fq"
+	startEdgeID := DBG_MAX_INT(len(edgesArr))
+	newNodeID, edgeID := GenerateDBGEdges(nodeMap, cf, addEdgesfn, numCPU, nodeID, startEdgeID)
+	addEdgesArr := ReadEdgesFromFile(addEdgesfn, edgeID)
+	os.Remove(addEdgesfn)
+	fmt.Printf("[UpdateDBGByKmers] added edges number: %d\n", edgeID-startEdgeID)
+
+	nodesArr = make([]DBGNode, newNodeID)
+	NodeMap2NodeArr(nodeMap, nodesArr)
+	edgesArr = append(edgesArr, addEdgesArr[startEdgeID:]...)
+	edgesArr = CompactDBGEdgesID(nodesArr, edgesArr)
+	return nodesArr, edgesArr
+}
+
+// ReadUniqKmerArr read all kmers of the uniq kmer file
+func ReadUniqKmerArr(brfn string, kmerlen int) (kmerArr []constructcf.KmerBnt) {
+	cs := make(chan constructcf.KmerBntBucket, 20)
+	go readUniqKmer(brfn, cs, kmerlen, 1)
+	for buck := range cs {
+		kmerArr = append(kmerArr, buck.KmerBntBuf[:buck.Count]...)
+	}
+	return
+}
+
+// WriteEdgesArrToFn write the edges to the fastq file as GenerateDBGEdges output
+func WriteEdgesArrToFn(edgesfn string, edgesArr []DBGEdge) {
+	edgesfp, err := os.Create(edgesfn)
+	if err != nil {
+		log.Fatalf("[WriteEdgesArrToFn] create file: %s failed, err: %v\n", edgesfn, err)
+	}
+	defer edgesfp.Close()
+	edgesbuffp := bufio.NewWriter(edgesfp)
+	for _, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		WritefqRecord(edgesbuffp, e)
+	}
+	if err := edgesbuffp.Flush(); err != nil {
+		log.Fatalf("[WriteEdgesArrToFn] write file: %s failed, err: %v\n", edgesfn, err)
+	}
+}
+
+// IncDBG add the reads of new libraries to the cuckoofilter, the uniq kmers file and
+// the DBG constructed by cdbg, the smfy and later steps need to be run again
+func IncDBG(c cli.Command) {
+	opt, suc := utils.CheckGlobalArgs(c.Parent())
+	if suc == false {
+		log.Fatalf("[IncDBG] check global Arguments error, opt: %v\n", opt)
+	}
+	libs := c.Flag("lib").String()
+	if libs == "" {
+		log.Fatalf("[IncDBG] argument 'lib' not set\n")
+	}
+	correct := c.Flag("Correct").Get().(bool)
+	deterministic := c.Flag("Deterministic").Get().(bool)
+	cfgInfo, err := constructcf.ParseCfg(opt.CfgFn, correct)
+	if err != nil {
+		log.Fatalf("[IncDBG] ParseCfg 'C': %v err :%v\n", opt.CfgFn, err)
+	}
+	var fnArr []string
+	for _, name := range strings.Split(libs, ",") {
+		found := false
+		for _, lib := range cfgInfo.Libs {
+			if lib.Name != name {
+				continue
+			}
+			found = true
+			if lib.AsmFlag != constructcf.AllState && lib.SeqProfile != 1 {
+				log.Fatalf("[IncDBG] library: %s not used for construct DBG, asm_flag: %v, seq_profile: %v\n", name, lib.AsmFlag, lib.SeqProfile)
+			}
+			fnArr = append(fnArr, lib.FnName...)
+		}
+		if !found {
+			log.Fatalf("[IncDBG] library: %s not found in the cfg file: %v\n", name, opt.CfgFn)
+		}
+	}
+	runtime.GOMAXPROCS(opt.NumCPU + 2)
+	t0 := time.Now()
+
+	// add kmers to the cuckoofilter
+	cf := LoadCuckooFilter(opt.Prefix)
+	if cf.Kmerlen != opt.Kmer {
+		log.Fatalf("[IncDBG] cuckoofilter Kmerlen: %v != K: %v\n", cf.Kmerlen, opt.Kmer)
+	}
+	addKmerfn := opt.Prefix + ".uniqkmerseq.add.br"
+	constructcf.ConstructCFFromFiles(cf, fnArr, addKmerfn, opt.NumCPU, opt.Kmer)
+	if err := cf.WriteCuckooFilterInfo(opt.Prefix + ".cf.Info"); err != nil {
+		log.Fatalf("[IncDBG] WriteCuckooFilterInfo error: %v\n", err)
+	}
+	if err := cf.HashWriter(opt.Prefix + ".cf.Hash.br"); err != nil {
+		log.Fatalf("[IncDBG] HashWriter error: %v\n", err)
+	}
+	cf.GetStat()
+	kmerArr := ReadUniqKmerArr(addKmerfn, opt.Kmer)
+	constructcf.AppendUniqKmerFile(opt.Prefix+".uniqkmerseq.br", addKmerfn)
+	os.Remove(addKmerfn)
+	t1 := time.Now()
+	fmt.Printf("[IncDBG] added new kmers number: %d, took %v to run\n", len(kmerArr), t1.Sub(t0))
+
+	// update DBG
+	nodesArr, edgesArr := LoadStageDBG(opt.Prefix, "cdbg", opt.Kmer, opt.NumCPU)
+	if len(kmerArr) > 0 {
+		nodesArr, edgesArr = UpdateDBGByKmers(nodesArr, edgesArr, cf, kmerArr, opt.Prefix, opt.NumCPU)
+	}
+	if deterministic {
+		nodesArr, edgesArr = RenumberDBGCanonical(nodesArr, edgesArr, opt.Kmer)
+	}
+	WriteEdgesArrToFn(opt.Prefix+".edges.fq", edgesArr)
+	EdgesArrBinWriter(edgesArr, opt.Prefix+".edges.bin", opt.Kmer)
+	DBGStatWriter(opt.Prefix+".DBG.stat", DBG_MAX_INT(len(nodesArr)), DBG_MAX_INT(len(edgesArr)))
+	StoreDBGComponents(nodesArr, edgesArr, opt.Prefix, "cdbg")
+	NodesArrWriter(nodesArr, opt.Prefix+".nodes.mmap", opt.Kmer)
+	fmt.Printf("[IncDBG] nodes size: %d, edges size: %d, update DBG took %v to run\n", len(nodesArr), len(edgesArr), time.Now().Sub(t1))
+}
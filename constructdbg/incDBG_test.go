@@ -0,0 +1,135 @@
+package constructdbg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/cbrotli"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/cuckoofilter"
+)
+
+const incTestKmerlen = 31
+
+func randSeq(r *rand.Rand, n int) []byte {
+	seq := make([]byte, n)
+	for i := range seq {
+		seq[i] = byte(r.Intn(bnt.BaseTypeNum))
+	}
+	return seq
+}
+
+func catSeq(arr ...[]byte) (seq []byte) {
+	for _, s := range arr {
+		seq = append(seq, s...)
+	}
+	return
+}
+
+// insert every read MIN_KMER_COUNT times, return the kmers that become solid
+func insertReads(t *testing.T, cf cuckoofilter.CuckooFilter, reads [][]byte) (kmerArr []constructcf.KmerBnt) {
+	for _, rd := range reads {
+		for c := uint16(0); c < MIN_KMER_COUNT; c++ {
+			for j := 0; j+cf.Kmerlen <= len(rd); j++ {
+				kb := constructcf.GetReadBntKmer(rd, j, cf.Kmerlen)
+				rb := constructcf.ReverseComplet(kb)
+				min := kb
+				if kb.BiggerThan(rb) {
+					min = rb
+				}
+				count, suc := cf.Insert(min.Seq)
+				if !suc {
+					t.Fatalf("insert read kmer to the cuckoofilter failed, kmer: %v", min.Seq)
+				}
+				if count == int(MIN_KMER_COUNT)-1 {
+					kmerArr = append(kmerArr, min)
+				}
+			}
+		}
+	}
+	return
+}
+
+func writeUniqKmer(t *testing.T, fn string, kmerArr []constructcf.KmerBnt) {
+	fp, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	brfp := cbrotli.NewWriter(fp, cbrotli.WriterOptions{Quality: 1})
+	buffp := bufio.NewWriter(brfp)
+	for _, kb := range kmerArr {
+		if err := binary.Write(buffp, binary.LittleEndian, kb.Seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := buffp.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := brfp.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func buildCDBG(t *testing.T, prefix string, reads [][]byte) (cuckoofilter.CuckooFilter, []DBGNode, []DBGEdge) {
+	cf := cuckoofilter.MakeCuckooFilter(1<<16, incTestKmerlen)
+	writeUniqKmer(t, prefix+".uniqkmerseq.br", insertReads(t, cf, reads))
+	ConstructDBG(cf, prefix, 2, false)
+	nodesArr, edgesArr := LoadStageDBG(prefix, "cdbg", incTestKmerlen, 2)
+	return cf, nodesArr, edgesArr
+}
+
+// the sorted canonical sequences of the not deleted edges
+func edgesSeqSet(edgesArr []DBGEdge) (set []string) {
+	for _, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		s, rs := make([]byte, len(e.Utg.Ks)), make([]byte, len(e.Utg.Ks))
+		for i, b := range e.Utg.Ks {
+			s[i] = bnt.BitNtCharUp[b]
+			rs[len(rs)-1-i] = bnt.BitNtCharUp[bnt.BntRev[b]]
+		}
+		if string(rs) < string(s) {
+			s = rs
+		}
+		set = append(set, string(s))
+	}
+	sort.Strings(set)
+	return
+}
+
+func TestUpdateDBGByKmers(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	K := incTestKmerlen
+	x, y1, y2, v1, v2 := randSeq(r, 300), randSeq(r, 200), randSeq(r, 200), randSeq(r, 150), randSeq(r, 150)
+	z, u1, u2, c := randSeq(r, 150), randSeq(r, 150), randSeq(r, 150), randSeq(r, 150)
+	p, q1, q2, s1, s2 := randSeq(r, 200), randSeq(r, 200), randSeq(r, 200), randSeq(r, 150), randSeq(r, 150)
+	baseReads := [][]byte{catSeq(x, y1), catSeq(x, y2), catSeq(y1, v1), catSeq(y1, v2)}
+	addReads := [][]byte{
+		catSeq(randSeq(r, 100), y1[50:150]),               // branch in the middle of the edge y1
+		catSeq(x[100:200], randSeq(r, 150)),               // branch in the middle of the tip x
+		catSeq(y2[100:], z), catSeq(z, u1), catSeq(z, u2), // extend the tip y2 to a new node
+		catSeq(p, q1), catSeq(p, q2), catSeq(q1, s1), catSeq(q1, s2), // new component
+		randSeq(r, 200),    // new linear sequence without node
+		catSeq(c, c[:2*K]), // new circle without node
+	}
+
+	dir := t.TempDir()
+	cf, nodesArr, edgesArr := buildCDBG(t, filepath.Join(dir, "inc"), baseReads)
+	kmerArr := insertReads(t, cf, addReads)
+	_, edgesArr = UpdateDBGByKmers(nodesArr, edgesArr, cf, kmerArr, filepath.Join(dir, "inc"), 2)
+
+	_, _, wantEdgesArr := buildCDBG(t, filepath.Join(dir, "full"), append(baseReads, addReads...))
+	got, want := edgesSeqSet(edgesArr), edgesSeqSet(wantEdgesArr)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("incremental DBG edges number: %d, full DBG edges number: %d\nincremental: %v\nfull: %v", len(got), len(want), got, want)
+	}
+}
@@ -71,6 +71,25 @@ func GetEdge(edgesArr []DBGEdge, rc chan Seq, numCPU int) {
 	}
 }
 
+// getIndexEdge send the edges like GetEdge, but skip the deleted edges and the empty
+// sequence edges that would be taken as the terminal signal of paraCollectMinKmer
+func getIndexEdge(edgesArr []DBGEdge, rc chan Seq, numCPU int) {
+	for i := range edgesArr {
+		e := &edgesArr[i]
+		if e.ID == 0 || e.GetDeleteFlag() > 0 || len(e.Utg.Ks) == 0 {
+			continue
+		}
+		var seq Seq
+		seq.ID = int(e.ID)
+		seq.S = e.Utg.Ks
+		rc <- seq
+	}
+	for i := 0; i < numCPU; i++ {
+		var ns Seq
+		rc <- ns
+	}
+}
+
 type SkSlice []SeedKmerInfo
 
 func CollectSeedKmerInfo(wc chan SeedKmerInfo, numCPU int) (skSlice []SeedKmerInfo) {
@@ -145,6 +164,41 @@ func GetMinKmerFromWidth(minArr []SeedKmerInfo, width int) (min SeedKmerInfo, p
 	return min, p
 }
 
+// GetMinKmerArr return the minimizers of seq with the seed length in the window of width kmers
+func GetMinKmerArr(ID int, seq []byte, seed int, width int) (arr []SeedKmerInfo) {
+	var minArr []SeedKmerInfo
+	w := width
+	for i := 0; i < len(seq)-seed+1; i++ {
+		k := GetKmer(seq[i:], seed)
+		mk, strand := GetMinSeed(k, seed)
+		var min SeedKmerInfo
+		min.Kmer = mk
+		min.Info = CompactInfo(ID, i, strand)
+		// fmt.Printf("[paraCollectMinKmer] ID: %d\n", min.Info>>32)
+		minArr = append(minArr, min)
+		if i > 0 && i%128 == 0 {
+			for j := 0; j < width; j++ {
+				minArr[j] = minArr[len(minArr)-width+j]
+			}
+			minArr = minArr[:width]
+		}
+		if len(minArr) >= width {
+			if w < width {
+				if min.Kmer < minArr[len(minArr)-1-w].Kmer {
+					arr = append(arr, min)
+					w = 0
+				}
+			} else {
+				m, p := GetMinKmerFromWidth(minArr[len(minArr)-width:], width)
+				arr = append(arr, m)
+				w = width - 1 - p
+			}
+			w++
+		}
+	}
+	return
+}
+
 func paraCollectMinKmer(rc chan Seq, wc chan SeedKmerInfo, seed int, width int) {
 
 	for {
@@ -155,40 +209,28 @@ func paraCollectMinKmer(rc chan Seq, wc chan SeedKmerInfo, seed int, width int)
 			wc <- ski
 			break
 		}
-		var minArr []SeedKmerInfo
-		w := width
-		for i := 0; i < len(seq)-seed+1; i++ {
-			k := GetKmer(seq[i:], seed)
-			mk, strand := GetMinSeed(k, seed)
-			var min SeedKmerInfo
-			min.Kmer = mk
-			min.Info = CompactInfo(data.ID, i, strand)
-			// fmt.Printf("[paraCollectMinKmer] ID: %d\n", min.Info>>32)
-			minArr = append(minArr, min)
-			if i > 0 && i%128 == 0 {
-				for j := 0; j < width; j++ {
-					minArr[j] = minArr[len(minArr)-width+j]
-				}
-				minArr = minArr[:width]
-			}
-			if len(minArr) >= width {
-				if w < width {
-					if min.Kmer < minArr[len(minArr)-1-w].Kmer {
-						wc <- min
-						w = 0
-					}
-				} else {
-					m, p := GetMinKmerFromWidth(minArr[len(minArr)-width:], width)
-					wc <- m
-					w = width - 1 - p
-				}
-				w++
-			}
-
+		for _, min := range GetMinKmerArr(data.ID, seq, seed, width) {
+			wc <- min
 		}
 	}
 }
 
+// GetEdgesMinKmerIndex return the minimizers of the edges sorted by kmer, the deleted edges skipped
+func GetEdgesMinKmerIndex(edgesArr []DBGEdge, seed, width, numCPU int) []SeedKmerInfo {
+	rc := make(chan Seq, numCPU)
+	wc := make(chan SeedKmerInfo, numCPU)
+	go getIndexEdge(edgesArr, rc, numCPU)
+	for i := 0; i < numCPU; i++ {
+		go paraCollectMinKmer(rc, wc, seed, width)
+	}
+	skSlice := CollectSeedKmerInfo(wc, numCPU)
+	fmt.Printf("[GetEdgesMinKmerIndex] len(skSlice): %v\n", len(skSlice))
+	if len(skSlice) == 0 {
+		return skSlice
+	}
+	return RadixSort(skSlice, seed*bnt.NumBitsInBase, Min(numCPU, len(skSlice)))
+}
+
 const B = 8 // test B get better performance
 const SIZE = (1 << 8)
 const MASK = SIZE - 1
@@ -1148,7 +1190,7 @@ func PrintMatch(readSeq, edgeSeq []byte) {
 	fmt.Fprintf(os.Stdout, ">edgeSeq\n%s\n", eS)
 }
 
-func ExtendSeedEdge(seedEdgeIndex int, NoContainMKArr []MapEdgeKmers, edgesArr []DBGEdge, nodesArr []DBGNode, mks []MergeKmerInfo, seed int, ReadLen int32, readSeq []byte) (readPath []DBG_MAX_INT) {
+func ExtendSeedEdge(seedEdgeIndex int, NoContainMKArr []MapEdgeKmers, edgesArr []DBGEdge, nodesArr []DBGNode, mks []MergeKmerInfo, seed int, ReadLen int32, readSeq []byte) (readPath []DBG_MAX_INT, seedIdx int) {
 	// extend left flank
 	{
 		smk := NoContainMKArr[seedEdgeIndex]
@@ -1225,6 +1267,7 @@ func ExtendSeedEdge(seedEdgeIndex int, NoContainMKArr []MapEdgeKmers, edgesArr [
 	}
 
 	readPath = ReverseDBG_MAX_INTArr(readPath)
+	seedIdx = len(readPath) - 1
 
 	// extend rigth flank
 	{
@@ -1298,10 +1341,61 @@ func ExtendSeedEdge(seedEdgeIndex int, NoContainMKArr []MapEdgeKmers, edgesArr [
 		}
 	}
 
-	return readPath
+	return readPath, seedIdx
 }
 
-func paraFoundPath(rc chan []MergeKmerInfo, wc chan []DBG_MAX_INT, edgesArr []DBGEdge, nodesArr []DBGNode, seed int32, seqSlice []Seq) {
+// GetMapPathGAFRecord return the GAF record of read path found by paraFoundPath, the ends
+// of alignment taken from the first and last edges of path that have seeds mapped
+func GetMapPathGAFRecord(rd Seq, readPath []DBG_MAX_INT, seedIdx int, NoContainMKArr []MapEdgeKmers, mks []MergeKmerInfo, edgesArr []DBGEdge, seed, kmerlen int) (g GAFRecord, ok bool) {
+	var smk MapEdgeKmers
+	for _, mek := range NoContainMKArr {
+		if DBG_MAX_INT(mek.EID) == readPath[seedIdx] {
+			smk = mek
+			break
+		}
+	}
+	g.StrandArr = GetPathStrand(readPath, seedIdx, smk.Strand == 0, edgesArr)
+	first := -1
+	for i, eID := range readPath {
+		for _, mek := range NoContainMKArr {
+			if DBG_MAX_INT(mek.EID) != eID || (mek.Strand == 0) != g.StrandArr[i] {
+				continue
+			}
+			el := len(edgesArr[eID].Utg.Ks)
+			offset := GetWalkLen(readPath[:i+1], edgesArr, kmerlen) - el
+			ps := int(mks[mek.Index].Rinfo >> 1)
+			pe := int(mks[mek.Max].Rinfo>>1) + seed
+			if g.StrandArr[i] == MINUS {
+				ps, pe = el-pe, el-ps
+			}
+			if first < 0 {
+				first = i
+				g.QStart = int(mek.Start)
+				g.PStart = offset + ps
+			}
+			g.QEnd = int(mek.End)
+			g.PEnd = offset + pe
+			g.Match += int(mek.MapBN)
+			break
+		}
+	}
+	if first < 0 || g.QEnd <= g.QStart || g.PEnd <= g.PStart {
+		return g, false
+	}
+	g.QName = strconv.Itoa(rd.ID)
+	g.QLen = len(rd.S)
+	g.EIDArr = readPath
+	g.PLen = GetWalkLen(readPath, edgesArr, kmerlen)
+	g.BlockLen = MaxInt(g.QEnd-g.QStart, g.PEnd-g.PStart)
+	if g.Match > g.BlockLen {
+		g.Match = g.BlockLen
+	}
+	g.MapQ = GAFMissingMapQ
+	ok = true
+	return
+}
+
+func paraFoundPath(rc chan []MergeKmerInfo, wc chan []GAFRecord, edgesArr []DBGEdge, nodesArr []DBGNode, seed int32, kmerlen int, seqSlice []Seq) {
 
 	minKmerNum := 3
 	for {
@@ -1448,46 +1542,48 @@ func paraFoundPath(rc chan []MergeKmerInfo, wc chan []DBG_MAX_INT, edgesArr []DB
 			log.Fatalf("[paraFoundPath] ovlelapLen: %v\n", overlapLen)
 		}
 		fmt.Printf("[paraFoundPath]SeedMK : %v\n", NoContainMKArr[seedEdgeIndex])
-		readPath := ExtendSeedEdge(seedEdgeIndex, NoContainMKArr, edgesArr, nodesArr, mks, int(seed), ReadLen, seqSlice[mks[0].QID].S)
-		wc <- readPath
-
+		readPath, seedIdx := ExtendSeedEdge(seedEdgeIndex, NoContainMKArr, edgesArr, nodesArr, mks, int(seed), ReadLen, seqSlice[mks[0].QID].S)
+		fmt.Printf("[paraFoundPath]ReadPath: %v\n", readPath)
+		if g, ok := GetMapPathGAFRecord(seqSlice[mks[0].QID], readPath, seedIdx, NoContainMKArr, mks, edgesArr, int(seed), kmerlen); ok {
+			wc <- []GAFRecord{g}
+		}
 	}
 
-	var tmp []DBG_MAX_INT
-	wc <- tmp
+	wc <- nil
 }
 
-func WriteReadPath(wc chan []DBG_MAX_INT, numCPU int) {
+// WriteReadPath send the GAF records of read paths to gc until numCPU paraFoundPath finished
+func WriteReadPath(wc chan []GAFRecord, numCPU int, gc chan<- []GAFRecord) {
 	terminalNum := 0
 	for {
-		rp := <-wc
-		if len(rp) == 0 {
+		gArr := <-wc
+		if gArr == nil {
 			terminalNum++
 			if terminalNum == numCPU {
 				break
 			}
+			continue
 		}
-
-		fmt.Printf("[WriteReadPath]ReadPath: %v\n", rp)
+		gc <- gArr
 	}
 }
 
-func FindPath(mkiArr []MergeKmerInfo, numCPU, seed int, edgesArr []DBGEdge, nodesArr []DBGNode, seqSlice []Seq) {
+func FindPath(mkiArr []MergeKmerInfo, numCPU, seed, kmerlen int, edgesArr []DBGEdge, nodesArr []DBGNode, seqSlice []Seq, gc chan<- []GAFRecord) {
 	rc := make(chan []MergeKmerInfo, numCPU)
-	wc := make(chan []DBG_MAX_INT, numCPU)
+	wc := make(chan []GAFRecord, numCPU)
 
 	fmt.Printf("[FindPath]len(mkiArr): %v\n", len(mkiArr))
 	go GetMki(mkiArr, rc, numCPU)
 
 	for i := 0; i < numCPU; i++ {
-		go paraFoundPath(rc, wc, edgesArr, nodesArr, int32(seed), seqSlice)
+		go paraFoundPath(rc, wc, edgesArr, nodesArr, int32(seed), kmerlen, seqSlice)
 	}
 
-	WriteReadPath(wc, numCPU)
+	WriteReadPath(wc, numCPU, gc)
 
 }
 
-func AlignQuery(qrc chan []Seq, refSlice []SeedKmerInfo, seed, width, numCPU int, edgesArr []DBGEdge, nodesArr []DBGNode) {
+func AlignQuery(qrc chan []Seq, refSlice []SeedKmerInfo, seed, width, numCPU, kmerlen int, edgesArr []DBGEdge, nodesArr []DBGNode, gc chan<- []GAFRecord) {
 	for {
 		seqSlice := <-qrc
 		if len(seqSlice) == 0 {
@@ -1530,7 +1626,7 @@ func AlignQuery(qrc chan []Seq, refSlice []SeedKmerInfo, seed, width, numCPU int
 		}
 
 		// found most probality path in the edges
-		FindPath(mergeKInfoArr, numCPU, seed, edgesArr, nodesArr, seqSlice)
+		FindPath(mergeKInfoArr, numCPU, seed, kmerlen, edgesArr, nodesArr, seqSlice, gc)
 
 	}
 }
@@ -1546,7 +1642,8 @@ func MapDBG(c cli.Command) {
 	}
 	fmt.Println(cfgInfo)
 
-	if _, err = strconv.Atoi(c.Parent().Flag("K").String()); err != nil {
+	kmerlen, err := strconv.Atoi(c.Parent().Flag("K").String())
+	if err != nil {
 		log.Fatal("flag 'K' set error")
 	}
 	prefix := c.Parent().Flag("p").String()
@@ -1576,9 +1673,7 @@ func MapDBG(c cli.Command) {
 	// Restore edges info
 	//edgesStatfn := prefix + ".edges.stat"
 	//edgesSize := EdgesStatReader(edgesStatfn)
-	edgesArr := make([]DBGEdge, edgesSize)
-	edgesfn := prefix + ".edges.smfy.fq"
-	LoadEdgesfqFromFn(edgesfn, edgesArr, false)
+	edgesArr := LoadSmfyEdgesArr(prefix, int(edgesSize), kmerlen, numCPU)
 
 	//construct target sequence index
 	rc := make(chan Seq, numCPU)
@@ -1604,5 +1699,10 @@ func MapDBG(c cli.Command) {
 	blockSize := len(skSlice) * width
 	qrc := make(chan []Seq, 1)
 	go GetRawReads(qrc, cfgInfo, blockSize)
-	AlignQuery(qrc, skSlice, seed, width, numCPU, edgesArr, nodesArr)
+	gc := make(chan []GAFRecord, numCPU)
+	gafDone := make(chan int, 1)
+	go GAFRecordsWriter(prefix+".mapDBG.gaf", gc, 1, gafDone)
+	AlignQuery(qrc, skSlice, seed, width, numCPU, kmerlen, edgesArr, nodesArr, gc)
+	gc <- nil
+	<-gafDone
 }
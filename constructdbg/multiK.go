@@ -0,0 +1,161 @@
+package constructdbg
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jwaldrip/odin/cli"
+	"github.com/mudesheng/ga/cbrotli"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/utils"
+)
+
+// GetMultiKPrefix return the files prefix of the kmer step
+func GetMultiKPrefix(prefix string, kmerlen int) string {
+	return prefix + ".K" + strconv.Itoa(kmerlen)
+}
+
+// parse the kmer set argument, return the kmers sorted by increase
+func parseKset(ks string) (kArr []int, err error) {
+	for _, s := range strings.Split(ks, ",") {
+		k, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		if k <= 1 || k >= NODEMAP_KEY_LEN*32 {
+			return nil, fmt.Errorf("kmer: %d must between 2~%d", k, NODEMAP_KEY_LEN*32-1)
+		}
+		kArr = append(kArr, k)
+	}
+	sort.Ints(kArr)
+	for i := 1; i < len(kArr); i++ {
+		if kArr[i] == kArr[i-1] {
+			return nil, fmt.Errorf("kmer: %d repeat set", kArr[i])
+		}
+	}
+	return
+}
+
+// WritePseudoReads write the edges as the pseudo reads for the next kmer step, every edge
+// written MIN_KMER_COUNT times for all kmers of the edges will be solid in the cuckoofilter,
+// the edges shorter than minLen will be ignored
+func WritePseudoReads(edgesArr []DBGEdge, readsfn string, minLen int) (readsNum int) {
+	fp, err := os.Create(readsfn)
+	if err != nil {
+		log.Fatalf("[WritePseudoReads] create file: %s failed, err: %v\n", readsfn, err)
+	}
+	defer fp.Close()
+	brfp := cbrotli.NewWriter(fp, cbrotli.WriterOptions{Quality: 1})
+	defer brfp.Close()
+	buffp := bufio.NewWriterSize(brfp, 1<<20)
+	id := 1
+	for _, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 || len(e.Utg.Ks) < minLen {
+			continue
+		}
+		seq := Transform2Char(e.Utg.Ks)
+		for i := 0; i < int(MIN_KMER_COUNT); i++ {
+			fmt.Fprintf(buffp, ">%d\tedge:%d\n%s\n", id, e.ID, seq)
+			id++
+		}
+		readsNum++
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[WritePseudoReads] write file: %s failed, err: %v\n", readsfn, err)
+	}
+	if err := brfp.Flush(); err != nil {
+		log.Fatalf("[WritePseudoReads] write file: %s failed, err: %v\n", readsfn, err)
+	}
+	return
+}
+
+func getEdgesLenStat(edgesArr []DBGEdge) (num, totalLen, maxLen int) {
+	for _, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		num++
+		totalLen += len(e.Utg.Ks)
+		if len(e.Utg.Ks) > maxLen {
+			maxLen = len(e.Utg.Ks)
+		}
+	}
+	return
+}
+
+// MultiK construct and simplify the DBG from small kmer to large kmer, the edges of the
+// previous kmer used as pseudo reads with the reads for the next kmer, the files of every
+// kmer step output with prefix: "-p.K<kmer>"
+func MultiK(c cli.Command) {
+	gOpt, suc := utils.CheckGlobalArgs(c.Parent())
+	if suc == false {
+		log.Fatalf("[MultiK] check global Arguments error, opt: %v\n", gOpt)
+	}
+	tmp, suc := checkArgs(c)
+	if suc == false {
+		log.Fatalf("[MultiK] check Arguments error, opt: %v\n", tmp)
+	}
+	kArr, err := parseKset(c.Flag("Kset").String())
+	if err != nil {
+		log.Fatalf("[MultiK] argument 'Kset': %v set error: %v\n", c.Flag("Kset").String(), err)
+	}
+	deterministic := c.Flag("Deterministic").Get().(bool)
+	cfSize, err := strconv.ParseInt(c.Flag("S").String(), 10, 64)
+	if err != nil || cfSize < 1024*1024 {
+		log.Fatalf("[MultiK] argument 'S': %v must bigger than 1024 * 1024\n", c.Flag("S").String())
+	}
+	if tmp.MaxNGSReadLen < kArr[len(kArr)-1]+50 {
+		log.Fatalf("[MultiK] argument 'MaxNGSReadLen': %v must bigger than max kmer: %v + 50\n", tmp.MaxNGSReadLen, kArr[len(kArr)-1])
+	}
+	cfgInfo, err := constructcf.ParseCfg(gOpt.CfgFn, tmp.Correct)
+	if err != nil {
+		log.Fatalf("[MultiK] ParseCfg 'C': %v err :%v\n", gOpt.CfgFn, err)
+	}
+	var readsfnArr []string
+	for _, lib := range cfgInfo.Libs {
+		if lib.AsmFlag != constructcf.AllState && lib.SeqProfile != 1 {
+			continue
+		}
+		readsfnArr = append(readsfnArr, lib.FnName...)
+	}
+	fmt.Printf("[MultiK] kmer set: %v, reads files: %v\n", kArr, readsfnArr)
+
+	var pseudofn string
+	for i, k := range kArr {
+		t0 := time.Now()
+		opt := tmp
+		opt.ArgsOpt = gOpt
+		opt.Kmer = k
+		opt.Prefix = GetMultiKPrefix(gOpt.Prefix, k)
+		if opt.TipMaxLen == 0 {
+			opt.TipMaxLen = opt.MaxNGSReadLen
+		}
+		fnArr := readsfnArr
+		if pseudofn != "" {
+			fnArr = append([]string{pseudofn}, readsfnArr...)
+		}
+
+		// ccf, cdbg and smfy of this kmer
+		cfOpt := constructcf.Options{ArgsOpt: opt.ArgsOpt, CFSize: cfSize, Correct: opt.Correct}
+		cf := constructcf.ConstructCFToFiles(cfOpt, fnArr)
+		ConstructDBG(cf, opt.Prefix, opt.NumCPU, deterministic)
+		cf.Hash = nil
+		nodesArr, edgesArr := SmfyDBGFiles(opt)
+		StoreSmfyDBG(opt, nodesArr, edgesArr)
+		num, totalLen, maxLen := getEdgesLenStat(edgesArr)
+		fmt.Printf("[MultiK] K: %d, edges number: %d, total length: %d, max length: %d, took %v to run\n", k, num, totalLen, maxLen, time.Now().Sub(t0))
+
+		if i < len(kArr)-1 {
+			pseudofn = opt.Prefix + ".contigs.fa.br"
+			readsNum := WritePseudoReads(edgesArr, pseudofn, kArr[i+1]+10)
+			fmt.Printf("[MultiK] K: %d, write pseudo reads number: %d to file: %s\n", k, readsNum, pseudofn)
+		}
+	}
+	fmt.Printf("[MultiK] the DBG of the last K output with prefix: %s\n", GetMultiKPrefix(gOpt.Prefix, kArr[len(kArr)-1]))
+}
@@ -0,0 +1,233 @@
+package constructdbg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"syscall"
+
+	"github.com/mudesheng/ga/bnt"
+)
+
+// binary nodes file layout(little endian), record i is the node with ID i, so the file can
+// be used by mmap directly:
+//
+//	header: magic[4] | version uint32 | kmer uint32 | Seq uint64 number per node uint32 | nodes number uint64 | reserved uint64
+//	record: ID uint32 | EdgeIDIncoming [4]uint32 | EdgeIDOutcoming [4]uint32 | SubGID uint8 | Flag uint8 | pad [2]byte | Seq [n]uint64
+const (
+	NodesBinMagic      = "GANB"
+	NodesBinVersion    = 1
+	nodesBinHeaderSize = 32
+)
+
+type NodesBinHeader struct {
+	Version  uint32
+	Kmer     uint32
+	SeqLen   uint32 // the number of uint64 of DBGNode.Seq
+	NodesNum uint64
+}
+
+// GetNodeSeqLen return the number of uint64 used by node seq(K-1 bases)
+func GetNodeSeqLen(kmerlen int) int {
+	return (kmerlen - 1 + bnt.NumBaseInUint64 - 1) / bnt.NumBaseInUint64
+}
+
+func (h NodesBinHeader) RecordSize() int {
+	return 4 + 4*2*bnt.BaseTypeNum + 4 + 8*int(h.SeqLen)
+}
+
+func encodeNodesBinHeader(h NodesBinHeader) []byte {
+	buf := make([]byte, nodesBinHeaderSize)
+	copy(buf[:4], NodesBinMagic)
+	binary.LittleEndian.PutUint32(buf[4:], h.Version)
+	binary.LittleEndian.PutUint32(buf[8:], h.Kmer)
+	binary.LittleEndian.PutUint32(buf[12:], h.SeqLen)
+	binary.LittleEndian.PutUint64(buf[16:], h.NodesNum)
+	return buf
+}
+
+// decodeNodesBinHeader parse and check the header, kmerlen <= 0 skip the check of K
+func decodeNodesBinHeader(buf []byte, nodesfn string, kmerlen int) (h NodesBinHeader, err error) {
+	if len(buf) < nodesBinHeaderSize || string(buf[:4]) != NodesBinMagic {
+		err = fmt.Errorf("file: %s is not a binary nodes file(magic: %q), maybe written by old version of ga", nodesfn, NodesBinMagic)
+		return
+	}
+	h.Version = binary.LittleEndian.Uint32(buf[4:])
+	h.Kmer = binary.LittleEndian.Uint32(buf[8:])
+	h.SeqLen = binary.LittleEndian.Uint32(buf[12:])
+	h.NodesNum = binary.LittleEndian.Uint64(buf[16:])
+	if h.Version != NodesBinVersion {
+		err = fmt.Errorf("file: %s version: %d not supported, need version: %d", nodesfn, h.Version, NodesBinVersion)
+	} else if kmerlen > 0 && int(h.Kmer) != kmerlen {
+		err = fmt.Errorf("file: %s constructed by K: %d, but K set: %d", nodesfn, h.Kmer, kmerlen)
+	} else if int(h.SeqLen) != GetNodeSeqLen(int(h.Kmer)) {
+		err = fmt.Errorf("file: %s Seq length: %d not match K: %d", nodesfn, h.SeqLen, h.Kmer)
+	}
+	return
+}
+
+func encodeNodeRecord(nd DBGNode, buf []byte, seqLen int) {
+	le := binary.LittleEndian
+	for i := range buf {
+		buf[i] = 0
+	}
+	le.PutUint32(buf[0:], uint32(nd.ID))
+	for i := 0; i < bnt.BaseTypeNum; i++ {
+		le.PutUint32(buf[4+4*i:], uint32(nd.EdgeIDIncoming[i]))
+		le.PutUint32(buf[4+4*bnt.BaseTypeNum+4*i:], uint32(nd.EdgeIDOutcoming[i]))
+	}
+	p := 4 + 4*2*bnt.BaseTypeNum
+	buf[p] = nd.SubGID
+	buf[p+1] = nd.Flag
+	p += 4
+	for i := 0; i < len(nd.Seq) && i < seqLen; i++ {
+		le.PutUint64(buf[p+8*i:], nd.Seq[i])
+	}
+}
+
+func decodeNodeRecord(buf []byte, seqLen int) (nd DBGNode) {
+	le := binary.LittleEndian
+	nd.ID = DBG_MAX_INT(le.Uint32(buf[0:]))
+	if nd.ID == 0 {
+		return
+	}
+	for i := 0; i < bnt.BaseTypeNum; i++ {
+		nd.EdgeIDIncoming[i] = DBG_MAX_INT(le.Uint32(buf[4+4*i:]))
+		nd.EdgeIDOutcoming[i] = DBG_MAX_INT(le.Uint32(buf[4+4*bnt.BaseTypeNum+4*i:]))
+	}
+	p := 4 + 4*2*bnt.BaseTypeNum
+	nd.SubGID = buf[p]
+	nd.Flag = buf[p+1]
+	p += 4
+	nd.Seq = make([]uint64, seqLen)
+	for i := 0; i < seqLen; i++ {
+		nd.Seq[i] = le.Uint64(buf[p+8*i:])
+	}
+	return
+}
+
+// NodesArrWriter write nodesArr to the binary nodes file record by record
+func NodesArrWriter(nodesArr []DBGNode, nodesfn string, kmerlen int) {
+	nodesfp, err := os.Create(nodesfn)
+	if err != nil {
+		log.Fatalf("[NodesArrWriter] file %s create error, err: %v\n", nodesfn, err)
+	}
+	defer nodesfp.Close()
+	buffp := bufio.NewWriterSize(nodesfp, 1<<20)
+	h := NodesBinHeader{Version: NodesBinVersion, Kmer: uint32(kmerlen), SeqLen: uint32(GetNodeSeqLen(kmerlen)), NodesNum: uint64(len(nodesArr))}
+	if _, err := buffp.Write(encodeNodesBinHeader(h)); err != nil {
+		log.Fatalf("[NodesArrWriter] write file: %s err: %v\n", nodesfn, err)
+	}
+	buf := make([]byte, h.RecordSize())
+	for i, nd := range nodesArr {
+		if nd.ID > 0 && int(nd.ID) != i {
+			log.Fatalf("[NodesArrWriter] nodesArr[%d].ID: %v not equal to the index\n", i, nd.ID)
+		}
+		encodeNodeRecord(nd, buf, int(h.SeqLen))
+		if _, err := buffp.Write(buf); err != nil {
+			log.Fatalf("[NodesArrWriter] write file: %s err: %v\n", nodesfn, err)
+		}
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[NodesArrWriter] write file: %s err: %v\n", nodesfn, err)
+	}
+}
+
+// NodesArrReader read the binary nodes file record by record, kmerlen <= 0 skip the check of K
+func NodesArrReader(nodesfn string, kmerlen int) (nodesArr []DBGNode) {
+	nodesfp, err := os.Open(nodesfn)
+	if err != nil {
+		log.Fatalf("[NodesArrReader] open file %s failed, err:%v\n", nodesfn, err)
+	}
+	defer nodesfp.Close()
+	buffp := bufio.NewReaderSize(nodesfp, 1<<20)
+	hb := make([]byte, nodesBinHeaderSize)
+	if _, err := io.ReadFull(buffp, hb); err != nil {
+		log.Fatalf("[NodesArrReader] read header of file: %s err: %v\n", nodesfn, err)
+	}
+	h, err := decodeNodesBinHeader(hb, nodesfn, kmerlen)
+	if err != nil {
+		log.Fatalf("[NodesArrReader] %v\n", err)
+	}
+	nodesArr = make([]DBGNode, h.NodesNum)
+	buf := make([]byte, h.RecordSize())
+	for i := range nodesArr {
+		if _, err := io.ReadFull(buffp, buf); err != nil {
+			log.Fatalf("[NodesArrReader] read record: %d of file: %s err: %v\n", i, nodesfn, err)
+		}
+		nodesArr[i] = decodeNodeRecord(buf, int(h.SeqLen))
+	}
+	return
+}
+
+// NodeMapMmapReader read the binary nodes file to the nodeMap
+func NodeMapMmapReader(nodesfn string) (nodeMap map[[NODEMAP_KEY_LEN]uint64]DBGNode) {
+	nodesArr := NodesArrReader(nodesfn, 0)
+	nodeMap = make(map[[NODEMAP_KEY_LEN]uint64]DBGNode)
+	for _, nd := range nodesArr {
+		if nd.ID == 0 {
+			continue
+		}
+		var key [NODEMAP_KEY_LEN]uint64
+		copy(key[:], nd.Seq)
+		nodeMap[key] = nd
+	}
+	return
+}
+
+// NodesMmap random access the nodes of binary nodes file by mmap
+type NodesMmap struct {
+	Header NodesBinHeader
+	data   []byte
+	recLen int
+}
+
+func OpenNodesMmap(nodesfn string, kmerlen int) (nm *NodesMmap, err error) {
+	fp, err := os.Open(nodesfn)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	fi, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < nodesBinHeaderSize {
+		return nil, fmt.Errorf("file: %s size: %d too small", nodesfn, fi.Size())
+	}
+	data, err := syscall.Mmap(int(fp.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("mmap file: %s err: %v", nodesfn, err)
+	}
+	h, err := decodeNodesBinHeader(data, nodesfn, kmerlen)
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+	nm = &NodesMmap{Header: h, data: data, recLen: h.RecordSize()}
+	if int64(nodesBinHeaderSize)+int64(h.NodesNum)*int64(nm.recLen) > fi.Size() {
+		syscall.Munmap(data)
+		return nil, fmt.Errorf("file: %s truncated, nodes number: %d", nodesfn, h.NodesNum)
+	}
+	return nm, nil
+}
+
+func (nm *NodesMmap) Len() int {
+	return int(nm.Header.NodesNum)
+}
+
+func (nm *NodesMmap) GetNode(nID DBG_MAX_INT) (nd DBGNode, err error) {
+	if uint64(nID) >= nm.Header.NodesNum {
+		err = fmt.Errorf("node ID: %d >= nodes number: %d", nID, nm.Header.NodesNum)
+		return
+	}
+	p := nodesBinHeaderSize + int(nID)*nm.recLen
+	return decodeNodeRecord(nm.data[p:p+nm.recLen], int(nm.Header.SeqLen)), nil
+}
+
+func (nm *NodesMmap) Close() error {
+	return syscall.Munmap(nm.data)
+}
@@ -0,0 +1,634 @@
+package constructdbg
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// binary read paths index file layout(little endian):
+//
+//	header: magic[4] | version uint32 | kmer uint32 | edgesArr size uint32 | edges hash uint64 | reads number uint64 |
+//		records number uint64 | read index offset uint64 | edge index offset uint64 | postings offset uint64
+//	record: read ID int64 | walk length uint32 | walk []uint32(edge ID<<1 | 1 if MINUS)
+//	read index: records number of (read ID uint64, record offset uint64) sorted by read ID
+//	postings: record offsets uint64 of reads crossing the edge, grouped by edge ID
+//	edge index: edgesArr size + 1 of uint64 start of edge in the postings
+const (
+	PathIndexMagic      = "GAPI"
+	PathIndexVersion    = 1
+	pathIndexHeaderSize = 64
+	// the max postings number hold in memory when build the postings, more postings built by passes
+	PathIndexMaxPostings = 1 << 24
+	// the read index entries sorted in memory, more entries sorted by the chunk files and merged
+	PathIndexChunkSize = 1 << 22
+)
+
+// ReadPath is the oriented edges walk of a read
+type ReadPath struct {
+	ID        int64
+	EIDArr    []DBG_MAX_INT
+	StrandArr []bool
+}
+
+type PathIndexHeader struct {
+	Version         uint32
+	Kmer            uint32
+	ArrSize         uint32
+	EdgesHash       uint64
+	ReadsNum        uint64 // distinct read IDs
+	RecordsNum      uint64
+	ReadIndexOffset uint64
+	EdgeIndexOffset uint64
+	PostingsOffset  uint64
+}
+
+// GetPathIndexFn return the read paths index file name of prefix
+func GetPathIndexFn(prefix string) string {
+	return prefix + ".paths.idx"
+}
+
+// GetEdgesHash return the hash of IDs and lengths of the not deleted edges, the index only
+// valid for the DBG of the same hash
+func GetEdgesHash(edgesArr []DBGEdge) uint64 {
+	h := fnv.New64a()
+	var b [8]byte
+	for _, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		binary.LittleEndian.PutUint32(b[0:], uint32(e.ID))
+		binary.LittleEndian.PutUint32(b[4:], uint32(len(e.Utg.Ks)))
+		h.Write(b[:])
+	}
+	return h.Sum64()
+}
+
+func encodeReadPath(rp ReadPath) []byte {
+	buf := make([]byte, 12+4*len(rp.EIDArr))
+	le := binary.LittleEndian
+	le.PutUint64(buf[0:], uint64(rp.ID))
+	le.PutUint32(buf[8:], uint32(len(rp.EIDArr)))
+	for i, eID := range rp.EIDArr {
+		v := uint32(eID) << 1
+		if rp.StrandArr[i] == MINUS {
+			v |= 1
+		}
+		le.PutUint32(buf[12+4*i:], v)
+	}
+	return buf
+}
+
+func decodeReadPath(r io.Reader) (rp ReadPath, err error) {
+	var fix [12]byte
+	if _, err = io.ReadFull(r, fix[:]); err != nil {
+		return
+	}
+	le := binary.LittleEndian
+	rp.ID = int64(le.Uint64(fix[0:]))
+	walk := make([]byte, 4*le.Uint32(fix[8:]))
+	if _, err = io.ReadFull(r, walk); err != nil {
+		return
+	}
+	rp.EIDArr = make([]DBG_MAX_INT, len(walk)/4)
+	rp.StrandArr = make([]bool, len(walk)/4)
+	for i := range rp.EIDArr {
+		v := le.Uint32(walk[4*i:])
+		rp.EIDArr[i] = DBG_MAX_INT(v >> 1)
+		rp.StrandArr[i] = v&1 == 0
+	}
+	return
+}
+
+// the distinct edges of walk
+func getWalkEdges(eIDArr []DBG_MAX_INT) (arr []DBG_MAX_INT) {
+	for i, eID := range eIDArr {
+		added := false
+		for _, id := range eIDArr[:i] {
+			if id == eID {
+				added = true
+				break
+			}
+		}
+		if !added {
+			arr = append(arr, eID)
+		}
+	}
+	return
+}
+
+type readIndexEntry struct {
+	ID     int64
+	Offset uint64
+}
+
+// PathIndexWriter write the read paths to the index file, the read index entries sorted by
+// chunks of chunkSize written to the temporary files and merged at Close, the edges counts
+// hold in memory until Close
+type PathIndexWriter struct {
+	fn         string
+	fp         *os.File
+	buffp      *bufio.Writer
+	offset     uint64
+	header     PathIndexHeader
+	idxArr     []readIndexEntry
+	chunkSize  int
+	chunkFnArr []string
+	edgeCount  []uint64
+}
+
+// NewPathIndexWriter create the index file for the DBG edgesArr
+func NewPathIndexWriter(fn string, edgesArr []DBGEdge, kmerlen int) *PathIndexWriter {
+	fp, err := os.Create(fn)
+	if err != nil {
+		log.Fatalf("[NewPathIndexWriter] file %s create error, err: %v\n", fn, err)
+	}
+	pw := &PathIndexWriter{fn: fn, fp: fp, buffp: bufio.NewWriterSize(fp, 1<<20), offset: pathIndexHeaderSize, chunkSize: PathIndexChunkSize}
+	pw.header.Version = PathIndexVersion
+	pw.header.Kmer = uint32(kmerlen)
+	pw.header.ArrSize = uint32(len(edgesArr))
+	pw.header.EdgesHash = GetEdgesHash(edgesArr)
+	pw.edgeCount = make([]uint64, len(edgesArr)+1)
+	// write a empty header first, rewrite at Close
+	if _, err := pw.buffp.Write(make([]byte, pathIndexHeaderSize)); err != nil {
+		log.Fatalf("[NewPathIndexWriter] write file: %s err: %v\n", fn, err)
+	}
+	return pw
+}
+
+// Add write the read path record
+func (pw *PathIndexWriter) Add(rp ReadPath) {
+	if len(rp.EIDArr) == 0 {
+		return
+	}
+	rec := encodeReadPath(rp)
+	if _, err := pw.buffp.Write(rec); err != nil {
+		log.Fatalf("[PathIndexWriter.Add] write file: %s err: %v\n", pw.fn, err)
+	}
+	pw.idxArr = append(pw.idxArr, readIndexEntry{rp.ID, pw.offset})
+	pw.header.RecordsNum++
+	if len(pw.idxArr) >= pw.chunkSize {
+		pw.writeChunk()
+	}
+	for _, eID := range getWalkEdges(rp.EIDArr) {
+		if int(eID) >= len(pw.edgeCount)-1 {
+			log.Fatalf("[PathIndexWriter.Add] read ID: %v edge ID: %v >= edgesArr size: %v\n", rp.ID, eID, len(pw.edgeCount)-1)
+		}
+		pw.edgeCount[eID]++
+	}
+	pw.offset += uint64(len(rec))
+}
+
+func (pw *PathIndexWriter) sortIdxArr() {
+	sort.SliceStable(pw.idxArr, func(i, j int) bool { return pw.idxArr[i].ID < pw.idxArr[j].ID })
+}
+
+// writeChunk write the sorted read index entries in memory to a temporary chunk file
+func (pw *PathIndexWriter) writeChunk() {
+	pw.sortIdxArr()
+	cfn := pw.fn + ".chunk" + strconv.Itoa(len(pw.chunkFnArr))
+	fp, err := os.Create(cfn)
+	if err != nil {
+		log.Fatalf("[PathIndexWriter.writeChunk] file %s create error, err: %v\n", cfn, err)
+	}
+	buffp := bufio.NewWriterSize(fp, 1<<20)
+	var b [16]byte
+	for _, ie := range pw.idxArr {
+		binary.LittleEndian.PutUint64(b[0:], uint64(ie.ID))
+		binary.LittleEndian.PutUint64(b[8:], ie.Offset)
+		if _, err := buffp.Write(b[:]); err != nil {
+			log.Fatalf("[PathIndexWriter.writeChunk] write file: %s err: %v\n", cfn, err)
+		}
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[PathIndexWriter.writeChunk] write file: %s err: %v\n", cfn, err)
+	}
+	fp.Close()
+	pw.chunkFnArr = append(pw.chunkFnArr, cfn)
+	pw.idxArr = pw.idxArr[:0]
+}
+
+type chunkEntry struct {
+	readIndexEntry
+	chunk int
+}
+
+// chunkHeap is the min heap of the chunks head entries, the entries of the same read ID
+// ordered by chunk, keep the records order of read
+type chunkHeap []chunkEntry
+
+func (h chunkHeap) Len() int { return len(h) }
+func (h chunkHeap) Less(i, j int) bool {
+	return h[i].ID < h[j].ID || (h[i].ID == h[j].ID && h[i].chunk < h[j].chunk)
+}
+func (h chunkHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *chunkHeap) Push(x interface{}) { *h = append(*h, x.(chunkEntry)) }
+func (h *chunkHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func readChunkEntry(r io.Reader) (ie readIndexEntry, err error) {
+	var b [16]byte
+	if _, err = io.ReadFull(r, b[:]); err != nil {
+		return
+	}
+	ie.ID = int64(binary.LittleEndian.Uint64(b[0:]))
+	ie.Offset = binary.LittleEndian.Uint64(b[8:])
+	return
+}
+
+// writeReadIndex write the read index entries sorted by read ID, the chunk files merged and removed
+func (pw *PathIndexWriter) writeReadIndex() {
+	le := binary.LittleEndian
+	var lastID int64
+	var b [16]byte
+	write := func(ie readIndexEntry) {
+		if pw.header.ReadsNum == 0 || ie.ID != lastID {
+			pw.header.ReadsNum++
+			lastID = ie.ID
+		}
+		le.PutUint64(b[0:], uint64(ie.ID))
+		le.PutUint64(b[8:], ie.Offset)
+		if _, err := pw.buffp.Write(b[:]); err != nil {
+			log.Fatalf("[PathIndexWriter.writeReadIndex] write file: %s err: %v\n", pw.fn, err)
+		}
+	}
+	if len(pw.chunkFnArr) == 0 {
+		pw.sortIdxArr()
+		for _, ie := range pw.idxArr {
+			write(ie)
+		}
+		return
+	}
+	if len(pw.idxArr) > 0 {
+		pw.writeChunk()
+	}
+	readerArr := make([]*bufio.Reader, len(pw.chunkFnArr))
+	h := make(chunkHeap, 0, len(pw.chunkFnArr))
+	for i, cfn := range pw.chunkFnArr {
+		fp, err := os.Open(cfn)
+		if err != nil {
+			log.Fatalf("[PathIndexWriter.writeReadIndex] open file: %s err: %v\n", cfn, err)
+		}
+		defer os.Remove(cfn)
+		defer fp.Close()
+		readerArr[i] = bufio.NewReaderSize(fp, 1<<16)
+		if ie, err := readChunkEntry(readerArr[i]); err == nil {
+			h = append(h, chunkEntry{ie, i})
+		}
+	}
+	heap.Init(&h)
+	for h.Len() > 0 {
+		ce := h[0]
+		write(ce.readIndexEntry)
+		ie, err := readChunkEntry(readerArr[ce.chunk])
+		if err == nil {
+			h[0].readIndexEntry = ie
+			heap.Fix(&h, 0)
+		} else if err == io.EOF {
+			heap.Pop(&h)
+		} else {
+			log.Fatalf("[PathIndexWriter.writeReadIndex] read file: %s err: %v\n", pw.chunkFnArr[ce.chunk], err)
+		}
+	}
+}
+
+// buildPostings write the postings of edges [eLo, eHi) by scan the records
+func (pw *PathIndexWriter) buildPostings(eLo, eHi int, starts []uint64) {
+	base := starts[eLo]
+	buf := make([]uint64, starts[eHi]-base)
+	cursor := make([]uint64, eHi-eLo)
+	copy(cursor, starts[eLo:eHi])
+	sr := io.NewSectionReader(pw.fp, pathIndexHeaderSize, int64(pw.header.ReadIndexOffset-pathIndexHeaderSize))
+	buffp := bufio.NewReaderSize(sr, 1<<20)
+	offset := uint64(pathIndexHeaderSize)
+	for i := uint64(0); i < pw.header.RecordsNum; i++ {
+		rp, err := decodeReadPath(buffp)
+		if err != nil {
+			log.Fatalf("[buildPostings] decode file: %s err: %v\n", pw.fn, err)
+		}
+		for _, eID := range getWalkEdges(rp.EIDArr) {
+			if int(eID) >= eLo && int(eID) < eHi {
+				buf[cursor[int(eID)-eLo]-base] = offset
+				cursor[int(eID)-eLo]++
+			}
+		}
+		offset += uint64(12 + 4*len(rp.EIDArr))
+	}
+	b := make([]byte, 8*len(buf))
+	for i, v := range buf {
+		binary.LittleEndian.PutUint64(b[8*i:], v)
+	}
+	if _, err := pw.fp.WriteAt(b, int64(pw.header.PostingsOffset+8*base)); err != nil {
+		log.Fatalf("[buildPostings] write file: %s err: %v\n", pw.fn, err)
+	}
+}
+
+// Close write the read index, the postings and the edge index, the postings built by passes of
+// edge ID ranges that hold at most PathIndexMaxPostings postings in memory
+func (pw *PathIndexWriter) Close() {
+	le := binary.LittleEndian
+	pw.header.ReadIndexOffset = pw.offset
+	pw.writeReadIndex()
+	if err := pw.buffp.Flush(); err != nil {
+		log.Fatalf("[PathIndexWriter.Close] write file: %s err: %v\n", pw.fn, err)
+	}
+	pw.header.PostingsOffset = pw.header.ReadIndexOffset + 16*pw.header.RecordsNum
+	starts := make([]uint64, len(pw.edgeCount))
+	for i := 1; i < len(starts); i++ {
+		starts[i] = starts[i-1] + pw.edgeCount[i-1]
+	}
+	arrSize := len(starts) - 1
+	for eLo := 0; eLo < arrSize; {
+		eHi := eLo + 1
+		for eHi < arrSize && starts[eHi+1]-starts[eLo] <= PathIndexMaxPostings {
+			eHi++
+		}
+		pw.buildPostings(eLo, eHi, starts)
+		eLo = eHi
+	}
+	pw.header.EdgeIndexOffset = pw.header.PostingsOffset + 8*starts[arrSize]
+	index := make([]byte, 8*len(starts))
+	for i, s := range starts {
+		le.PutUint64(index[8*i:], s)
+	}
+	if _, err := pw.fp.WriteAt(index, int64(pw.header.EdgeIndexOffset)); err != nil {
+		log.Fatalf("[PathIndexWriter.Close] write file: %s err: %v\n", pw.fn, err)
+	}
+
+	var header [pathIndexHeaderSize]byte
+	copy(header[:4], PathIndexMagic)
+	le.PutUint32(header[4:], pw.header.Version)
+	le.PutUint32(header[8:], pw.header.Kmer)
+	le.PutUint32(header[12:], pw.header.ArrSize)
+	le.PutUint64(header[16:], pw.header.EdgesHash)
+	le.PutUint64(header[24:], pw.header.ReadsNum)
+	le.PutUint64(header[32:], pw.header.RecordsNum)
+	le.PutUint64(header[40:], pw.header.ReadIndexOffset)
+	le.PutUint64(header[48:], pw.header.EdgeIndexOffset)
+	le.PutUint64(header[56:], pw.header.PostingsOffset)
+	if _, err := pw.fp.WriteAt(header[:], 0); err != nil {
+		log.Fatalf("[PathIndexWriter.Close] write header of file: %s err: %v\n", pw.fn, err)
+	}
+	if err := pw.fp.Close(); err != nil {
+		log.Fatalf("[PathIndexWriter.Close] close file: %s err: %v\n", pw.fn, err)
+	}
+	pw.idxArr, pw.edgeCount = nil, nil
+}
+
+// PathIndexRecordsWriter write the read paths from pc to the index file, every producer goroutine
+// send nil at the end, the records number send to done after the index file closed
+func PathIndexRecordsWriter(fn string, pc <-chan []ReadPath, numCPU int, edgesArr []DBGEdge, kmerlen int, done chan<- int) {
+	pw := NewPathIndexWriter(fn, edgesArr, kmerlen)
+	var finishNum int
+	for rpArr := range pc {
+		if rpArr == nil {
+			finishNum++
+			if finishNum == numCPU {
+				break
+			}
+			continue
+		}
+		for _, rp := range rpArr {
+			pw.Add(rp)
+		}
+	}
+	recordsNum := int(pw.header.RecordsNum)
+	pw.Close()
+	fmt.Printf("[PathIndexRecordsWriter] write read paths num: %d to file: %s\n", recordsNum, fn)
+	done <- recordsNum
+}
+
+// PathIndexFile support the queries of read paths without load the whole file
+type PathIndexFile struct {
+	fp     *os.File
+	Header PathIndexHeader
+}
+
+// OpenPathIndex open the index file and check the header, edgesArr nil skip the check of DBG,
+// kmerlen <= 0 skip the check of K
+func OpenPathIndex(fn string, edgesArr []DBGEdge, kmerlen int) (pif *PathIndexFile, err error) {
+	fp, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	var header [pathIndexHeaderSize]byte
+	if _, err = io.ReadFull(fp, header[:]); err != nil {
+		fp.Close()
+		return nil, fmt.Errorf("read header of file: %s err: %v", fn, err)
+	}
+	if string(header[:4]) != PathIndexMagic {
+		fp.Close()
+		return nil, fmt.Errorf("file: %s is not a read paths index file", fn)
+	}
+	le := binary.LittleEndian
+	pif = &PathIndexFile{fp: fp}
+	pif.Header.Version = le.Uint32(header[4:])
+	pif.Header.Kmer = le.Uint32(header[8:])
+	pif.Header.ArrSize = le.Uint32(header[12:])
+	pif.Header.EdgesHash = le.Uint64(header[16:])
+	pif.Header.ReadsNum = le.Uint64(header[24:])
+	pif.Header.RecordsNum = le.Uint64(header[32:])
+	pif.Header.ReadIndexOffset = le.Uint64(header[40:])
+	pif.Header.EdgeIndexOffset = le.Uint64(header[48:])
+	pif.Header.PostingsOffset = le.Uint64(header[56:])
+	if pif.Header.Version != PathIndexVersion {
+		fp.Close()
+		return nil, fmt.Errorf("file: %s version: %d not supported, need version: %d", fn, pif.Header.Version, PathIndexVersion)
+	}
+	if kmerlen > 0 && int(pif.Header.Kmer) != kmerlen {
+		fp.Close()
+		return nil, fmt.Errorf("file: %s constructed by K: %d, but K set: %d", fn, pif.Header.Kmer, kmerlen)
+	}
+	if edgesArr != nil && (int(pif.Header.ArrSize) != len(edgesArr) || pif.Header.EdgesHash != GetEdgesHash(edgesArr)) {
+		fp.Close()
+		return nil, fmt.Errorf("file: %s not indexed by the DBG edges", fn)
+	}
+	return pif, nil
+}
+
+func (pif *PathIndexFile) Close() error {
+	return pif.fp.Close()
+}
+
+func (pif *PathIndexFile) readUint64(offset uint64) (uint64, error) {
+	var b [8]byte
+	if _, err := pif.fp.ReadAt(b[:], int64(offset)); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+func (pif *PathIndexFile) readRecord(offset uint64) (ReadPath, error) {
+	sr := io.NewSectionReader(pif.fp, int64(offset), int64(pif.Header.ReadIndexOffset-offset))
+	return decodeReadPath(bufio.NewReaderSize(sr, 256))
+}
+
+// GetReadPaths return the paths of read ID, pair reads not merged have two paths
+func (pif *PathIndexFile) GetReadPaths(id int64) (rpArr []ReadPath, err error) {
+	num := int(pif.Header.RecordsNum)
+	i := sort.Search(num, func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var v uint64
+		v, err = pif.readUint64(pif.Header.ReadIndexOffset + 16*uint64(i))
+		return int64(v) >= id
+	})
+	for ; err == nil && i < num; i++ {
+		var b [16]byte
+		if _, err = pif.fp.ReadAt(b[:], int64(pif.Header.ReadIndexOffset+16*uint64(i))); err != nil {
+			break
+		}
+		if int64(binary.LittleEndian.Uint64(b[0:])) != id {
+			break
+		}
+		var rp ReadPath
+		if rp, err = pif.readRecord(binary.LittleEndian.Uint64(b[8:])); err == nil {
+			rpArr = append(rpArr, rp)
+		}
+	}
+	return
+}
+
+func (pif *PathIndexFile) getEdgePostings(eID DBG_MAX_INT) (start, end uint64, err error) {
+	if uint32(eID) >= pif.Header.ArrSize {
+		err = fmt.Errorf("edge ID: %d >= edgesArr size: %d", eID, pif.Header.ArrSize)
+		return
+	}
+	var b [16]byte
+	if _, err = pif.fp.ReadAt(b[:], int64(pif.Header.EdgeIndexOffset+8*uint64(eID))); err != nil {
+		return
+	}
+	return binary.LittleEndian.Uint64(b[0:]), binary.LittleEndian.Uint64(b[8:]), nil
+}
+
+// GetEdgeReadsNum return the number of read paths crossing the edge
+func (pif *PathIndexFile) GetEdgeReadsNum(eID DBG_MAX_INT) (int, error) {
+	start, end, err := pif.getEdgePostings(eID)
+	return int(end - start), err
+}
+
+// ForEachEdgeRead call f for every read path crossing the edge until f return false,
+// the postings streamed from the file
+func (pif *PathIndexFile) ForEachEdgeRead(eID DBG_MAX_INT, f func(rp ReadPath) bool) error {
+	start, end, err := pif.getEdgePostings(eID)
+	if err != nil || start == end {
+		return err
+	}
+	sr := io.NewSectionReader(pif.fp, int64(pif.Header.PostingsOffset+8*start), int64(8*(end-start)))
+	buffp := bufio.NewReaderSize(sr, 1<<16)
+	var b [8]byte
+	for i := start; i < end; i++ {
+		if _, err := io.ReadFull(buffp, b[:]); err != nil {
+			return err
+		}
+		rp, err := pif.readRecord(binary.LittleEndian.Uint64(b[:]))
+		if err != nil {
+			return err
+		}
+		if !f(rp) {
+			break
+		}
+	}
+	return nil
+}
+
+// the key of path, the same for the reverse path
+func getPathKey(path []DBG_MAX_INT) string {
+	rp := GetReverseDBG_MAX_INTArr(path)
+	for i, eID := range path {
+		if eID < rp[i] {
+			break
+		} else if eID > rp[i] {
+			path = rp
+			break
+		}
+	}
+	b := make([]byte, 4*len(path))
+	for i, eID := range path {
+		binary.LittleEndian.PutUint32(b[4*i:], uint32(eID))
+	}
+	return string(b)
+}
+
+// AddPathIndexToDBGEdge add the read paths crossing the unique and semi-unique edges to the
+// PathMat of edges, the paths counted by the key map, return the number of paths added
+func AddPathIndexToDBGEdge(edgesArr []DBGEdge, pif *PathIndexFile) (pathNum int) {
+	for i, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 || (e.GetUniqueFlag() == 0 && e.GetSemiUniqueFlag() == 0) {
+			continue
+		}
+		pathMap := make(map[string]int)
+		for j, p := range e.PathMat {
+			pathMap[getPathKey(p.IDArr)] = j
+		}
+		err := pif.ForEachEdgeRead(e.ID, func(rp ReadPath) bool {
+			if len(rp.EIDArr) < 2 {
+				return true
+			}
+			key := getPathKey(rp.EIDArr)
+			if j, ok := pathMap[key]; ok {
+				edgesArr[i].PathMat[j].Freq++
+			} else {
+				pathMap[key] = len(edgesArr[i].PathMat)
+				edgesArr[i].PathMat = append(edgesArr[i].PathMat, Path{IDArr: rp.EIDArr, Freq: 1})
+				pathNum++
+			}
+			return true
+		})
+		if err != nil {
+			log.Fatalf("[AddPathIndexToDBGEdge] read paths of edge: %v err: %v\n", e.ID, err)
+		}
+	}
+	return
+}
+
+// IsWalkSupport return true if the walk contain edge A of strandA followed by edge B of strandB,
+// or the reverse B of !strandB followed by A of !strandA
+func IsWalkSupport(rp ReadPath, eIDA DBG_MAX_INT, strandA bool, eIDB DBG_MAX_INT, strandB bool) bool {
+	for i := 0; i < len(rp.EIDArr)-1; i++ {
+		e1, s1, e2, s2 := rp.EIDArr[i], rp.StrandArr[i], rp.EIDArr[i+1], rp.StrandArr[i+1]
+		if e1 == eIDA && s1 == strandA && e2 == eIDB && s2 == strandB {
+			return true
+		}
+		if e1 == eIDB && s1 == !strandB && e2 == eIDA && s2 == !strandA {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSupportReads return the IDs of reads support edge A of strandA followed by edge B of
+// strandB, scan the postings of the edge crossed by fewer reads
+func (pif *PathIndexFile) GetSupportReads(eIDA DBG_MAX_INT, strandA bool, eIDB DBG_MAX_INT, strandB bool) (idArr []int64, err error) {
+	numA, err := pif.GetEdgeReadsNum(eIDA)
+	if err != nil {
+		return
+	}
+	numB, err := pif.GetEdgeReadsNum(eIDB)
+	if err != nil {
+		return
+	}
+	eID := eIDA
+	if numB < numA {
+		eID = eIDB
+	}
+	err = pif.ForEachEdgeRead(eID, func(rp ReadPath) bool {
+		if IsWalkSupport(rp, eIDA, strandA, eIDB, strandB) {
+			idArr = append(idArr, rp.ID)
+		}
+		return true
+	})
+	return
+}
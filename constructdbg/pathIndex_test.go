@@ -0,0 +1,69 @@
+package constructdbg
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPathIndexChunks(t *testing.T) {
+	edgesArr := make([]DBGEdge, 6)
+	for i := 2; i < len(edgesArr); i++ {
+		edgesArr[i] = DBGEdge{ID: DBG_MAX_INT(i), Utg: Unitig{Ks: make([]byte, 10+i)}}
+		edgesArr[i].SetUniqueFlag()
+	}
+	rpArr := []ReadPath{
+		{9, []DBG_MAX_INT{2, 3}, []bool{PLUS, PLUS}},
+		{4, []DBG_MAX_INT{3, 4, 5}, []bool{PLUS, MINUS, PLUS}},
+		{7, []DBG_MAX_INT{5}, []bool{MINUS}},
+		{4, []DBG_MAX_INT{5, 2}, []bool{PLUS, PLUS}},
+		{1, []DBG_MAX_INT{3, 2}, []bool{MINUS, MINUS}},
+		{9, []DBG_MAX_INT{4}, []bool{PLUS}},
+		{2, []DBG_MAX_INT{2, 3}, []bool{PLUS, PLUS}},
+	}
+	fn := filepath.Join(t.TempDir(), "t.paths.idx")
+	pw := NewPathIndexWriter(fn, edgesArr, 7)
+	pw.chunkSize = 2
+	for _, rp := range rpArr {
+		pw.Add(rp)
+	}
+	pw.Close()
+	if matches, _ := filepath.Glob(fn + ".chunk*"); len(matches) > 0 {
+		t.Fatalf("chunk files not removed: %v", matches)
+	}
+
+	pif, err := OpenPathIndex(fn, edgesArr, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pif.Close()
+	if pif.Header.RecordsNum != uint64(len(rpArr)) || pif.Header.ReadsNum != 5 {
+		t.Fatalf("header: %+v", pif.Header)
+	}
+	for _, id := range []int64{1, 2, 4, 7, 9} {
+		var want []ReadPath
+		for _, rp := range rpArr {
+			if rp.ID == id {
+				want = append(want, rp)
+			}
+		}
+		got, err := pif.GetReadPaths(id)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("read ID: %d, paths: %v, want: %v, err: %v", id, got, want, err)
+		}
+	}
+	idArr, err := pif.GetSupportReads(2, PLUS, 3, PLUS)
+	sort.Slice(idArr, func(i, j int) bool { return idArr[i] < idArr[j] })
+	if err != nil || !reflect.DeepEqual(idArr, []int64{1, 2, 9}) {
+		t.Fatalf("support reads of 2+ 3+: %v, err: %v", idArr, err)
+	}
+
+	if pathNum := AddPathIndexToDBGEdge(edgesArr, pif); pathNum != 7 {
+		t.Fatalf("added paths num: %d, want: 7", pathNum)
+	}
+	want := []Path{{IDArr: []DBG_MAX_INT{2, 3}, Freq: 3}, {IDArr: []DBG_MAX_INT{5, 2}, Freq: 1}}
+	if !reflect.DeepEqual(edgesArr[2].PathMat, want) {
+		t.Fatalf("PathMat of edge 2: %v, want: %v", edgesArr[2].PathMat, want)
+	}
+}
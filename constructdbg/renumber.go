@@ -0,0 +1,115 @@
+package constructdbg
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/mudesheng/ga/bnt"
+)
+
+func lessUint64Arr(a, b []uint64) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// NormalizeEdgeStrand return the copy of edge that reverse complement if the reverse
+// complement sequence is smaller, the node slots of edge not changed by the strand of edge.
+// The quality Kq[j] is the count of kmer end at j, the first K-1 are zero
+func NormalizeEdgeStrand(e DBGEdge, kmerlen int) DBGEdge {
+	rs := GetReverseCompByteArr(e.Utg.Ks)
+	if bytes.Compare(rs, e.Utg.Ks) >= 0 {
+		return e
+	}
+	sl := len(e.Utg.Ks)
+	ne := e
+	ne.Utg.Ks = rs
+	ne.StartNID, ne.EndNID = e.EndNID, e.StartNID
+	if len(e.Utg.Kq) == sl && sl >= kmerlen {
+		ne.Utg.Kq = make([]uint8, sl)
+		for j := kmerlen - 1; j < sl; j++ {
+			ne.Utg.Kq[j] = e.Utg.Kq[sl-1-j+kmerlen-1]
+		}
+	}
+	return ne
+}
+
+// RenumberDBGCanonical return the DBG that the nodes ID assigned by the order of node kmer and
+// the edges ID by the order of canonical strand sequence, both start from 2, so the IDs not
+// depend on the goroutines completion order. The edges referenced by nodes but not in edgesArr
+// (tips not written) get the IDs after all edges by the order of new node ID and slot.
+// The nodesArr and edgesArr not changed
+func RenumberDBGCanonical(nodesArr []DBGNode, edgesArr []DBGEdge, kmerlen int) (newNodesArr []DBGNode, newEdgesArr []DBGEdge) {
+	var nIDArr, eIDArr []DBG_MAX_INT
+	normArr := make([]DBGEdge, len(edgesArr))
+	for i, nd := range nodesArr {
+		if i >= 2 && nd.ID == DBG_MAX_INT(i) && nd.GetDeleteFlag() == 0 {
+			nIDArr = append(nIDArr, nd.ID)
+		}
+	}
+	for i, e := range edgesArr {
+		if i >= 2 && e.ID == DBG_MAX_INT(i) && e.GetDeleteFlag() == 0 {
+			normArr[i] = NormalizeEdgeStrand(e, kmerlen)
+			eIDArr = append(eIDArr, e.ID)
+		}
+	}
+	sort.Slice(nIDArr, func(i, j int) bool { return lessUint64Arr(nodesArr[nIDArr[i]].Seq, nodesArr[nIDArr[j]].Seq) })
+	sort.Slice(eIDArr, func(i, j int) bool {
+		return bytes.Compare(normArr[eIDArr[i]].Utg.Ks, normArr[eIDArr[j]].Utg.Ks) < 0
+	})
+
+	nodeNewID := make(map[DBG_MAX_INT]DBG_MAX_INT, len(nIDArr))
+	for i, id := range nIDArr {
+		nodeNewID[id] = DBG_MAX_INT(i + 2)
+	}
+	edgeNewID := make(map[DBG_MAX_INT]DBG_MAX_INT, len(eIDArr))
+	for i, id := range eIDArr {
+		edgeNewID[id] = DBG_MAX_INT(i + 2)
+	}
+	// the edges referenced by nodes but not exist
+	nextEID := DBG_MAX_INT(len(eIDArr) + 2)
+	for _, id := range nIDArr {
+		nd := nodesArr[id]
+		for s := 0; s < 2*bnt.BaseTypeNum; s++ {
+			eID := getNodeSlot(nd, s)
+			if eID < 2 {
+				continue
+			}
+			if _, ok := edgeNewID[eID]; !ok {
+				edgeNewID[eID] = nextEID
+				nextEID++
+			}
+		}
+	}
+
+	newNodesArr = make([]DBGNode, len(nIDArr)+2)
+	for i, id := range nIDArr {
+		nd := nodesArr[id]
+		nd.ID = DBG_MAX_INT(i + 2)
+		for j := 0; j < bnt.BaseTypeNum; j++ {
+			if nd.EdgeIDIncoming[j] > 1 {
+				nd.EdgeIDIncoming[j] = edgeNewID[nd.EdgeIDIncoming[j]]
+			}
+			if nd.EdgeIDOutcoming[j] > 1 {
+				nd.EdgeIDOutcoming[j] = edgeNewID[nd.EdgeIDOutcoming[j]]
+			}
+		}
+		newNodesArr[nd.ID] = nd
+	}
+	newEdgesArr = make([]DBGEdge, nextEID)
+	for i, id := range eIDArr {
+		e := normArr[id]
+		e.ID = DBG_MAX_INT(i + 2)
+		if e.StartNID > 1 {
+			e.StartNID = nodeNewID[e.StartNID]
+		}
+		if e.EndNID > 1 {
+			e.EndNID = nodeNewID[e.EndNID]
+		}
+		newEdgesArr[e.ID] = e
+	}
+	return
+}
@@ -0,0 +1,201 @@
+package constructdbg
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/io/seqio/fasta"
+	"github.com/biogo/biogo/seq/linear"
+	"github.com/jwaldrip/odin/cli"
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/utils"
+)
+
+// GetNeighborEdgeIDArr return the edges linked by the StartNID and EndNID of the edge
+func GetNeighborEdgeIDArr(e DBGEdge, nodesArr []DBGNode, edgesArr []DBGEdge) (eArr []DBG_MAX_INT) {
+	for _, nID := range [2]DBG_MAX_INT{e.StartNID, e.EndNID} {
+		if nID < 2 {
+			continue
+		}
+		nd := nodesArr[nID]
+		for i := 0; i < bnt.BaseTypeNum; i++ {
+			for _, id := range [2]DBG_MAX_INT{nd.EdgeIDIncoming[i], nd.EdgeIDOutcoming[i]} {
+				if id < 2 || id == e.ID || edgesArr[id].GetDeleteFlag() > 0 {
+					continue
+				}
+				if IndexEID(eArr, id) < 0 {
+					eArr = append(eArr, id)
+				}
+			}
+		}
+	}
+	return
+}
+
+// ExtractSubGraph select the edges around the seed edges, if bpMode is false, radius is the
+// hop count from seed edges, else radius is the sequence distance(bp) from the seed edges end
+func ExtractSubGraph(nodesArr []DBGNode, edgesArr []DBGEdge, seedArr []DBG_MAX_INT, radius int, bpMode bool, kmerlen int) (edgeSet []bool) {
+	edgeSet = make([]bool, len(edgesArr))
+	dist := make([]int, len(edgesArr))
+	var queue []DBG_MAX_INT
+	for _, eID := range seedArr {
+		if int(eID) >= len(edgesArr) || edgesArr[eID].ID < 2 || edgesArr[eID].GetDeleteFlag() > 0 {
+			log.Fatalf("[ExtractSubGraph] edge ID: %v not found in the DBG\n", eID)
+		}
+		edgeSet[eID] = true
+		queue = append(queue, eID)
+	}
+	isSeed := func(eID DBG_MAX_INT) bool { return IndexEID(seedArr, eID) >= 0 }
+
+	// relax the distance until no shorter distance found
+	for len(queue) > 0 {
+		eID := queue[0]
+		queue = queue[1:]
+		d := dist[eID] + 1
+		if bpMode {
+			d = dist[eID]
+			if !isSeed(eID) {
+				d += len(edgesArr[eID].Utg.Ks) - (kmerlen - 1)
+			}
+		}
+		if d > radius {
+			continue
+		}
+		for _, id := range GetNeighborEdgeIDArr(edgesArr[eID], nodesArr, edgesArr) {
+			if edgeSet[id] && dist[id] <= d {
+				continue
+			}
+			edgeSet[id] = true
+			dist[id] = d
+			queue = append(queue, id)
+		}
+	}
+	return
+}
+
+// GraphvizSubDBG write the edges of edgeSet to the dot file, edges labeled by length,
+// coverage and unique flag
+func GraphvizSubDBG(nodesArr []DBGNode, edgesArr []DBGEdge, edgeSet []bool, graphfn string) {
+	g := gographviz.NewGraph()
+	g.SetName("G")
+	g.SetDir(true)
+	g.SetStrict(false)
+	nodeSet := make(map[DBG_MAX_INT]bool)
+	for i, e := range edgesArr {
+		if !edgeSet[i] {
+			continue
+		}
+		nodeSet[e.StartNID] = true
+		nodeSet[e.EndNID] = true
+	}
+	for nID := range nodeSet {
+		attr := make(map[string]string)
+		if nID > 0 {
+			attr["color"] = "Green"
+			attr["shape"] = "record"
+			attr["label"] = "\"" + strconv.Itoa(int(nodesArr[nID].ID)) + "\""
+		}
+		g.AddNode("G", strconv.Itoa(int(nID)), attr)
+	}
+	for i, e := range edgesArr {
+		if !edgeSet[i] {
+			continue
+		}
+		attr := make(map[string]string)
+		attr["color"] = "Blue"
+		if e.GetUniqueFlag() > 0 {
+			attr["color"] = "Red"
+		}
+		attr["label"] = "\"ID:" + strconv.Itoa(int(e.ID)) + " len:" + strconv.Itoa(len(e.Utg.Ks)) + " cov:" + strconv.Itoa(int(e.CovD)) + " " + GetEdgeUniqueLabel(e) + "\""
+		g.AddEdge(strconv.Itoa(int(e.StartNID)), strconv.Itoa(int(e.EndNID)), true, attr)
+	}
+	gfp, err := os.Create(graphfn)
+	if err != nil {
+		log.Fatalf("[GraphvizSubDBG] Create file: %s failed, err: %v\n", graphfn, err)
+	}
+	defer gfp.Close()
+	gfp.WriteString(g.String())
+}
+
+// StoreSubEdgesToFa write the edges sequence of edgeSet to the fasta file
+func StoreSubEdgesToFa(edgesfn string, edgesArr []DBGEdge, edgeSet []bool) {
+	fp, err := os.Create(edgesfn)
+	if err != nil {
+		log.Fatalf("[StoreSubEdgesToFa] create file: %s failed, err: %v\n", edgesfn, err)
+	}
+	defer fp.Close()
+	fafp := fasta.NewWriter(fp, 80)
+	for i, e := range edgesArr {
+		if !edgeSet[i] {
+			continue
+		}
+		seq := linear.NewSeq("", nil, alphabet.DNA)
+		seq.ID = strconv.Itoa(int(e.ID))
+		seq.AppendLetters(Transform2Letters(e.Utg.Ks)...)
+		ans := strconv.Itoa(int(e.StartNID)) + "\t" + strconv.Itoa(int(e.EndNID)) + "\tlen:" + strconv.Itoa(seq.Len()) + "\tcov:" + strconv.Itoa(int(e.CovD)) + "\t" + GetEdgeUniqueLabel(e)
+		seq.Annotation.SetDescription(ans)
+		if _, err := fafp.Write(seq); err != nil {
+			log.Fatalf("[StoreSubEdgesToFa] write seq: %v; err: %v\n", seq, err)
+		}
+	}
+}
+
+// parse the radius argument, "5" denote 5 hops and "5000bp" denote 5000 bases
+func parseRadius(r string) (radius int, bpMode bool, err error) {
+	if strings.HasSuffix(r, "bp") {
+		bpMode = true
+		r = r[:len(r)-2]
+	}
+	radius, err = strconv.Atoi(r)
+	if err == nil && radius < 0 {
+		err = fmt.Errorf("radius: %v must >= 0", radius)
+	}
+	return
+}
+
+func SubGraph(c cli.Command) {
+	opt, suc := utils.CheckGlobalArgs(c.Parent())
+	if suc == false {
+		log.Fatalf("[SubGraph] check global Arguments error, opt: %v\n", opt)
+	}
+	stage := c.Flag("stage").String()
+	es := c.Flag("e").String()
+	if es == "" {
+		log.Fatalf("[SubGraph] argument 'e' not set\n")
+	}
+	var seedArr []DBG_MAX_INT
+	for _, s := range strings.Split(es, ",") {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			log.Fatalf("[SubGraph] argument 'e': %v set error, err: %v\n", es, err)
+		}
+		seedArr = append(seedArr, DBG_MAX_INT(id))
+	}
+	radius, bpMode, err := parseRadius(c.Flag("r").String())
+	if err != nil {
+		log.Fatalf("[SubGraph] argument 'r': %v set error, err: %v\n", c.Flag("r").String(), err)
+	}
+
+	nodesArr, edgesArr := LoadStageDBG(opt.Prefix, stage, opt.Kmer, opt.NumCPU)
+	ResetDBGEdgesUniqueFlag(edgesArr)
+	SetDBGEdgesUniqueFlag(edgesArr, nodesArr)
+	edgeSet := ExtractSubGraph(nodesArr, edgesArr, seedArr, radius, bpMode, opt.Kmer)
+	var num int
+	for _, ok := range edgeSet {
+		if ok {
+			num++
+		}
+	}
+	fmt.Printf("[SubGraph] extract edges number: %d around edges: %v\n", num, seedArr)
+
+	subPrefix := opt.Prefix + "." + stage + ".subgraph"
+	GraphvizSubDBG(nodesArr, edgesArr, edgeSet, subPrefix+".dot")
+	dc := LoadStageDBGColors(opt.Prefix, stage, edgesArr)
+	GFAWriter(nodesArr, edgesArr, edgeSet, dc, subPrefix+".gfa", opt.Kmer)
+	StoreSubEdgesToFa(subPrefix+".fa", edgesArr, edgeSet)
+}
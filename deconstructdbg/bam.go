@@ -3061,13 +3061,17 @@ func cleanLRRecordArr(arr []LRRecord, flankAllow int) []LRRecord {
 	return arr
 }
 
-func paraFindLongReadsMappingPath(rc <-chan []PAFInfo, wc chan [2][]constructdbg.DBG_MAX_INT, edgesArr []constructdbg.DBGEdge, nodesArr []constructdbg.DBGNode, opt Options) {
+// paraFindLongReadsMappingPath find the mapping path of long reads, the GAF records of paths send to gc if gc not nil
+func paraFindLongReadsMappingPath(rc <-chan []PAFInfo, wc chan [2][]constructdbg.DBG_MAX_INT, gc chan<- []constructdbg.GAFRecord, edgesArr []constructdbg.DBGEdge, nodesArr []constructdbg.DBGNode, opt Options) {
 	//fragmentFreq := make([]int, 100)
 	for {
 		rArr, ok := <-rc
 		if !ok {
 			var guardPath [2][]constructdbg.DBG_MAX_INT
 			wc <- guardPath
+			if gc != nil {
+				gc <- nil
+			}
 			break
 		}
 
@@ -3076,6 +3080,20 @@ func paraFindLongReadsMappingPath(rc <-chan []PAFInfo, wc chan [2][]constructdbg
 		for i, R := range rArr {
 			arr[i] = ConvertLRRecord(R)
 		}
+		// the edges of other components have been masked
+		if opt.Comp > 0 {
+			j := 0
+			for _, R := range arr {
+				if int(R.RefID) < len(edgesArr) && edgesArr[R.RefID].GetDeleteFlag() == 0 {
+					arr[j] = R
+					j++
+				}
+			}
+			arr = arr[:j]
+			if len(arr) == 0 {
+				continue
+			}
+		}
 
 		// clean not whole length match
 		/*flankdiff := 20
@@ -3131,6 +3149,11 @@ func paraFindLongReadsMappingPath(rc <-chan []PAFInfo, wc chan [2][]constructdbg
 		fmt.Printf("[paraFindLongReadsMappingPath]path: %v\n", path)
 		if len(path[0]) >= 2 {
 			wc <- path
+			if gc != nil {
+				if g, ok := GetLongReadGAFRecord(rArr[0].Sa[0], arr, path[0], edgesArr, nodesArr, opt.Kmer, flankAllow); ok {
+					gc <- []constructdbg.GAFRecord{g}
+				}
+			}
 		}
 	}
 	/*for i, v := range fragmentFreq {
@@ -1164,6 +1164,11 @@ type Options struct {
 	ExtLen        int
 	ONTFn         string
 	Correct       bool
+	Comp          int // process only the component with the ID, 0 for whole DBG
+	GAF           bool
+	Align         bool // align long reads by the built-in aligner instead of the minimap2 PAF
+	Seed          int  // minimizer length of the built-in aligner
+	Width         int  // minimizer window of the built-in aligner
 }
 
 func checkArgs(c cli.Command) (opt Options, succ bool) {
@@ -1235,6 +1240,29 @@ func checkArgs(c cli.Command) (opt Options, succ bool) {
 	}
 
 	opt.ONTFn = c.Flag("LongReadFile").String()
+	opt.Comp, ok = c.Flag("Comp").Get().(int)
+	if !ok || opt.Comp < 0 {
+		log.Fatalf("[checkArgs] argument 'Comp': %v set error, must >= 0\n", c.Flag("Comp").String())
+	}
+	opt.GAF = c.Flag("GAF").Get().(bool)
+	opt.Align, ok = c.Flag("Align").Get().(bool)
+	if !ok {
+		log.Fatalf("[checkArgs] argument 'Align': %v set error\n ", c.Flag("Align").String())
+	}
+	opt.Seed, ok = c.Flag("Seed").Get().(int)
+	if !ok {
+		log.Fatalf("[checkArgs] argument 'Seed': %v set error\n ", c.Flag("Seed").String())
+	}
+	if opt.Seed < 8 || opt.Seed > 16 {
+		log.Fatalf("[checkArgs] argument 'Seed': %v must between 8~16\n", c.Flag("Seed").String())
+	}
+	opt.Width, ok = c.Flag("Width").Get().(int)
+	if !ok {
+		log.Fatalf("[checkArgs] argument 'Width': %v set error\n ", c.Flag("Width").String())
+	}
+	if opt.Width < 1 || opt.Width > 100 {
+		log.Fatalf("[checkArgs] argument 'Width': %v must between 1~100\n", c.Flag("Width").String())
+	}
 
 	succ = true
 	return opt, succ
@@ -1247,7 +1275,7 @@ func DeconstructDBG(c cli.Command) {
 		log.Fatalf("[Smfy] check global Arguments error, opt: %v\n", gOpt)
 	}
 
-	opt := Options{gOpt, 0, 0, 0, 0, 0, "", false}
+	opt := Options{gOpt, 0, 0, 0, 0, 0, "", false, 0, false, false, 0, 0}
 	tmp, suc := checkArgs(c)
 	if suc == false {
 		log.Fatalf("[Smfy] check Arguments error, opt: %v\n", tmp)
@@ -1261,10 +1289,20 @@ func DeconstructDBG(c cli.Command) {
 	opt.ExtLen = tmp.ExtLen
 	opt.ONTFn = tmp.ONTFn
 	opt.Correct = tmp.Correct
+	opt.Comp = tmp.Comp
+	opt.GAF = tmp.GAF
+	opt.Align = tmp.Align
+	opt.Seed = tmp.Seed
+	opt.Width = tmp.Width
 	//constructdbg.Kmerlen = opt.Kmer
 	fmt.Printf("Arguments: %v\n", opt)
+	// output of the component with prefix: "-p.comp<Comp>"
+	outPrefix := opt.Prefix
+	if opt.Comp > 0 {
+		outPrefix += ".comp" + strconv.Itoa(opt.Comp)
+	}
 
-	profileFn := opt.Prefix + ".decdbg.prof"
+	profileFn := outPrefix + ".decdbg.prof"
 	cpuprofilefp, err := os.Create(profileFn)
 	if err != nil {
 		log.Fatalf("[CCF] open cpuprofile file: %v failed\n", profileFn)
@@ -1276,13 +1314,15 @@ func DeconstructDBG(c cli.Command) {
 	DBGInfofn := opt.Prefix + ".smfy.DBGInfo"
 	eSize, nSize := constructdbg.DBGInfoReader(DBGInfofn)
 	nodesfn := opt.Prefix + ".nodes.smfy.Arr"
-	nodesArr := constructdbg.NodesArrReader(nodesfn)
+	nodesArr := constructdbg.NodesArrReader(nodesfn, opt.Kmer)
 	if len(nodesArr) != nSize {
 		log.Fatalf("[DeconstructDBG] len(nodesArr): %v != nodesArr Size: %v in file: %v\n", len(nodesArr), nSize, DBGInfofn)
 	}
-	edgesArr := make([]constructdbg.DBGEdge, eSize)
-	edgesfn := opt.Prefix + ".edges.smfy.fq"
-	constructdbg.LoadEdgesfqFromFn(edgesfn, edgesArr, true)
+	edgesArr := constructdbg.LoadSmfyEdgesArr(opt.Prefix, eSize, opt.Kmer, opt.NumCPU)
+	if opt.Comp > 0 {
+		comp := constructdbg.MaskOtherComponents(nodesArr, edgesArr, opt.Comp)
+		fmt.Printf("[DeconstructDBG] component ID: %d, edges number: %d, total length: %d\n", comp.ID, len(comp.EdgeIDArr), comp.TotalLen)
+	}
 
 	constructdbg.CheckInterConnectivity(edgesArr, nodesArr)
 
@@ -1304,25 +1344,41 @@ func DeconstructDBG(c cli.Command) {
 	// get ont reads mapping info by minimap2
 	//paffn := opt.Prefix + ".paf"
 
-	// get ont Long reads Mapping info by minimap2, must use ont or other Long reads as reference, and smfy edges as query
-	paffn := opt.Prefix + ".paf"
 	rc := make(chan []PAFInfo, opt.NumCPU)
 	wc := make(chan [2][]constructdbg.DBG_MAX_INT, opt.NumCPU)
 
-	go GetPAFRecord(paffn, opt.ONTFn, rc, opt.NumCPU)
+	var gc chan []constructdbg.GAFRecord
+	gafDone := make(chan int, 1)
+	if opt.GAF {
+		gc = make(chan []constructdbg.GAFRecord, opt.NumCPU)
+		go constructdbg.GAFRecordsWriter(outPrefix+".LR.gaf", gc, opt.NumCPU, gafDone)
+	}
+
+	if opt.Align {
+		// built-in aligner by the minimizers index of smfy edges
+		skArr := constructdbg.GetEdgesMinKmerIndex(edgesArr, opt.Seed, opt.Width, opt.NumCPU)
+		go AlignLongReads(opt.ONTFn, skArr, edgesArr, opt, rc)
+	} else {
+		// get ont Long reads Mapping info by minimap2, must use ont or other Long reads as reference, and smfy edges as query
+		paffn := opt.Prefix + ".paf"
+		go GetPAFRecord(paffn, opt.ONTFn, rc, opt.NumCPU)
+	}
 
 	for i := 0; i < opt.NumCPU; i++ {
-		go paraFindLongReadsMappingPath(rc, wc, edgesArr, nodesArr, opt)
+		go paraFindLongReadsMappingPath(rc, wc, gc, edgesArr, nodesArr, opt)
 	}
 
 	pathArr := WriteLongPathToDBG(wc, edgesArr, opt.NumCPU)
+	if gc != nil {
+		<-gafDone
+	}
 
 	// Simplify using Long Reads Mapping info
 	joinPathArr := SimplifyByLongReadsPath(edgesArr, nodesArr, pathArr, opt)
 
-	graphfn := opt.Prefix + ".afterLR.dot"
+	graphfn := outPrefix + ".afterLR.dot"
 	constructdbg.GraphvizDBGArr(nodesArr, edgesArr, graphfn)
-	DcDBGEdgesfn := opt.Prefix + ".edges.DcDBG.fq"
+	DcDBGEdgesfn := outPrefix + ".edges.DcDBG.fq"
 	ExtractSeq(edgesArr, nodesArr, joinPathArr, DcDBGEdgesfn, opt.Kmer)
 	//constructdbg.StoreEdgesToFn(DcDBGEdgesfn, edgesArr)
 }
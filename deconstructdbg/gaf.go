@@ -0,0 +1,75 @@
+package deconstructdbg
+
+import (
+	"fmt"
+
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+// get the start and end of record R on the walk of path, the edge of R at path[idx]
+func getWalkPos(R LRRecord, path []constructdbg.DBG_MAX_INT, idx int, edgesArr []constructdbg.DBGEdge, kmerlen int) (ps, pe int) {
+	offset := constructdbg.GetWalkLen(path[:idx+1], edgesArr, kmerlen) - len(edgesArr[path[idx]].Utg.Ks)
+	if R.Strand == constructdbg.PLUS {
+		return offset + R.RefStart, offset + R.RefEnd
+	}
+	return offset + R.RefLen - R.RefEnd, offset + R.RefLen - R.RefStart
+}
+
+// GetLongReadGAFRecord return the GAF record of the long read mapping path, the strand of
+// edges deduced from the seed record, the ends of alignment taken from the first and last
+// records on the path edges with consistent strand, ok is false if the seed edge not in the
+// path or the records not colinear with the path
+func GetLongReadGAFRecord(name string, arr []LRRecord, path []constructdbg.DBG_MAX_INT, edgesArr []constructdbg.DBGEdge, nodesArr []constructdbg.DBGNode, kmerlen, flankAllow int) (g constructdbg.GAFRecord, ok bool) {
+	pos := findSeedEID(arr, edgesArr, flankAllow)
+	if pos < 0 {
+		return
+	}
+	sr := arr[pos]
+	idx := constructdbg.IndexEID(path, sr.RefID)
+	if idx < 0 {
+		return
+	}
+	strandArr := make([]bool, len(path))
+	strandArr[idx] = sr.Strand
+	for i := idx + 1; i < len(path); i++ {
+		strandArr[i] = GetNextEdgeStrand(edgesArr[path[i-1]], edgesArr[path[i]], nodesArr, strandArr[i-1])
+	}
+	for i := idx - 1; i >= 0; i-- {
+		strandArr[i] = GetNextEdgeStrand(edgesArr[path[i+1]], edgesArr[path[i]], nodesArr, strandArr[i+1])
+	}
+
+	// the first and last records of read on the path, matches of the records
+	first, last := -1, -1
+	for j, R := range arr {
+		i := constructdbg.IndexEID(path, R.RefID)
+		if i < 0 || strandArr[i] != R.Strand {
+			continue
+		}
+		if first < 0 || R.Start < arr[first].Start {
+			first = j
+		}
+		if last < 0 || R.End > arr[last].End {
+			last = j
+		}
+		g.Match += R.MapNum
+	}
+	g.PStart, _ = getWalkPos(arr[first], path, constructdbg.IndexEID(path, arr[first].RefID), edgesArr, kmerlen)
+	_, g.PEnd = getWalkPos(arr[last], path, constructdbg.IndexEID(path, arr[last].RefID), edgesArr, kmerlen)
+	if g.PEnd <= g.PStart {
+		return g, false
+	}
+	g.QName = name
+	g.QLen = sr.Len
+	g.QStart, g.QEnd = arr[first].Start, arr[last].End
+	g.EIDArr = path
+	g.StrandArr = strandArr
+	g.PLen = constructdbg.GetWalkLen(path, edgesArr, kmerlen)
+	g.BlockLen = constructdbg.MaxInt(g.QEnd-g.QStart, g.PEnd-g.PStart)
+	if g.Match > g.BlockLen {
+		g.Match = g.BlockLen
+	}
+	g.MapQ = constructdbg.GAFMissingMapQ
+	g.Tags = append(g.Tags, fmt.Sprintf("se:i:%d", sr.RefID))
+	ok = true
+	return
+}
@@ -0,0 +1,364 @@
+package deconstructdbg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/io/seqio/fasta"
+	"github.com/biogo/biogo/seq/linear"
+	"github.com/mudesheng/ga/cbrotli"
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+const (
+	LRMaxSeedOcc       = 50   // the minimizer occur more than this in the edges skipped as repeat
+	LRMaxChainGap      = 500  // max distance of adjacent anchors in the chain
+	LRChainLookBack    = 50   // number of previous anchors tried in the chaining
+	LRMinChainScore    = 60   // min chain score of a record output
+	LRMaxExtendLen     = 2000 // max edge length extended from the chain end
+	LRMinExtendMchRate = 60   // min percent of edge bases matched by the end extension
+)
+
+type anchorKey struct {
+	EID    constructdbg.DBG_MAX_INT
+	Strand bool
+}
+
+// getSeedHits return the minimizers of edges index with the kmer
+func getSeedHits(skArr []constructdbg.SeedKmerInfo, kmer uint32) []constructdbg.SeedKmerInfo {
+	i := sort.Search(len(skArr), func(i int) bool { return skArr[i].Kmer >= kmer })
+	j := i
+	for ; j < len(skArr) && skArr[j].Kmer == kmer; j++ {
+	}
+	return skArr[i:j]
+}
+
+// CollectAnchors return the minimizer anchors of read to the edges, Y is the position of the read
+// strand mapped, the reverse complement read for the MINUS strand
+func CollectAnchors(readSeq []byte, skArr []constructdbg.SeedKmerInfo, seed, width int) map[anchorKey][]Chain {
+	anchorMap := make(map[anchorKey][]Chain)
+	for _, m := range constructdbg.GetMinKmerArr(0, readSeq, seed, width) {
+		hits := getSeedHits(skArr, m.Kmer)
+		if len(hits) > LRMaxSeedOcc {
+			continue
+		}
+		rp, rs := int((m.Info>>1)&0x7FFFFFFF), m.Info&0x1
+		for _, h := range hits {
+			var k anchorKey
+			k.EID = constructdbg.DBG_MAX_INT(h.Info >> 32)
+			ch := Chain{X: uint32((h.Info >> 1) & 0x7FFFFFFF), Len: uint32(seed)}
+			if h.Info&0x1 == rs {
+				k.Strand = constructdbg.PLUS
+				ch.Y = uint32(rp)
+			} else {
+				k.Strand = constructdbg.MINUS
+				ch.Y = uint32(len(readSeq) - rp - seed)
+			}
+			anchorMap[k] = append(anchorMap[k], ch)
+		}
+	}
+	return anchorMap
+}
+
+// chainDP sort the anchors and return the best chain score ending at every anchor and
+// the previous anchor of the chain
+func chainDP(arr []Chain, seed int) (f, prev []int) {
+	sort.Slice(arr, func(i, j int) bool {
+		if arr[i].X != arr[j].X {
+			return arr[i].X < arr[j].X
+		}
+		return arr[i].Y < arr[j].Y
+	})
+	f = make([]int, len(arr))
+	prev = make([]int, len(arr))
+	for i, ch := range arr {
+		f[i], prev[i] = seed, -1
+		for j := i - 1; j >= 0 && j >= i-LRChainLookBack; j-- {
+			dx, dy := int(ch.X)-int(arr[j].X), int(ch.Y)-int(arr[j].Y)
+			if dx > LRMaxChainGap {
+				break
+			}
+			if dx <= 0 || dy <= 0 || dy > LRMaxChainGap {
+				continue
+			}
+			diff := dx - dy
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff > constructdbg.Min(dx, dy)/5+20 {
+				continue
+			}
+			sc := f[j] + constructdbg.Min(constructdbg.Min(dx, dy), seed) - diff/4
+			if diff > 0 {
+				sc--
+			}
+			if sc > f[i] {
+				f[i], prev[i] = sc, j
+			}
+		}
+	}
+	return
+}
+
+// ChainAnchors return the best collinear chain of anchors and the chain score
+func ChainAnchors(arr []Chain, seed int) (chainA []Chain, score int) {
+	f, prev := chainDP(arr, seed)
+	best := -1
+	for i := range f {
+		if best < 0 || f[i] > f[best] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return
+	}
+	score = f[best]
+	for i := best; i >= 0; i = prev[i] {
+		chainA = append(chainA, arr[i])
+	}
+	for i, j := 0, len(chainA)-1; i < j; i, j = i+1, j-1 {
+		chainA[i], chainA[j] = chainA[j], chainA[i]
+	}
+	return
+}
+
+// ChainAnchorsArr return the collinear chains of anchors with score not lower than minScore, the chains
+// not share anchors and not overlap in the read with the higher scored chain, sorted by score
+func ChainAnchorsArr(arr []Chain, seed, minScore int) (chainArr [][]Chain, scoreArr []int) {
+	f, prev := chainDP(arr, seed)
+	idxArr := make([]int, len(arr))
+	for i := range idxArr {
+		idxArr[i] = i
+	}
+	sort.SliceStable(idxArr, func(i, j int) bool { return f[idxArr[i]] > f[idxArr[j]] })
+	used := make([]bool, len(arr))
+	for _, e := range idxArr {
+		if f[e] < minScore {
+			break
+		}
+		if used[e] {
+			continue
+		}
+		var chainA []Chain
+		i := e
+		for ; i >= 0 && !used[i]; i = prev[i] {
+			used[i] = true
+			chainA = append(chainA, arr[i])
+		}
+		// the chain stopped at the anchor of a higher scored chain
+		score := f[e]
+		if i >= 0 {
+			score -= f[i]
+		}
+		if score < minScore {
+			continue
+		}
+		for l, r := 0, len(chainA)-1; l < r; l, r = l+1, r-1 {
+			chainA[l], chainA[r] = chainA[r], chainA[l]
+		}
+		y0, y1 := chainA[0].Y, chainA[len(chainA)-1].Y+chainA[len(chainA)-1].Len
+		overlap := false
+		for _, ca := range chainArr {
+			if y0 < ca[len(ca)-1].Y+ca[len(ca)-1].Len && ca[0].Y < y1 {
+				overlap = true
+				break
+			}
+		}
+		if !overlap {
+			chainArr = append(chainArr, chainA)
+			scoreArr = append(scoreArr, score)
+		}
+	}
+	return
+}
+
+// getNoOverlapChainArr merge the overlap anchors of same diagonal and extend the anchors by the exact
+// matches to the next, the result no overlap and every region between two chains start with mismatch
+func getNoOverlapChainArr(chainA []Chain, edgeSeq, readSeq []byte) (na []Chain) {
+	for _, ch := range chainA {
+		if len(na) == 0 {
+			na = append(na, ch)
+			continue
+		}
+		lch := &na[len(na)-1]
+		if ch.X < lch.X+lch.Len || ch.Y < lch.Y+lch.Len {
+			if ch.X-lch.X == ch.Y-lch.Y && ch.X+ch.Len > lch.X+lch.Len {
+				lch.Len = ch.X + ch.Len - lch.X
+			}
+			continue
+		}
+		for lch.X+lch.Len < ch.X && lch.Y+lch.Len < ch.Y && edgeSeq[lch.X+lch.Len] == readSeq[lch.Y+lch.Len] {
+			lch.Len++
+		}
+		if lch.X+lch.Len == ch.X && lch.Y+lch.Len == ch.Y {
+			lch.Len += ch.Len
+			continue
+		}
+		na = append(na, ch)
+	}
+	return
+}
+
+// extendChainEnd align the flank of edge out of the chain end to the read by GlobalAlignment, return
+// the length of read aligned, ok is false if the flank too long or not well matched
+func extendChainEnd(edgeFlank, readFlank []byte) (cg CIGAR, readLen int, ok bool) {
+	if len(edgeFlank) == 0 {
+		ok = true
+		return
+	}
+	if len(edgeFlank) > LRMaxExtendLen || len(readFlank) == 0 {
+		return
+	}
+	cg, readLen = GlobalAlignment(edgeFlank, readFlank, true)
+	if readLen < 0 || int(cg.Mch)*100 < len(edgeFlank)*LRMinExtendMchRate {
+		return
+	}
+	ok = true
+	return
+}
+
+// AlignLongReadToEdge align the read strand to the edge by the chain, the ends of chain extended to the
+// edge ends if possible
+func AlignLongReadToEdge(edgeSeq, readSeq []byte, chainA []Chain) (lrd LRRecord) {
+	chainA = getNoOverlapChainArr(chainA, edgeSeq, readSeq)
+	fc, lc := chainA[0], chainA[len(chainA)-1]
+	x0, y0 := int(fc.X), int(fc.Y)
+	xe, ye := int(lc.X+lc.Len), int(lc.Y+lc.Len)
+	subA := make([]Chain, len(chainA))
+	for i, ch := range chainA {
+		subA[i] = Chain{X: ch.X - fc.X, Y: ch.Y - fc.Y, Len: ch.Len}
+	}
+	cg := DPLocalAlign(edgeSeq[x0:xe], readSeq[y0:ye], subA)
+	lrd.Ins, lrd.Del, lrd.Mis, lrd.Mch = int(cg.Ins), int(cg.Del), int(cg.Mis), int(cg.Mch)
+
+	// left flank align reverse sequence
+	rl := constructdbg.Min(y0, x0+x0/4+20)
+	lcg, l, ok := extendChainEnd(constructdbg.GetReverseByteArr(edgeSeq[:x0]), constructdbg.GetReverseByteArr(readSeq[y0-rl:y0]))
+	if ok {
+		x0, y0 = 0, y0-l
+		lrd.Mch += int(lcg.Mch)
+		lrd.Mis += int(lcg.Mis)
+	}
+	el := len(edgeSeq) - xe
+	rl = constructdbg.Min(len(readSeq)-ye, el+el/4+20)
+	rcg, l, ok := extendChainEnd(edgeSeq[xe:], readSeq[ye:ye+rl])
+	if ok {
+		xe, ye = len(edgeSeq), ye+l
+		lrd.Mch += int(rcg.Mch)
+		lrd.Mis += int(rcg.Mis)
+	}
+	lrd.RefStart, lrd.RefEnd, lrd.RefLen = x0, xe, len(edgeSeq)
+	lrd.Start, lrd.End, lrd.Len = y0, ye, len(readSeq)
+	lrd.MapNum = lrd.Mch
+	lrd.GapMapNum = lrd.Mch + lrd.Mis + lrd.Ins + lrd.Del
+	return
+}
+
+// AlignLongRead map the long read to the edges by the minimizers index, every chain of edge strand
+// output a record, the read crossing an edge more than once has more records of the edge, return
+// the records sorted by the read start, coordinates same as the PAF of minimap2
+func AlignLongRead(li LRInfo, skArr []constructdbg.SeedKmerInfo, edgesArr []constructdbg.DBGEdge, opt Options) (arr []LRRecord) {
+	var rcSeq []byte
+	for k, anchors := range CollectAnchors(li.Seq, skArr, opt.Seed, opt.Width) {
+		chainArr, _ := ChainAnchorsArr(anchors, opt.Seed, LRMinChainScore)
+		if len(chainArr) == 0 {
+			continue
+		}
+		readSeq := li.Seq
+		if k.Strand == constructdbg.MINUS {
+			if rcSeq == nil {
+				rcSeq = constructdbg.GetReverseCompByteArr(li.Seq)
+			}
+			readSeq = rcSeq
+		}
+		for _, chainA := range chainArr {
+			lrd := AlignLongReadToEdge(edgesArr[k.EID].Utg.Ks, readSeq, chainA)
+			lrd.RefID, lrd.Strand = k.EID, k.Strand
+			if k.Strand == constructdbg.MINUS {
+				lrd.Start, lrd.End = lrd.Len-lrd.End, lrd.Len-lrd.Start
+			}
+			lrd.ReadSeqBnt = li.Seq
+			arr = append(arr, lrd)
+		}
+	}
+	sort.Slice(arr, func(i, j int) bool {
+		if arr[i].Start != arr[j].Start {
+			return arr[i].Start < arr[j].Start
+		}
+		return arr[i].RefID < arr[j].RefID
+	})
+	return
+}
+
+// GetPAFInfo return the PAF fields of record, the read as query and edge as target
+func GetPAFInfo(name string, lrd LRRecord) (pi PAFInfo) {
+	strand := "+"
+	if lrd.Strand == constructdbg.MINUS {
+		strand = "-"
+	}
+	pi.Sa = []string{name, strconv.Itoa(lrd.Len), strconv.Itoa(lrd.Start), strconv.Itoa(lrd.End), strand,
+		strconv.Itoa(int(lrd.RefID)), strconv.Itoa(lrd.RefLen), strconv.Itoa(lrd.RefStart), strconv.Itoa(lrd.RefEnd),
+		strconv.Itoa(lrd.MapNum), strconv.Itoa(lrd.GapMapNum), "255"}
+	pi.Seq = lrd.ReadSeqBnt
+	return
+}
+
+func paraAlignLongReads(lc <-chan LRInfo, rc chan<- []PAFInfo, skArr []constructdbg.SeedKmerInfo, edgesArr []constructdbg.DBGEdge, opt Options, done chan<- int) {
+	for li := range lc {
+		arr := AlignLongRead(li, skArr, edgesArr, opt)
+		if len(arr) < 2 {
+			continue
+		}
+		pa := make([]PAFInfo, len(arr))
+		for i, lrd := range arr {
+			pa[i] = GetPAFInfo(li.ID, lrd)
+		}
+		rc <- pa
+	}
+	done <- 1
+}
+
+// AlignLongReads map the long reads to the edges by the built-in aligner, the records of every read
+// send to rc same as GetPAFRecord
+func AlignLongReads(ONTfn string, skArr []constructdbg.SeedKmerInfo, edgesArr []constructdbg.DBGEdge, opt Options, rc chan<- []PAFInfo) {
+	ONTfp, err := os.Open(ONTfn)
+	if err != nil {
+		log.Fatalf("[AlignLongReads] open ONT file: %s failed, err: %v\n", ONTfn, err)
+	}
+	defer ONTfp.Close()
+	brONTfp := cbrotli.NewReaderSize(ONTfp, 1<<25)
+	defer brONTfp.Close()
+	ONTfafp := fasta.NewReader(bufio.NewReader(brONTfp), linear.NewSeq("", nil, alphabet.DNA))
+
+	lc := make(chan LRInfo, opt.NumCPU)
+	done := make(chan int, opt.NumCPU)
+	for i := 0; i < opt.NumCPU; i++ {
+		go paraAlignLongReads(lc, rc, skArr, edgesArr, opt, done)
+	}
+	readNum := 0
+	for {
+		li, err := GetLRRead(ONTfafp)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			log.Fatalf("[AlignLongReads] read file: %s, error: %v\n", ONTfn, err)
+		}
+		lc <- li
+		readNum++
+	}
+	close(lc)
+	for i := 0; i < opt.NumCPU; i++ {
+		<-done
+	}
+	fmt.Printf("[AlignLongReads] aligned long reads number: %d\n", readNum)
+
+	// notice para goroutinues the channel has not any more data
+	close(rc)
+}
@@ -0,0 +1,47 @@
+package deconstructdbg
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+// the PAF of read r1 = edge2 + edge3 + edge2 + reverse complement of edge4
+const lralignTestPAF = `r1	2900	0	800	+	2	800	0	800	800	800	255
+r1	2900	800	1500	+	3	700	0	700	700	700	255
+r1	2900	1500	2300	+	2	800	0	800	800	800	255
+r1	2900	2300	2900	-	4	600	0	600	600	600	255`
+
+func TestAlignLongReadPAF(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	edgesArr := make([]constructdbg.DBGEdge, 5)
+	for i, l := range []int{800, 700, 600} {
+		e := &edgesArr[i+2]
+		e.ID = constructdbg.DBG_MAX_INT(i + 2)
+		e.Utg.Ks = make([]byte, l)
+		for j := range e.Utg.Ks {
+			e.Utg.Ks[j] = byte(r.Intn(bnt.BaseTypeNum))
+		}
+	}
+	var read []byte
+	read = append(read, edgesArr[2].Utg.Ks...)
+	read = append(read, edgesArr[3].Utg.Ks...)
+	read = append(read, edgesArr[2].Utg.Ks...)
+	read = append(read, constructdbg.GetReverseCompByteArr(edgesArr[4].Utg.Ks)...)
+
+	var opt Options
+	opt.Seed, opt.Width = 15, 10
+	skArr := constructdbg.GetEdgesMinKmerIndex(edgesArr, opt.Seed, opt.Width, 2)
+	var got []string
+	for _, lrd := range AlignLongRead(LRInfo{"r1", read}, skArr, edgesArr, opt) {
+		got = append(got, strings.Join(GetPAFInfo("r1", lrd).Sa, "\t"))
+	}
+	want := strings.Split(lralignTestPAF, "\n")
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("records:\n%s\nwant PAF:\n%s", strings.Join(got, "\n"), lralignTestPAF)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/mudesheng/ga/constructdbg"
 	"github.com/mudesheng/ga/deconstructdbg"
 	"github.com/mudesheng/ga/preprocess"
+	"github.com/mudesheng/ga/scaffold"
 )
 
 //"./mapDBG"
@@ -52,6 +53,16 @@ func init() {
 		pp.DefineIntFlag("WinSize", 5, "th size of sliding window for DBG edge Sample")
 		pp.DefineIntFlag("MaxNGSReadLen", 250, "Max NGS Read Length")
 		pp.DefineBoolFlag("Correct", true, "Correct NGS Read and merge pair reads")
+		pp.DefineStringFlag("SamFormat", "", "output the alignments of reads to DBG edges, 'sam' or 'bam', the edges written to <prefix>.Correct.edges.fa, default[\"\"] not output")
+		pp.DefineBoolFlag("UseInsert", false, "use the insert size estimated by the pairs mapped to the DBG in place of the cfg values, the estimation is an extra pass of sample pairs written to prefix.lib.insert, also done for the library with orientation auto")
+		pp.DefineBoolFlag("GAF", false, "output the paths of reads in the DBG to the GAF file, the DBG written to <prefix>.Correct.gfa")
+		pp.DefineStringFlag("Dup", "", "detect the PCR duplicate pairs by the prefix of both ends, 'mark' or 'drop', the duplicates removed before ccf to the files '*.Dedup.[fa|fq].br', default[\"\"] not detect")
+		pp.DefineBoolFlag("PathIndex", false, "write the binary index of correct reads paths in the DBG to the file '-p.paths.idx', the DBG written to the stage 'pp' files, used by fspath 'PathIndex'")
+		pp.DefineBoolFlag("Vars", false, "write the candidate variants supported by the high quality mismatches of reads to the file '*.Correct.vars' of pair files")
+		pp.DefineBoolFlag("Reject", false, "write the pair reads not output to the correct reads with the reject reason to the files '*.Reject_[12].[fa|fq].br'")
+		pp.DefineBoolFlag("Trim", false, "trim the adapters and low quality 3' end of reads before ccf, the trimmed files '*.Trim.[fa|fq].br'")
+		pp.DefineBoolFlag("Fastq", false, "also output the correct reads in FASTQ with edit tags, qualities carried from the agreed input read bases, at least Q20 for the DBG path bases")
+		pp.DefineBoolFlag("Deterministic", false, "renumber nodes and edges by canonical sequence order, reruns give the same IDs")
 		//pp.DefineIntFlag("tipMaxLen", Kmerdef*2, "Maximum tip length(-K * 2)")
 	}
 	ccf := app.DefineSubCommand("ccf", "construct cukcoofilter", constructcf.CCF)
@@ -62,6 +73,13 @@ func init() {
 	cdbg := app.DefineSubCommand("cdbg", "construct De bruijn Graph", constructdbg.CDBG)
 	{
 		cdbg.DefineIntFlag("tipMaxLen", Kmerdef*2, "Maximum tip length(-K * 2)")
+		cdbg.DefineBoolFlag("Deterministic", false, "renumber nodes and edges by canonical sequence order, reruns give the same IDs")
+	}
+	incdbg := app.DefineSubCommand("incdbg", "add new libraries to the cuckoofilter and update the DBG constructed by cdbg", constructdbg.IncDBG)
+	{
+		incdbg.DefineStringFlag("lib", "", "names of the new libraries in the cfg file, separated by ','")
+		incdbg.DefineBoolFlag("Correct", false, "Correct NGS Read and merge pair reads")
+		incdbg.DefineBoolFlag("Deterministic", false, "renumber nodes and edges by canonical sequence order, reruns give the same IDs")
 	}
 
 	smfy := app.DefineSubCommand("smfy", "find Illumina reads path and simplify De bruijn Graph", constructdbg.Smfy)
@@ -71,8 +89,62 @@ func init() {
 		smfy.DefineIntFlag("MaxNGSReadLen", 450, "Max NGS Read Length")
 		smfy.DefineIntFlag("MinMapFreq", 5, "Minimum reads Mapping Frequent")
 		smfy.DefineBoolFlag("Correct", false, "Correct NGS Read and merge pair reads")
+		smfy.DefineBoolFlag("RmLowCov", false, "remove low coverage edges after simplify DBG, the edges kmer coverage counted by an extra pass over the cfg reads")
+		smfy.DefineIntFlag("MinEdgeCov", 3, "edges kmer coverage depth counted from the reads smaller than MinEdgeCov will be removed")
+		smfy.DefineIntFlag("CovRatio", 10, "short edges kmer coverage depth smaller than CovRatio percent of the max neighbor edges will be removed")
+		smfy.DefineBoolFlag("ParaSmfy", false, "simplify the connected components of DBG in parallel")
 		//smfy.DefineIntFlag("MaxMapEdgeLen", 2000, "Max Edge length for mapping Long Reads")
 	}
+	mk := app.DefineSubCommand("mk", "iterative construct and simplify DBG from small K to large K", constructdbg.MultiK)
+	{
+		mk.DefineStringFlag("Kset", "63,127,203", "kmer lengths of every iteration, separated by ','")
+		mk.DefineInt64Flag("S", 0, "the Size number of items cuckoofilter set")
+		mk.DefineBoolFlag("Deterministic", false, "renumber nodes and edges by canonical sequence order, reruns give the same IDs")
+		mk.DefineIntFlag("tipMaxLen", 0, "Maximum tip length, default[0] for MaxNGSReadLen")
+		mk.DefineIntFlag("WinSize", 10, "th size of sliding window for DBG edge Sample")
+		mk.DefineIntFlag("MaxNGSReadLen", 450, "Max NGS Read Length")
+		mk.DefineIntFlag("MinMapFreq", 5, "Minimum reads Mapping Frequent")
+		mk.DefineBoolFlag("Correct", false, "Correct NGS Read and merge pair reads")
+		mk.DefineBoolFlag("RmLowCov", false, "remove low coverage edges after simplify DBG, the edges kmer coverage counted by an extra pass over the cfg reads")
+		mk.DefineIntFlag("MinEdgeCov", 3, "edges kmer coverage depth counted from the reads smaller than MinEdgeCov will be removed")
+		mk.DefineIntFlag("CovRatio", 10, "short edges kmer coverage depth smaller than CovRatio percent of the max neighbor edges will be removed")
+		mk.DefineBoolFlag("ParaSmfy", false, "simplify the connected components of DBG in parallel")
+	}
+	graphstats := app.DefineSubCommand("graphstats", "report statistics of the DBG nodes and edges files of a stage", constructdbg.GraphStats)
+	{
+		graphstats.DefineStringFlag("stage", "smfy", "stage of the DBG files, 'cdbg', 'smfy' or 'pp'")
+		graphstats.DefineBoolFlag("Cov", false, "also report the edges kmer coverage counted by an extra pass over the cfg reads")
+		graphstats.DefineIntFlag("WinSize", 10, "th size of sliding window for DBG edge Sample")
+	}
+	subgraph := app.DefineSubCommand("subgraph", "extract the subgraph around edges to dot, GFA and fasta files", constructdbg.SubGraph)
+	{
+		subgraph.DefineStringFlag("stage", "smfy", "stage of the DBG files, 'cdbg', 'smfy' or 'pp'")
+		subgraph.DefineStringFlag("e", "", "seed edges ID, separated by ','")
+		subgraph.DefineStringFlag("r", "3", "radius around seed edges, hop count or sequence distance with suffix 'bp'(e.g. 5000bp)")
+	}
+	htmlview := app.DefineSubCommand("htmlview", "export DBG or subgraph to a self-contained interactive html file", constructdbg.HTMLView)
+	{
+		htmlview.DefineStringFlag("stage", "smfy", "stage of the DBG files, 'cdbg', 'smfy' or 'pp'")
+		htmlview.DefineStringFlag("e", "", "seed edges ID of subgraph, separated by ',', default[\"\"] for whole graph")
+		htmlview.DefineStringFlag("r", "3", "radius around seed edges, hop count or sequence distance with suffix 'bp'(e.g. 5000bp)")
+	}
+	checkdbg := app.DefineSubCommand("checkdbg", "check the invariants of DBG nodes and edges, write violations to the file '-p.<stage>.check'", constructdbg.CheckDBG)
+	{
+		checkdbg.DefineStringFlag("stage", "smfy", "stage of the DBG files, 'cdbg', 'smfy' or 'pp'")
+	}
+	comp := app.DefineSubCommand("comp", "export a connected component of DBG to dot, GFA and fasta files", constructdbg.Comp)
+	{
+		comp.DefineStringFlag("stage", "smfy", "stage of the DBG files, 'cdbg', 'smfy' or 'pp'")
+		comp.DefineIntFlag("c", 0, "component ID in the file '-p.<stage>.comps'")
+		comp.DefineIntFlag("e", 0, "edge ID, export the component that contain the edge")
+	}
+	colordbg := app.DefineSubCommand("color", "colour the DBG edges by the samples(libraries) of cfg file, output colours, GFA and fasta files", constructdbg.Color)
+	{
+		colordbg.DefineStringFlag("stage", "smfy", "stage of the DBG files, 'cdbg', 'smfy' or 'pp'")
+		colordbg.DefineIntFlag("WinSize", 10, "th size of sliding window for DBG edge Sample")
+		colordbg.DefineIntFlag("MinHits", 3, "Minimum number of edge sampled kmers hit by the reads of sample for colouring edge")
+		colordbg.DefineBoolFlag("Correct", false, "Correct NGS Read and merge pair reads")
+	}
 	decontdbg := app.DefineSubCommand("decdbg", "deconstruct DBG using Long Reads Mapping info", deconstructdbg.DeconstructDBG)
 	{
 		decontdbg.DefineIntFlag("MinCov", 2, "Mininum coverage by long reads")
@@ -82,8 +154,29 @@ func init() {
 		decontdbg.DefineIntFlag("ExtLen", 1000, "Extend Path length for distingush most probable path")
 		decontdbg.DefineStringFlag("LongReadFile", "ONT.fa", "Oxford Nanopore Technology long reads file")
 		decontdbg.DefineBoolFlag("Correct", false, "Correct NGS Read and merge pair reads")
+		decontdbg.DefineBoolFlag("GAF", false, "output the mapping paths of long reads to the GAF file")
+		decontdbg.DefineIntFlag("Comp", 0, "process only the component with the ID in the file '-p.smfy.comps', different components can run in parallel, default[0] for whole DBG")
+		decontdbg.DefineBoolFlag("Align", false, "align long reads to the smfy edges by the built-in aligner, not need the minimap2 PAF file '-p.paf'")
+		decontdbg.DefineIntFlag("Seed", 15, "the minimizer length of the built-in aligner(must <=16)")
+		decontdbg.DefineIntFlag("Width", 10, "the window size of minimizers for the built-in aligner")
 
 	}
+	// order and orient contigs by the pair reads links
+	scaf := app.DefineSubCommand("scaffold", "map pair reads to the contigs, order and orient contigs to scaffolds by the links, output scaffolds with N gaps and AGP", scaffold.Scaffold)
+	{
+		scaf.DefineStringFlag("Contigs", "", "contigs fasta file, default[\"\"] for the decdbg output '-p.edges.DcDBG.fq' and the unique edges of smfy DBG not joined, only the unique edges used if not found")
+		scaf.DefineIntFlag("WinSize", 10, "th size of sliding window for contig Sample")
+		scaf.DefineIntFlag("SeedLen", 31, "the seed kmer length of pair reads mapping to the contigs(odd)")
+		scaf.DefineIntFlag("MinLinkNum", 3, "Minimum pairs number support a link of scaffolds")
+		scaf.DefineIntFlag("MinContigLen", 200, "Minimum length of contig mapped, shorter contigs output as single scaffolds")
+	}
+	// close the gaps of scaffolds
+	gapfill := app.DefineSubCommand("gapfill", "close the gaps of scaffolds by the DBG paths and the local assembly of pair reads anchored in the flanks", scaffold.GapFill)
+	{
+		gapfill.DefineStringFlag("Scaffolds", "", "scaffolds fasta file with N gaps, default[\"\"] for the scaffold output '-p.scaffolds.fa'")
+		gapfill.DefineIntFlag("WinSize", 10, "th size of sliding window for DBG edge and scaffold Sample")
+		gapfill.DefineIntFlag("SeedLen", 31, "the kmer length of pair reads mapping and local assembly(odd)")
+	}
 	// mapping long read to the DBG
 	mapDBG := app.DefineSubCommand("mapDBG", "mapping long read to the DBG", constructdbg.MapDBG)
 	{
@@ -94,6 +187,7 @@ func init() {
 	fspath := app.DefineSubCommand("fspath", "Parse short read path", constructdbg.FSpath)
 	{
 		fspath.DefineIntFlag("tipMaxLen", Kmerdef*2, "Maximum tip length")
+		fspath.DefineBoolFlag("PathIndex", false, "use the DBG of stage 'pp' and the read paths index '-p.paths.idx' written by pp 'PathIndex' instead of the smfy DBG")
 	}
 	// find long read mapping
 	flpath := app.DefineSubCommand("flpath", "Parse long read path", constructdbg.FLpath)
@@ -0,0 +1,266 @@
+package preprocess
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/cbrotli"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+const (
+	DupPrefixLen   = 25       // the bases of both ends encoded as the duplicate key, reads differ after the prefix are near-exact duplicates
+	DupMark        = "du:i:1" // the annotation of duplicate pair in mark mode
+	dupInitSize    = 1 << 20  // the init slots number of DupSet
+	dupMaxLoadRate = 70       // the max percent of slots used before DupSet grow
+)
+
+// DupSet is the open addressing set of pair keys of a library, only the 64 bits keys hold in
+// the memory, shared by the goroutines of library files, the slots doubled at 70% load, so the
+// memory bound is 8*2/0.7 = 23 bytes per distinct pair in the worst case, about 2.3GB for 100M pairs
+type DupSet struct {
+	sync.Mutex
+	slots           []uint64
+	num             int
+	PairNum, DupNum int
+}
+
+// NewDupSet return an empty DupSet
+func NewDupSet() *DupSet {
+	return &DupSet{slots: make([]uint64, dupInitSize)}
+}
+
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// encode the 2-bit bases of read prefix, the length included for short reads,
+// return false if the prefix has the base not ACGT
+func getReadPrefixKey(seq []byte) (uint64, bool) {
+	l := constructdbg.Min(len(seq), DupPrefixLen)
+	var k uint64
+	for _, b := range seq[:l] {
+		if b > bnt.BaseMask {
+			return 0, false
+		}
+		k = (k << 2) | uint64(b)
+	}
+	return mix64(k<<8 | uint64(l)), true
+}
+
+// GetPairDupKey return the key of pair reads, the same for the pair with read1 and read2 swapped,
+// return 0 for the pair with N in the prefix not detected
+func GetPairDupKey(pairRI [2]constructcf.ReadInfo) uint64 {
+	k1, ok1 := getReadPrefixKey(pairRI[0].Seq)
+	k2, ok2 := getReadPrefixKey(pairRI[1].Seq)
+	if !ok1 || !ok2 {
+		return 0
+	}
+	if k1 > k2 {
+		k1, k2 = k2, k1
+	}
+	k := mix64(k1 ^ (k2*0x9e3779b97f4a7c15 + 1))
+	if k == 0 {
+		k = 1
+	}
+	return k
+}
+
+func (ds *DupSet) insert(k uint64) bool {
+	mask := uint64(len(ds.slots) - 1)
+	for i := k & mask; ; i = (i + 1) & mask {
+		if ds.slots[i] == k {
+			return false
+		} else if ds.slots[i] == 0 {
+			ds.slots[i] = k
+			ds.num++
+			return true
+		}
+	}
+}
+
+func (ds *DupSet) grow() {
+	old := ds.slots
+	ds.slots = make([]uint64, len(old)*2)
+	ds.num = 0
+	for _, k := range old {
+		if k != 0 {
+			ds.insert(k)
+		}
+	}
+}
+
+// IsDup add the pair to the set, return true if a pair with the same key added before
+func (ds *DupSet) IsDup(pairRI [2]constructcf.ReadInfo) bool {
+	k := GetPairDupKey(pairRI)
+	ds.Lock()
+	defer ds.Unlock()
+	ds.PairNum++
+	if k == 0 {
+		return false
+	}
+	if (ds.num+1)*100 > len(ds.slots)*dupMaxLoadRate {
+		ds.grow()
+	}
+	if ds.insert(k) {
+		return false
+	}
+	ds.DupNum++
+	return true
+}
+
+// GetDedupFn return the deduplicated file name of reads file, *.[fa|fq].br to *.Dedup.[fa|fq].br
+func GetDedupFn(fn string) string {
+	format := constructcf.GetReadsFileFormat(fn)
+	idx := strings.LastIndex(fn[:strings.LastIndex(fn, ".")], ".")
+	return fn[:idx] + ".Dedup." + format + ".br"
+}
+
+// GetLoadFn return the reads file of the cfg file fn loaded by the mapping, the trimmed and
+// deduplicated files used if written before ccf
+func GetLoadFn(fn string, opt Options) string {
+	if opt.Trim {
+		fn = GetTrimFn(fn)
+	}
+	if opt.DupMode == "drop" {
+		fn = GetDedupFn(fn)
+	}
+	return fn
+}
+
+// paraDedupReadsFile write the pairs of pair files not duplicate in ds to the files of GetDedupFn
+func paraDedupReadsFile(fn1, fn2 string, ds *DupSet, processT chan int) {
+	var fnArr = [2]string{fn1, fn2}
+	var buffpArr [2]*bufio.Reader
+	var wbuffpArr [2]*bufio.Writer
+	var cbrofpArr [2]*cbrotli.Writer
+	var formatArr [2]string
+	for j, fn := range fnArr {
+		fp, err := os.Open(fn)
+		if err != nil {
+			log.Fatalf("[paraDedupReadsFile] open file: %v failed..., err: %v\n", fn, err)
+		}
+		defer fp.Close()
+		brfp := cbrotli.NewReaderSize(fp, 1<<20)
+		defer brfp.Close()
+		buffpArr[j] = bufio.NewReader(brfp)
+		formatArr[j] = constructcf.GetReadsFileFormat(fn)
+		dfn := GetDedupFn(fn)
+		wfp, err := os.Create(dfn)
+		if err != nil {
+			log.Fatalf("[paraDedupReadsFile] create file: %v failed..., err: %v\n", dfn, err)
+		}
+		defer wfp.Close()
+		cbrofpArr[j] = cbrotli.NewWriter(wfp, cbrotli.WriterOptions{Quality: 1})
+		wbuffpArr[j] = bufio.NewWriterSize(cbrofpArr[j], 1<<20)
+	}
+	var pairNum, dupNum int
+	for {
+		var pairRI [2]constructcf.ReadInfo
+		var eofNum int
+		for j := 0; j < 2; j++ {
+			var err error
+			pairRI[j], err = constructcf.GetReadFileRecord(buffpArr[j], formatArr[j], false)
+			if pairRI[j].ID == 0 && err == io.EOF {
+				eofNum++
+			}
+		}
+		if eofNum == 2 {
+			break
+		} else if eofNum > 0 || pairRI[0].ID != pairRI[1].ID {
+			log.Fatalf("[paraDedupReadsFile] files: %v not consis, read ID: %v != %v\n", fnArr, pairRI[0].ID, pairRI[1].ID)
+		}
+		pairNum++
+		if ds.IsDup(pairRI) {
+			dupNum++
+			continue
+		}
+		for j := 0; j < 2; j++ {
+			writeReadRecord(wbuffpArr[j], pairRI[j], formatArr[j])
+		}
+	}
+	for j := 0; j < 2; j++ {
+		if err := wbuffpArr[j].Flush(); err != nil {
+			log.Fatalf("[paraDedupReadsFile] failed to flush file: %s, err: %v\n", GetDedupFn(fnArr[j]), err)
+		}
+		if err := cbrofpArr[j].Close(); err != nil {
+			log.Fatalf("[paraDedupReadsFile] failed to close file: %s, err: %v\n", GetDedupFn(fnArr[j]), err)
+		}
+	}
+	fmt.Printf("[paraDedupReadsFile] files: %v, pairs num: %d, duplicate pairs num: %d\n", fnArr, pairNum, dupNum)
+	processT <- 1
+}
+
+// DedupLibs remove the duplicate pairs of libraries used by ccf before counting kmers, the files of
+// single reads not changed, write the duplication statistics to the file opt.Prefix+".dup",
+// return the files used by ccf
+func DedupLibs(opt Options, cfgInfo constructcf.CfgInfo) (dedupFnArr []string) {
+	processT := make(chan int, opt.NumCPU)
+	for i := 0; i < opt.NumCPU; i++ {
+		processT <- 1
+	}
+	var libArr []constructcf.LibInfo
+	var dsArr []*DupSet
+	for _, lib := range cfgInfo.Libs {
+		if lib.AsmFlag != constructcf.AllState && lib.SeqProfile != 1 {
+			continue
+		}
+		fnArr := make([]string, len(lib.FnName))
+		for i, fn := range lib.FnName {
+			fnArr[i] = fn
+			if opt.Trim {
+				fnArr[i] = GetTrimFn(fn)
+			}
+		}
+		if len(fnArr)%2 == 1 {
+			dedupFnArr = append(dedupFnArr, fnArr...)
+			continue
+		}
+		ds := NewDupSet()
+		libArr = append(libArr, lib)
+		dsArr = append(dsArr, ds)
+		for i := 0; i < len(fnArr); i += 2 {
+			<-processT
+			go paraDedupReadsFile(fnArr[i], fnArr[i+1], ds, processT)
+			dedupFnArr = append(dedupFnArr, GetDedupFn(fnArr[i]), GetDedupFn(fnArr[i+1]))
+		}
+	}
+	for i := 0; i < opt.NumCPU; i++ {
+		<-processT
+	}
+	DupStatWriter(libArr, dsArr, opt.Prefix+".dup")
+	return
+}
+
+// DupStatWriter write the duplication rate table of libraries to the file
+func DupStatWriter(libArr []constructcf.LibInfo, dsArr []*DupSet, dupfn string) {
+	fp, err := os.Create(dupfn)
+	if err != nil {
+		log.Fatalf("[DupStatWriter] create file: %s failed, err: %v\n", dupfn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriter(fp)
+	fmt.Fprintf(buffp, "#library\tpairs\tdupPairs\tdupPercent\n")
+	for i, ds := range dsArr {
+		var percent float64
+		if ds.PairNum > 0 {
+			percent = float64(ds.DupNum) * 100 / float64(ds.PairNum)
+		}
+		fmt.Fprintf(buffp, "%s\t%d\t%d\t%.2f\n", libArr[i].Name, ds.PairNum, ds.DupNum, percent)
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[DupStatWriter] write file: %s failed, err: %v\n", dupfn, err)
+	}
+}
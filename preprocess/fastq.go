@@ -0,0 +1,80 @@
+package preprocess
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+const (
+	DBGSupportQual = 20 // the quality of correct base supported only by the solid kmers of DBG path
+	MaxSupportQual = 41 // the max quality of correct base
+)
+
+// setReadBaseQual raise the qualities sq of the correct sequence seq to the input qualities of
+// read ri bases that agree with seq, the read mapped by rm from the seq start, or from the seq
+// end on the reverse strand if rev
+func setReadBaseQual(sq []int, seq []byte, ri constructcf.ReadInfo, rm NGSReadMapping, rev bool, qualBenchmark uint8) {
+	for i := 0; i < rm.MappingNum && i < len(seq); i++ {
+		rp := rm.Pos + i
+		if rp >= len(ri.Seq) {
+			break
+		}
+		sp, b := i, ri.Seq[rp]
+		if rev {
+			sp, b = len(seq)-1-i, bnt.BntRev[b]
+		}
+		if seq[sp] != b {
+			continue
+		}
+		if q := GetBaseQual(ri, rp, qualBenchmark); q > sq[sp] {
+			sq[sp] = q
+		}
+	}
+}
+
+// GetCorrectReadQual return the phred+33 qualities of the correct sequence seq. Every base on the
+// DBG path get DBGSupportQual, the substituted bases and the bases between merged pair keep it,
+// the base agreed with the reads get the max input quality if higher(NoQual for FASTA reads),
+// all capped at MaxSupportQual. riArr[0] mapped from the seq start by rmArr[0], riArr[1] of
+// merged pair mapped from the seq end
+func GetCorrectReadQual(seq []byte, riArr []constructcf.ReadInfo, rmArr []NGSReadMapping, qualBenchmark uint8) (qual []byte) {
+	sq := make([]int, len(seq))
+	for i := range sq {
+		sq[i] = DBGSupportQual
+	}
+	for j := range riArr {
+		setReadBaseQual(sq, seq, riArr[j], rmArr[j], j == 1, qualBenchmark)
+	}
+	qual = make([]byte, len(seq))
+	for i, q := range sq {
+		qual[i] = byte(constructdbg.Min(q, MaxSupportQual)) + 33
+	}
+	return
+}
+
+// GetCorrectReadTags return the tags of correct read in the SAM tag format, the mapping is
+// ungapped so indels always 0
+func GetCorrectReadTags(pathSeqArr []constructdbg.PathSeq, subNum int, merged bool) string {
+	var sb strings.Builder
+	mergedFlag := 0
+	if merged {
+		mergedFlag = 1
+	}
+	fmt.Fprintf(&sb, "sb:i:%d\tid:i:0\tmg:i:%d\tpa:Z:", subNum, mergedFlag)
+	for i, ps := range pathSeqArr {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, "%d", ps.ID)
+		if ps.Strand == constructdbg.PLUS {
+			sb.WriteByte('+')
+		} else {
+			sb.WriteByte('-')
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,38 @@
+package preprocess
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+// GetReadGAFRecord return the GAF record of the read mapped to the DBG, ok is false if not mapped
+func GetReadGAFRecord(ri constructcf.ReadInfo, rm NGSReadMapping, edgesArr []constructdbg.DBGEdge, kmerlen int) (g constructdbg.GAFRecord, ok bool) {
+	segArr := GetAlignSegments(ri, rm, edgesArr, kmerlen)
+	if len(segArr) == 0 {
+		return
+	}
+	g.QName = strconv.FormatInt(ri.ID, 10)
+	g.QLen = len(ri.Seq)
+	g.QStart, g.QEnd = rm.Pos, rm.Pos+rm.MappingNum
+	for _, seg := range segArr {
+		g.EIDArr = append(g.EIDArr, seg.EID)
+		g.StrandArr = append(g.StrandArr, seg.Strand)
+	}
+	g.PLen = constructdbg.GetWalkLen(g.EIDArr, edgesArr, kmerlen)
+	first := segArr[0]
+	if first.Strand == constructdbg.PLUS {
+		g.PStart = first.EStart
+	} else {
+		g.PStart = len(edgesArr[first.EID].Utg.Ks) - (first.EStart + first.Len)
+	}
+	g.PEnd = g.PStart + (g.QEnd - g.QStart)
+	g.BlockLen = g.QEnd - g.QStart
+	g.Match = g.BlockLen - rm.ErrorNum
+	g.MapQ = int(getMapQ(rm.ErrorNum))
+	g.Tags = append(g.Tags, fmt.Sprintf("NM:i:%d", rm.ErrorNum))
+	ok = true
+	return
+}
@@ -0,0 +1,303 @@
+package preprocess
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/mudesheng/ga/cbrotli"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+const (
+	InsertSampleNum   = 200000 // the max number of pairs used for estimating the insert size
+	InsertMinEdgeLen  = 1000   // the min length of edge that pairs mapped to
+	InsertHistBinSize = 10
+	InsertMinPairNum  = 100 // the min number of pairs estimation can be used
+	InsertOrientRate  = 80  // the min percent of sample pairs of the major orientation to change the orientation
+)
+
+// InsertSizeStat is the insert size distribution of a library estimated by the pairs
+// mapped to the same long unique edge
+type InsertSizeStat struct {
+	SampleNum   int // pairs sampled
+	Num         int // pairs used after outliers removed
+	Mean, SD    float64
+	Orient      int
+	OrientCount [constructcf.OrientNum]int
+	Hist        []int // the pairs number of every InsertHistBinSize bases
+}
+
+// LoadNGSPairsSample return the first num pairs of the pair files
+func LoadNGSPairsSample(brfn1, brfn2 string, num, kmerlen int) (pairArr [][2]constructcf.ReadInfo) {
+	fp1, err := os.Open(brfn1)
+	if err != nil {
+		log.Fatalf("[LoadNGSPairsSample] open file: %v failed..., err: %v\n", brfn1, err)
+	}
+	defer fp1.Close()
+	fp2, err := os.Open(brfn2)
+	if err != nil {
+		log.Fatalf("[LoadNGSPairsSample] open file: %v failed..., err: %v\n", brfn2, err)
+	}
+	defer fp2.Close()
+	brfp1 := cbrotli.NewReaderSize(fp1, 1<<20)
+	defer brfp1.Close()
+	brfp2 := cbrotli.NewReaderSize(fp2, 1<<20)
+	defer brfp2.Close()
+	buffp1 := bufio.NewReader(brfp1)
+	buffp2 := bufio.NewReader(brfp2)
+	format1 := constructcf.GetReadsFileFormat(brfn1)
+	format2 := constructcf.GetReadsFileFormat(brfn2)
+	for len(pairArr) < num {
+		ri1, err1 := constructcf.GetReadFileRecord(buffp1, format1, false)
+		ri2, err2 := constructcf.GetReadFileRecord(buffp2, format2, false)
+		if ri1.ID == 0 || ri2.ID == 0 {
+			if err1 == io.EOF && err2 == io.EOF {
+				break
+			}
+			log.Fatalf("[LoadNGSPairsSample] file : %v not consis with file : %v\n", brfn1, brfn2)
+		}
+		if ri1.ID != ri2.ID {
+			log.Fatalf("[LoadNGSPairsSample] read1 ID : %v != read2 ID: %v\n", ri1.ID, ri2.ID)
+		}
+		if len(ri1.Seq) < kmerlen+20 || len(ri2.Seq) < kmerlen+20 {
+			continue
+		}
+		pairArr = append(pairArr, [2]constructcf.ReadInfo{ri1, ri2})
+	}
+	return
+}
+
+// project the read to the edge coordinates, include the bases not mapped
+func getReadEdgeInterval(seg AlignSegment, readLen int) (start, end int) {
+	if seg.Strand == constructdbg.PLUS {
+		start = seg.EStart - seg.RStart
+		end = start + readLen
+	} else {
+		end = seg.EStart + seg.Len + seg.RStart
+		start = end - readLen
+	}
+	return
+}
+
+// GetPairFragment return the fragment length, the length of edge and orientation of pair reads
+// if both reads mapped to the same unique edge not shorter than minEdgeLen
+func GetPairFragment(pairRI [2]constructcf.ReadInfo, rmArr [2]NGSReadMapping, edgesArr []constructdbg.DBGEdge, kmerlen, minEdgeLen int) (fragLen, edgeLen, orient int, ok bool) {
+	var segs [2]AlignSegment
+	for j := 0; j < 2; j++ {
+		segArr := GetAlignSegments(pairRI[j], rmArr[j], edgesArr, kmerlen)
+		if len(segArr) != 1 {
+			return
+		}
+		segs[j] = segArr[0]
+	}
+	e := edgesArr[segs[0].EID]
+	if segs[0].EID != segs[1].EID || e.GetUniqueFlag() == 0 || len(e.Utg.Ks) < minEdgeLen {
+		return
+	}
+	var start, end [2]int
+	for j := 0; j < 2; j++ {
+		start[j], end[j] = getReadEdgeInterval(segs[j], len(pairRI[j].Seq))
+	}
+	fragLen = constructdbg.MaxInt(end[0], end[1]) - constructdbg.Min(start[0], start[1])
+	edgeLen = len(e.Utg.Ks)
+	if segs[0].Strand == segs[1].Strand {
+		orient = constructcf.OrientFF
+	} else {
+		p, m := 0, 1
+		if segs[0].Strand == constructdbg.MINUS {
+			p, m = 1, 0
+		}
+		if start[p] <= start[m] {
+			orient = constructcf.OrientFR
+		} else {
+			orient = constructcf.OrientRF
+		}
+	}
+	ok = true
+	return
+}
+
+// GetInsertSizeStat return the distribution of the fragments length of the orientation, the major
+// orientation used if constructcf.OrientAuto, the fragments out of [Q1 - 2*(Q3-Q1), Q3 + 2*(Q3-Q1)]
+// removed as outliers
+func GetInsertSizeStat(fragArr [constructcf.OrientNum][]int, orient int) (stat InsertSizeStat) {
+	for i := 0; i < constructcf.OrientNum; i++ {
+		stat.OrientCount[i] = len(fragArr[i])
+		stat.SampleNum += len(fragArr[i])
+		if len(fragArr[i]) > len(fragArr[stat.Orient]) {
+			stat.Orient = i
+		}
+	}
+	if orient != constructcf.OrientAuto {
+		stat.Orient = orient
+	}
+	arr := fragArr[stat.Orient]
+	if len(arr) == 0 {
+		return
+	}
+	sort.Ints(arr)
+	q1, q3 := arr[len(arr)/4], arr[len(arr)*3/4]
+	low, high := q1-2*(q3-q1), q3+2*(q3-q1)
+	var sum float64
+	for _, l := range arr {
+		if l < low || l > high {
+			continue
+		}
+		stat.Num++
+		sum += float64(l)
+		b := l / InsertHistBinSize
+		for len(stat.Hist) <= b {
+			stat.Hist = append(stat.Hist, 0)
+		}
+		stat.Hist[b]++
+	}
+	stat.Mean = sum / float64(stat.Num)
+	var sq float64
+	for _, l := range arr {
+		if l < low || l > high {
+			continue
+		}
+		sq += (float64(l) - stat.Mean) * (float64(l) - stat.Mean)
+	}
+	stat.SD = math.Sqrt(sq / float64(stat.Num))
+	return
+}
+
+// FilterFragByEdgeLen return the fragments length of the pairs mapped to the edges long enough for
+// the fragments, the bound of edge length is twice the upper fence Q3 + 2*(Q3-Q1) of all fragments,
+// and not smaller than InsertMinEdgeLen, so long fragments not biased by the short edges
+func FilterFragByEdgeLen(fa [constructcf.OrientNum][][2]int) (fragArr [constructcf.OrientNum][]int, minEdgeLen int) {
+	var all []int
+	for o := 0; o < constructcf.OrientNum; o++ {
+		for _, f := range fa[o] {
+			all = append(all, f[0])
+		}
+	}
+	minEdgeLen = InsertMinEdgeLen
+	if len(all) > 0 {
+		sort.Ints(all)
+		q1, q3 := all[len(all)/4], all[len(all)*3/4]
+		minEdgeLen = constructdbg.MaxInt(minEdgeLen, 2*(q3+2*(q3-q1)))
+	}
+	for o := 0; o < constructcf.OrientNum; o++ {
+		for _, f := range fa[o] {
+			if f[1] >= minEdgeLen {
+				fragArr[o] = append(fragArr[o], f[0])
+			}
+		}
+	}
+	return
+}
+
+// EstimateInsertSize estimate the insert size of library by the sample pairs of the first pair files,
+// only the fragments of the orientation declared used, the cfg insert size not used by the estimation
+func EstimateInsertSize(lib constructcf.LibInfo, cf constructdbg.CuckooFilter, nodesArr []constructdbg.DBGNode, edgesArr []constructdbg.DBGEdge, opt Options) (stat InsertSizeStat) {
+	if len(lib.FnName) < 2 {
+		return
+	}
+	pairArr := LoadNGSPairsSample(lib.FnName[0], lib.FnName[1], InsertSampleNum, opt.Kmer)
+	var pairFragArr [constructcf.OrientNum][][2]int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	numCPU := constructdbg.MaxInt(opt.NumCPU, 1)
+	part := (len(pairArr) + numCPU - 1) / numCPU
+	for i := 0; i < numCPU; i++ {
+		start, end := i*part, constructdbg.Min((i+1)*part, len(pairArr))
+		if start >= end {
+			break
+		}
+		wg.Add(1)
+		go func(arr [][2]constructcf.ReadInfo) {
+			defer wg.Done()
+			var fa [constructcf.OrientNum][][2]int
+			for _, pairRI := range arr {
+				var rmArr [2]NGSReadMapping
+				for j := 0; j < 2; j++ {
+					rmArr[j] = MapNGSRead(cf, pairRI[j], opt.WinSize, edgesArr, nodesArr)
+				}
+				if fragLen, edgeLen, orient, ok := GetPairFragment(pairRI, rmArr, edgesArr, opt.Kmer, InsertMinEdgeLen); ok {
+					fa[orient] = append(fa[orient], [2]int{fragLen, edgeLen})
+				}
+			}
+			mu.Lock()
+			for o := 0; o < constructcf.OrientNum; o++ {
+				pairFragArr[o] = append(pairFragArr[o], fa[o]...)
+			}
+			mu.Unlock()
+		}(pairArr[start:end])
+	}
+	wg.Wait()
+	fragArr, minEdgeLen := FilterFragByEdgeLen(pairFragArr)
+	fmt.Printf("[EstimateInsertSize] library: %s, min length of edges used: %d\n", lib.Name, minEdgeLen)
+	stat = GetInsertSizeStat(fragArr, lib.Orient)
+	return
+}
+
+// InsertSizeStatWriter write the insert size distribution of library to the file
+func InsertSizeStatWriter(stat InsertSizeStat, lib constructcf.LibInfo, insertfn string) {
+	fp, err := os.Create(insertfn)
+	if err != nil {
+		log.Fatalf("[InsertSizeStatWriter] create file: %s failed, err: %v\n", insertfn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriter(fp)
+	fmt.Fprintf(buffp, "#library: %s\n", lib.Name)
+	fmt.Fprintf(buffp, "#configured insert size: %d, SD: %d\n", lib.InsertSize, lib.InsertSD)
+	fmt.Fprintf(buffp, "#sampled pairs: %d, used pairs: %d\n", stat.SampleNum, stat.Num)
+	for i := 0; i < constructcf.OrientNum; i++ {
+		fmt.Fprintf(buffp, "#orientation %s: %d\n", constructcf.OrientName[i], stat.OrientCount[i])
+	}
+	fmt.Fprintf(buffp, "#orientation: %s, mean: %.1f, SD: %.1f\n", constructcf.OrientName[stat.Orient], stat.Mean, stat.SD)
+	fmt.Fprintf(buffp, "#start\tend\tnumber\n")
+	for i, n := range stat.Hist {
+		if n > 0 {
+			fmt.Fprintf(buffp, "%d\t%d\t%d\n", i*InsertHistBinSize, (i+1)*InsertHistBinSize, n)
+		}
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[InsertSizeStatWriter] write file: %s failed, err: %v\n", insertfn, err)
+	}
+}
+
+// GetLibOrient return the orientation declared in the cfg, or detected by the estimation if
+// constructcf.OrientAuto, FR used if pairs not enough or the major orientation not dominant
+func GetLibOrient(lib constructcf.LibInfo, stat InsertSizeStat) int {
+	if lib.Orient != constructcf.OrientAuto {
+		return lib.Orient
+	}
+	if stat.Num < InsertMinPairNum {
+		return constructcf.OrientFR
+	}
+	if stat.Orient != constructcf.OrientFR && stat.OrientCount[stat.Orient]*100 < stat.SampleNum*InsertOrientRate {
+		fmt.Printf("[GetLibOrient] library: %s, orientation: %s not dominant, counts: %v, use FR\n", lib.Name, constructcf.OrientName[stat.Orient], stat.OrientCount)
+		return constructcf.OrientFR
+	}
+	return stat.Orient
+}
+
+// NormalizePairOrient return the pair reads transformed to FR by the reverse complement of
+// RF reads and read2 of FF, the qualities reversed together, flipped marks the transformed reads
+func NormalizePairOrient(pairRI [2]constructcf.ReadInfo, orient int) (nRI [2]constructcf.ReadInfo, flipped [2]bool) {
+	nRI = pairRI
+	for j := 0; j < 2; j++ {
+		if !(orient == constructcf.OrientRF || (orient == constructcf.OrientFF && j == 1)) {
+			continue
+		}
+		flipped[j] = true
+		nRI[j].Seq = constructdbg.GetReverseCompByteArr(pairRI[j].Seq)
+		if len(pairRI[j].Qual) > 0 {
+			nRI[j].Qual = make([]byte, len(pairRI[j].Qual))
+			for i, q := range pairRI[j].Qual {
+				nRI[j].Qual[len(pairRI[j].Qual)-1-i] = q
+			}
+		}
+	}
+	return
+}
@@ -10,9 +10,11 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	//"github.com/google/brotli/cbrotli"
+	"github.com/biogo/hts/sam"
 	"github.com/jwaldrip/odin/cli"
 	"github.com/mudesheng/ga/bnt"
 	"github.com/mudesheng/ga/cbrotli"
@@ -29,6 +31,15 @@ type Options struct {
 	WinSize       int
 	MaxNGSReadLen int
 	Correct       bool
+	SamFormat     string
+	GAF           bool
+	UseInsert     bool   // use the estimated insert size in place of the cfg
+	Fastq         bool   // also output the correct reads in FASTQ with qualities and tags
+	Trim          bool   // trim the adapters and low quality 3' end of reads before ccf
+	DupMode       string // the duplicate pairs "mark" or "drop", "" not detect
+	PathIndex     bool   // write the binary index of correct reads paths
+	Vars          bool   // write the candidate variants of the pair files
+	Reject        bool   // write the reject pair reads of the pair files
 }
 
 func checkArgs(c cli.Command) (opt Options, suc bool) {
@@ -60,6 +71,21 @@ func checkArgs(c cli.Command) (opt Options, suc bool) {
 		log.Fatalf("[checkArgs] argument 'WinSize': %v, must bewteen [3~20] set error: %v\n", c.Flag("WinSize"), err)
 	}
 	opt.WinSize = tmp
+	opt.SamFormat = c.Flag("SamFormat").String()
+	if opt.SamFormat != "" && opt.SamFormat != "sam" && opt.SamFormat != "bam" {
+		log.Fatalf("[checkArgs] argument 'SamFormat': %v must be 'sam' or 'bam'\n", opt.SamFormat)
+	}
+	opt.GAF = c.Flag("GAF").Get().(bool)
+	opt.UseInsert = c.Flag("UseInsert").Get().(bool)
+	opt.Fastq = c.Flag("Fastq").Get().(bool)
+	opt.Trim = c.Flag("Trim").Get().(bool)
+	opt.DupMode = c.Flag("Dup").String()
+	opt.PathIndex = c.Flag("PathIndex").Get().(bool)
+	opt.Vars = c.Flag("Vars").Get().(bool)
+	opt.Reject = c.Flag("Reject").Get().(bool)
+	if opt.DupMode != "" && opt.DupMode != "mark" && opt.DupMode != "drop" {
+		log.Fatalf("[checkArgs] argument 'Dup': %v must be 'mark' or 'drop'\n", opt.DupMode)
+	}
 	if 81 < opt.Kmer && opt.Kmer < 149 && opt.Kmer%2 == 0 {
 		log.Fatalf("the argument 'K': %v must between [81~149] and tmp must been even\n", c.Parent().Flag("K"))
 	}
@@ -80,7 +106,9 @@ func checkArgs(c cli.Command) (opt Options, suc bool) {
 	return opt, suc
 }
 
-func LoadNGSReads(brfn1, brfn2 string, cs chan<- [2]constructcf.ReadInfo, kmerlen, bufSize int) {
+// LoadNGSReads load the pair reads to cs, if ds not nil the duplicate pairs dropped or marked
+// by DupMark in the annotation of read1 according to dupMode
+func LoadNGSReads(brfn1, brfn2 string, cs chan<- [2]constructcf.ReadInfo, kmerlen, bufSize int, ds *DupSet, dupMode string) {
 	fp1, err1 := os.Open(brfn1)
 	if err1 != nil {
 		log.Fatalf("[LoadNGSReads] open file: %v failed..., err: %v\n", brfn1, err1)
@@ -119,11 +147,16 @@ func LoadNGSReads(brfn1, brfn2 string, cs chan<- [2]constructcf.ReadInfo, kmerle
 		var pairRI [2]constructcf.ReadInfo
 		pairRI[0].ID = ri1.ID
 		pairRI[1].ID = ri2.ID
-		if len(ri1.Seq) < kmerlen+20 || len(ri2.Seq) < kmerlen+20 {
-			continue
-		}
 		pairRI[0].Seq = ri1.Seq
 		pairRI[1].Seq = ri2.Seq
+		pairRI[0].Qual = ri1.Qual
+		pairRI[1].Qual = ri2.Qual
+		if ds != nil && ds.IsDup(pairRI) {
+			if dupMode == "drop" {
+				continue
+			}
+			pairRI[0].Anotition = DupMark
+		}
 		cs <- pairRI
 		count++
 		//if len(cs) < 100 {
@@ -615,6 +648,17 @@ func GetPathSeq(m constructdbg.ReadMapInfo, edgesArr []constructdbg.DBGEdge, nod
 	return seq
 }
 
+// GetReadPath return the oriented edges walk of the read mapping
+func GetReadPath(id int64, m constructdbg.ReadMapInfo) (rp constructdbg.ReadPath) {
+	rp.ID = id
+	rp.EIDArr = make([]constructdbg.DBG_MAX_INT, len(m.PathSeqArr))
+	rp.StrandArr = make([]bool, len(m.PathSeqArr))
+	for i, ps := range m.PathSeqArr {
+		rp.EIDArr[i], rp.StrandArr[i] = ps.ID, ps.Strand
+	}
+	return
+}
+
 /*func WriteChanPairReads(riArr [2]constructdbg.ReadMapInfo, edgesArr []constructdbg.DBGEdge, kmerlen int, wc chan<- constructcf.ReadInfo) {
 	for x := 0; x < 2; x++ {
 		var mr constructcf.ReadInfo
@@ -764,33 +808,93 @@ func GetReverseBoolArr(arr []bool) []bool {
 	}
 } */
 
-func paraMapNGSAndMerge(cs <-chan [2]constructcf.ReadInfo, wc chan<- constructcf.ReadInfo, nodesArr []constructdbg.DBGNode, edgesArr []constructdbg.DBGEdge, cf constructdbg.CuckooFilter, winSize, MaxPairLen, SD, kmerlen int) {
+// ngsMapChans is the channels of paraMapNGSAndMerge, the pair reads read from cs, the correct reads
+// send to wc, the output channels sc, gc, pc, vc and rc not used if nil
+type ngsMapChans struct {
+	cs <-chan [2]constructcf.ReadInfo
+	wc chan<- constructcf.ReadInfo
+	sc chan<- []*sam.Record
+	gc chan<- []constructdbg.GAFRecord
+	pc chan<- []constructdbg.ReadPath
+	vc chan<- map[CandVariant]int
+	rc chan<- RejectPair
+}
+
+// ngsMapParam is the library and thresholds of paraMapNGSAndMerge
+type ngsMapParam struct {
+	lib        constructcf.LibInfo
+	fq         bool
+	winSize    int
+	maxPairLen int
+	sd         int
+	kmerlen    int
+}
+
+// paraMapNGSAndMerge map pair reads to the DBG edges and merge, the SAM records of pair send to sc
+// and the GAF records send to gc, the mismatches of base quality lower than
+// lib.MinQual not count against the mapping, the candidate variants send to vc at the end,
+// the pairs not output to wc send to rc with the reject reason and counted in rs,
+// if fq set the correct reads carry the qualities and tags for the FASTQ output,
+// the paths of correct reads send to pc
+func paraMapNGSAndMerge(ch ngsMapChans, rs *RejectStat, refs []*sam.Reference, nodesArr []constructdbg.DBGNode, edgesArr []constructdbg.DBGEdge, cf constructdbg.CuckooFilter, mp ngsMapParam) {
+	cs, wc, sc, gc, pc, vc, rc := ch.cs, ch.wc, ch.sc, ch.gc, ch.pc, ch.vc, ch.rc
+	lib, fq, winSize, MaxPairLen, SD, kmerlen := mp.lib, mp.fq, mp.winSize, mp.maxPairLen, mp.sd, mp.kmerlen
 	var notFoundSeedNum, notPerfectNum, allNum, notMergeNum int
+	var rejectCount [RejectNum]int
+	varMap := make(map[CandVariant]int)
 	for {
 		var mR constructcf.ReadInfo
 		pairRI, ok := <-cs
 		if !ok {
+			rs.Add(allNum, rejectCount)
+			if vc != nil {
+				vc <- varMap
+			}
 			wc <- mR
+			if sc != nil {
+				sc <- nil
+			}
+			if gc != nil {
+				gc <- nil
+			}
+			if pc != nil {
+				pc <- nil
+			}
 			break
 		}
 
 		allNum++
+		if len(pairRI[0].Seq) < kmerlen+20 || len(pairRI[1].Seq) < kmerlen+20 {
+			rejectCount[RejectShortRead]++
+			if rc != nil {
+				rc <- RejectPair{pairRI, RejectShortRead}
+			}
+			continue
+		}
+		// map and merge the pair transformed to FR, the original pair rejected and output to SAM
+		mapRI, flipped := NormalizePairOrient(pairRI, lib.Orient)
 		var riArr [2]constructdbg.ReadMapInfo
 		var errorNum [2]int
+		var rmArr [2]NGSReadMapping
+		var mapped [2]bool
 		needMerge := true
+		reason := RejectNoPath
 		for j := 0; j < 2; j++ {
 			// found kmer seed position in the DBG edges
-			dbgK, pos, strand := constructdbg.LocateSeedKmerCF(cf, pairRI[j], winSize, edgesArr)
-			if dbgK.GetCount() == 0 { // not found in the cuckoofilter
+			rmArr[j] = MapNGSRead(cf, mapRI[j], winSize, edgesArr, nodesArr)
+			mapped[j] = true
+			if !rmArr[j].Seeded { // not found in the cuckoofilter
 				//fmt.Printf("[paraMapNGSAndMerge] read ID: %v not found seed!!!\n", pairRI[j].ID)
 				notFoundSeedNum++
+				needMerge = false
+				reason = RejectNoSeed
 				break
 			}
 			//fmt.Printf("[paraMapNGSAndMerge] pairRI[%v]: %v\n", j, pairRI[j])
 
-			//fmt.Printf("[paraMapNGSAndMerge]readID: %v, dbgK: %v, pos: %v, strand: %v\n", pairRI[0].ID, dbgK, pos, strand)
-			var mappingNum int
-			errorNum[j], mappingNum, riArr[j] = MappingReadToEdges(dbgK, pairRI[j], int(pos), strand, edgesArr, nodesArr, cf.Kmerlen, true)
+			pos := rmArr[j].Pos
+			mappingNum := rmArr[j].MappingNum
+			errorNum[j], riArr[j] = rmArr[j].ErrorNum, rmArr[j].RMI
 			// extend seed map to the edges
 			// map the start partition of read sequence
 			//errorNum1, aB := constructdbg.MappingReadToEdgesBackWard(dbgK, pairRI[j], int(pos), strand, edgesArr, nodesArr, cf.Kmerlen, true)
@@ -806,17 +910,26 @@ func paraMapNGSAndMerge(cs <-chan [2]constructcf.ReadInfo, wc chan<- constructcf
 			//	break
 			//}
 
-			if mappingNum < (len(pairRI[j].Seq)-pos)*9/10 {
+			if mappingNum*100 < (len(pairRI[j].Seq)-pos)*lib.MinMapRate {
 				needMerge = false
-				fmt.Printf("[paraMapNGSAndMerge] mappingNum: %v < %v\n", mappingNum, len(pairRI[j].Seq)*9/10)
+				reason = RejectLowMapRate
+				fmt.Printf("[paraMapNGSAndMerge] mappingNum: %v < %v\n", mappingNum, (len(pairRI[j].Seq)-pos)*lib.MinMapRate/100)
 				break
 			}
 
-			if errorNum[j] > (len(pairRI[j].Seq)-pos)*5/100 {
+			misArr := GetReadMismatches(mapRI[j], rmArr[j], edgesArr, cf.Kmerlen, lib.QualBenchmark)
+			hqErrorNum := CountHighQualMismatches(misArr, lib.MinQual)
+			if hqErrorNum*100 > (len(pairRI[j].Seq)-pos)*lib.MaxErrRate {
 				needMerge = false
-				fmt.Printf("[paraMapNGSAndMerge] errorNum: %v > %v\n", errorNum, len(pairRI[j].Seq)*5/100)
+				reason = RejectHighErr
+				fmt.Printf("[paraMapNGSAndMerge] errorNum: %v, high quality errorNum: %v > %v\n", errorNum, hqErrorNum, (len(pairRI[j].Seq)-pos)*lib.MaxErrRate/100)
 				break
 			}
+			for _, m := range misArr {
+				if vc != nil && m.Qual >= lib.MinQual {
+					varMap[CandVariant{m.EID, m.EPos, m.Alt}]++
+				}
+			}
 			/*if len(aB.Paths) > 0 && len(aF.Paths) > 0 && aB.Paths[len(aB.Paths)-1] == aF.Paths[0] {
 				riArr[j].PathSeqArr = append(aB.Paths, aF.Paths[1:]...)
 				riArr[j].Strands = append(aB.Strands, aF.Strands[1:]...)
@@ -829,15 +942,46 @@ func paraMapNGSAndMerge(cs <-chan [2]constructcf.ReadInfo, wc chan<- constructcf
 			}*/
 			//fmt.Printf("[paraMapNGSAndMerge] riArr[%v]: %v\n", j, riArr[j])
 		}
+		// the mapping of mapRI for the FASTQ qualities, rmArr remapped by pairRI for SAM and GAF
+		mapRM := rmArr
+		if sc != nil || gc != nil {
+			for j := 0; j < 2; j++ {
+				if !mapped[j] || flipped[j] {
+					rmArr[j] = MapNGSRead(cf, pairRI[j], winSize, edgesArr, nodesArr)
+				}
+			}
+		}
+		if sc != nil {
+			sc <- GetPairSamRecords(pairRI, rmArr, refs, edgesArr, cf.Kmerlen, MaxPairLen)
+		}
+		if gc != nil {
+			var gArr []constructdbg.GAFRecord
+			for j := 0; j < 2; j++ {
+				if g, ok := GetReadGAFRecord(pairRI[j], rmArr[j], edgesArr, cf.Kmerlen); ok {
+					gArr = append(gArr, g)
+				}
+			}
+			if len(gArr) > 0 {
+				gc <- gArr
+			}
+		}
 
 		if !needMerge {
 			notPerfectNum++
+			rejectCount[reason]++
+			if rc != nil {
+				rc <- RejectPair{pairRI, reason}
+			}
 			continue
 		}
 
 		l0, l1 := len(riArr[0].PathSeqArr), len(riArr[1].PathSeqArr)
 		if l0 < 1 || l1 < 1 {
 			notPerfectNum++
+			rejectCount[RejectNoPath]++
+			if rc != nil {
+				rc <- RejectPair{pairRI, RejectNoPath}
+			}
 			continue
 		}
 
@@ -860,6 +1004,9 @@ func paraMapNGSAndMerge(cs <-chan [2]constructcf.ReadInfo, wc chan<- constructcf
 		}
 		if len(m.PathSeqArr) < 1 {
 			notMergeNum++
+			if pc != nil {
+				pc <- []constructdbg.ReadPath{GetReadPath(pairRI[0].ID, riArr[0]), GetReadPath(pairRI[1].ID, riArr[1])}
+			}
 			for j := 0; j < 2; j++ {
 				mR.Seq = GetPathSeq(riArr[j], edgesArr, nodesArr, cf.Kmerlen)
 				mR.ID = pairRI[j].ID
@@ -868,6 +1015,13 @@ func paraMapNGSAndMerge(cs <-chan [2]constructcf.ReadInfo, wc chan<- constructcf
 					mR.Anotition += fmt.Sprintf("%v-", pathSeq.ID)
 				}
 				mR.Anotition += fmt.Sprintf(";errorNum:%v, length: %v", errorNum[j], len(mR.Seq))
+				if fq {
+					mR.Qual = GetCorrectReadQual(mR.Seq, mapRI[j:j+1], mapRM[j:j+1], lib.QualBenchmark)
+					mR.Anotition += "\t" + GetCorrectReadTags(riArr[j].PathSeqArr, errorNum[j], false)
+				}
+				if pairRI[0].Anotition != "" {
+					mR.Anotition += "\t" + pairRI[0].Anotition
+				}
 				//fmt.Printf("[paraMapNGSAndMerge]len(mR.Seq): %v,  mR.Seq: %v\n", len(mR.Seq), mR.Seq)
 				wc <- mR
 			}
@@ -878,22 +1032,52 @@ func paraMapNGSAndMerge(cs <-chan [2]constructcf.ReadInfo, wc chan<- constructcf
 				mR.Anotition += fmt.Sprintf("%v-", pathSeq.ID)
 			}
 			mR.Anotition += fmt.Sprintf(";errorNum:%v", errorNum[0]+errorNum[1])
+			if fq {
+				mR.Qual = GetCorrectReadQual(mR.Seq, mapRI[:], mapRM[:], lib.QualBenchmark)
+				mR.Anotition += "\t" + GetCorrectReadTags(m.PathSeqArr, errorNum[0]+errorNum[1], true)
+			}
+			if pairRI[0].Anotition != "" {
+				mR.Anotition += "\t" + pairRI[0].Anotition
+			}
 			//fmt.Printf("[paraMapNGSAndMerge]len(mR.Seq): %v,  mR.Seq: %v\n", len(mR.Seq), mR.Seq)
 			if len(mR.Seq) > len(pairRI[0].Seq) {
 				wc <- mR
+				if pc != nil {
+					pc <- []constructdbg.ReadPath{GetReadPath(m.ID, m)}
+				}
+			} else {
+				rejectCount[RejectShortMerge]++
+				if rc != nil {
+					rc <- RejectPair{pairRI, RejectShortMerge}
+				}
 			}
 		}
 	}
 	fmt.Printf("[paraMapNGSAndMerge] not found seed read pair number is : %v,allNum: %v,  percent: %v\n", notFoundSeedNum, allNum, float32(notFoundSeedNum)/float32(allNum))
 	fmt.Printf("[paraMapNGSAndMerge] too more error mapping read pair number is : %v, notMergeNum: %v\n", notPerfectNum-notFoundSeedNum, notMergeNum)
+	fmt.Printf("[paraMapNGSAndMerge] reject pair number: %v\n", rejectCount)
 }
 
-func writeCorrectReads(browfn string, wc <-chan constructcf.ReadInfo, numCPU, bufSize int) (readNum int) {
+// writeCorrectReads write the correct reads to the FASTA file browfn, and the FASTQ file bfqfn
+// if not empty
+func writeCorrectReads(browfn, bfqfn string, wc <-chan constructcf.ReadInfo, numCPU, bufSize int) (readNum int) {
 	fp, err := os.Create(browfn)
 	if err != nil {
 		log.Fatalf("[writeCorrectReads] failed to create file: %s, err: %v\n", browfn, err)
 	}
 	defer fp.Close()
+	var fqbuffp *bufio.Writer
+	var fqcbrofp *cbrotli.Writer
+	if bfqfn != "" {
+		fqfp, err := os.Create(bfqfn)
+		if err != nil {
+			log.Fatalf("[writeCorrectReads] failed to create file: %s, err: %v\n", bfqfn, err)
+		}
+		defer fqfp.Close()
+		fqcbrofp = cbrotli.NewWriter(fqfp, cbrotli.WriterOptions{Quality: 1})
+		defer fqcbrofp.Close()
+		fqbuffp = bufio.NewWriterSize(fqcbrofp, 1<<25)
+	}
 	//cbrofp := cbrotli.NewWriter(fp, cbrotli.WriterOptions{Quality: 1})
 	cbrofp := cbrotli.NewWriter(fp, cbrotli.WriterOptions{Quality: 1})
 	defer cbrofp.Close()
@@ -915,6 +1099,9 @@ func writeCorrectReads(browfn string, wc <-chan constructcf.ReadInfo, numCPU, bu
 		//seq := constructdbg.Transform2Letters(ri.Seq).String()
 		seq := constructdbg.Transform2Char(ri.Seq)
 		s := fmt.Sprintf(">%v\tpath:%s\n%s\n", ri.ID, ri.Anotition, string(seq))
+		if fqbuffp != nil {
+			fmt.Fprintf(fqbuffp, "@%v\tpath:%s\n%s\n+\n%s\n", ri.ID, ri.Anotition, string(seq), string(ri.Qual))
+		}
 		//cbrofp.Write([]byte(s))
 		buffp.WriteString(s)
 		readNum++
@@ -930,11 +1117,19 @@ func writeCorrectReads(browfn string, wc <-chan constructcf.ReadInfo, numCPU, bu
 	if err := cbrofp.Flush(); err != nil {
 		log.Fatalf("[writeCorrectReads] failed to flush file: %s, err: %v\n", browfn, err)
 	}
+	if fqbuffp != nil {
+		if err := fqbuffp.Flush(); err != nil {
+			log.Fatalf("[writeCorrectReads] failed to flush file: %s, err: %v\n", bfqfn, err)
+		}
+		if err := fqcbrofp.Flush(); err != nil {
+			log.Fatalf("[writeCorrectReads] failed to flush file: %s, err: %v\n", bfqfn, err)
+		}
+	}
 
 	return
 }
 
-func paraProcessReadsFile(fn1, fn2 string, concurrentNum int, nodesArr []constructdbg.DBGNode, edgesArr []constructdbg.DBGEdge, cf constructdbg.CuckooFilter, opt Options, MaxPairLen, InsertSD int, processT chan int) {
+func paraProcessReadsFile(fn1, fn2 string, concurrentNum int, nodesArr []constructdbg.DBGNode, edgesArr []constructdbg.DBGEdge, cf constructdbg.CuckooFilter, pc chan<- []constructdbg.ReadPath, samHeader *sam.Header, refs []*sam.Reference, opt Options, lib constructcf.LibInfo, rs *RejectStat, ds *DupSet, MaxPairLen, InsertSD int, processT chan int) {
 	idx1 := strings.LastIndex(fn1, "1")
 	idx2 := strings.LastIndex(fn2, "2")
 	if !(idx1 > 0 && idx2 > 0 && fn1[:idx1] == fn2[:idx2]) {
@@ -944,14 +1139,75 @@ func paraProcessReadsFile(fn1, fn2 string, concurrentNum int, nodesArr []constru
 	bufSize := 60000
 	cs := make(chan [2]constructcf.ReadInfo, bufSize)
 	wc := make(chan constructcf.ReadInfo, bufSize)
-	go LoadNGSReads(fn1, fn2, cs, opt.Kmer, bufSize)
+	var sc chan []*sam.Record
+	samDone := make(chan int, 1)
+	if opt.SamFormat != "" {
+		sc = make(chan []*sam.Record, bufSize)
+		samfn := fn1[:idx1] + ".Correct." + opt.SamFormat
+		go writeSamRecords(samfn, opt.SamFormat, samHeader, sc, concurrentNum, samDone)
+	}
+	var gc chan []constructdbg.GAFRecord
+	gafDone := make(chan int, 1)
+	if opt.GAF {
+		gc = make(chan []constructdbg.GAFRecord, bufSize)
+		go constructdbg.GAFRecordsWriter(fn1[:idx1]+".Correct.gaf", gc, concurrentNum, gafDone)
+	}
+	var vc chan map[CandVariant]int
+	if opt.Vars {
+		vc = make(chan map[CandVariant]int, concurrentNum)
+	}
+	var rc chan RejectPair
+	rejectDone := make(chan int, 1)
+	if opt.Reject {
+		rc = make(chan RejectPair, bufSize)
+		go writeRejectPairs(GetRejectFn(fn1, idx1), GetRejectFn(fn2, idx2), rc, rejectDone)
+	}
+	go LoadNGSReads(GetLoadFn(fn1, opt), GetLoadFn(fn2, opt), cs, opt.Kmer, bufSize, ds, opt.DupMode)
+	ch := ngsMapChans{cs, wc, sc, gc, pc, vc, rc}
+	mp := ngsMapParam{lib, opt.Fastq, opt.WinSize, MaxPairLen, InsertSD, opt.Kmer}
+	var mapWg sync.WaitGroup
 	for j := 0; j < concurrentNum; j++ {
-		go paraMapNGSAndMerge(cs, wc, nodesArr, edgesArr, cf, opt.WinSize, MaxPairLen, InsertSD, opt.Kmer)
+		mapWg.Add(1)
+		go func() {
+			defer mapWg.Done()
+			paraMapNGSAndMerge(ch, rs, refs, nodesArr, edgesArr, cf, mp)
+		}()
+	}
+	// the reject pairs writer finished by the close of rc after all the mapping goroutines
+	if rc != nil {
+		go func() {
+			mapWg.Wait()
+			close(rc)
+		}()
 	}
 	// write function
 	brwfn := fn1[:idx1] + ".Correct.fa.br"
-	writeNum := writeCorrectReads(brwfn, wc, concurrentNum, bufSize)
+	var bfqfn string
+	if opt.Fastq {
+		bfqfn = fn1[:idx1] + ".Correct.fq.br"
+	}
+	writeNum := writeCorrectReads(brwfn, bfqfn, wc, concurrentNum, bufSize)
 	fmt.Printf("[paraProcessReadsFile] write correct reads num: %d to file: %s\n", writeNum, brwfn)
+	if vc != nil {
+		varMap := make(map[CandVariant]int)
+		for j := 0; j < concurrentNum; j++ {
+			for v, n := range <-vc {
+				varMap[v] += n
+			}
+		}
+		varfn := fn1[:idx1] + ".Correct.vars"
+		varNum := CandVariantsWriter(varMap, edgesArr, varfn)
+		fmt.Printf("[paraProcessReadsFile] write candidate variants num: %d to file: %s\n", varNum, varfn)
+	}
+	if rc != nil {
+		<-rejectDone
+	}
+	if sc != nil {
+		<-samDone
+	}
+	if gc != nil {
+		<-gafDone
+	}
 	processT <- 1
 }
 
@@ -972,6 +1228,26 @@ func MappingNGSAndMerge(opt Options, nodesArr []constructdbg.DBGNode, edgesArr [
 	}
 	fmt.Printf("[MappingNGSAndCorrect] cfgInfo: %v\n", cfgInfo)
 
+	var samHeader *sam.Header
+	var refs []*sam.Reference
+	if opt.SamFormat != "" {
+		samHeader, refs = GetSamHeader(edgesArr)
+		// the references of SAM are the edges of DBG simplified in memory, write them out
+		edgeSet := make([]bool, len(edgesArr))
+		for i, ref := range refs {
+			edgeSet[i] = ref != nil
+		}
+		constructdbg.StoreSubEdgesToFa(opt.Prefix+".Correct.edges.fa", edgesArr, edgeSet)
+	}
+	if opt.GAF {
+		// the paths of GAF walk the edges of DBG simplified in memory
+		constructdbg.GFAWriter(nodesArr, edgesArr, nil, nil, opt.Prefix+".Correct.gfa", opt.Kmer)
+	}
+	if opt.PathIndex {
+		// the read paths index only valid for the DBG simplified in memory, write it out
+		constructdbg.StorePPDBG(opt.Prefix, nodesArr, edgesArr, opt.Kmer)
+	}
+
 	runtime.GOMAXPROCS(opt.NumCPU + 2)
 
 	concurrentNum := 6
@@ -983,21 +1259,76 @@ func MappingNGSAndMerge(opt Options, nodesArr []constructdbg.DBGNode, edgesArr [
 	for i := 0; i < totalNumT; i++ {
 		processT <- 1
 	}
+	var libArr []constructcf.LibInfo
+	var rejectStatArr []*RejectStat
+	var pc chan []constructdbg.ReadPath
+	pathIndexDone := make(chan int, 1)
+	if opt.PathIndex {
+		var pairFilesNum int
+		for _, lib := range cfgInfo.Libs {
+			if lib.AsmFlag != constructcf.AllState && lib.SeqProfile != 1 {
+				continue
+			}
+			pairFilesNum += len(lib.FnName) / 2
+		}
+		pc = make(chan []constructdbg.ReadPath, 60000)
+		go constructdbg.PathIndexRecordsWriter(constructdbg.GetPathIndexFn(opt.Prefix), pc, pairFilesNum*concurrentNum, edgesArr, opt.Kmer, pathIndexDone)
+	}
 	for _, lib := range cfgInfo.Libs {
 		if lib.AsmFlag != constructcf.AllState && lib.SeqProfile != 1 {
 			continue
 		}
 		MaxPairLen := lib.InsertSize + lib.InsertSD
+		InsertSD := lib.InsertSD
+		tlib := lib
+		tlib.FnName = make([]string, len(lib.FnName))
+		for i, fn := range lib.FnName {
+			tlib.FnName[i] = GetLoadFn(fn, opt)
+		}
+		// the estimation is an extra pass of the sample pairs, only done if the estimated
+		// insert size used or the orientation of library not declared
+		var stat InsertSizeStat
+		if opt.UseInsert || lib.Orient == constructcf.OrientAuto {
+			stat = EstimateInsertSize(tlib, cf, nodesArr, edgesArr, opt)
+			insertfn := opt.Prefix + "." + lib.Name + ".insert"
+			InsertSizeStatWriter(stat, lib, insertfn)
+			fmt.Printf("[MappingNGSAndCorrect] library: %s, estimated insert size: %.1f, SD: %.1f, orientation: %s, pairs number: %d, cfg insert size: %d, SD: %d\n", lib.Name, stat.Mean, stat.SD, constructcf.OrientName[stat.Orient], stat.Num, lib.InsertSize, lib.InsertSD)
+			if lib.Orient != constructcf.OrientAuto && stat.Num >= InsertMinPairNum && stat.OrientCount[lib.Orient]*2 < stat.SampleNum {
+				fmt.Printf("[MappingNGSAndCorrect] library: %s, the cfg orientation: %s not the major orientation of pairs, counts: %v\n", lib.Name, constructcf.OrientName[lib.Orient], stat.OrientCount)
+			}
+		}
+		lib.Orient = GetLibOrient(lib, stat)
+		fmt.Printf("[MappingNGSAndCorrect] library: %s, pairs transformed from orientation: %s to FR\n", lib.Name, constructcf.OrientName[lib.Orient])
+		if opt.UseInsert {
+			if stat.Num < InsertMinPairNum {
+				fmt.Printf("[MappingNGSAndCorrect] library: %s, pairs number: %d not enough for estimation, use the cfg insert size\n", lib.Name, stat.Num)
+			} else {
+				MaxPairLen = int(math.Round(stat.Mean + stat.SD))
+				InsertSD = int(math.Round(stat.SD))
+			}
+		}
 
+		rs := &RejectStat{}
+		libArr = append(libArr, lib)
+		rejectStatArr = append(rejectStatArr, rs)
+		// the duplicate pairs dropped in the files of DedupLibs, marked by a new DupSet
+		var ds *DupSet
+		if opt.DupMode == "mark" {
+			ds = NewDupSet()
+		}
 		for i := 0; i < len(lib.FnName)-1; i += 2 {
 			<-processT
-			go paraProcessReadsFile(lib.FnName[i], lib.FnName[i+1], concurrentNum, nodesArr, edgesArr, cf, opt, MaxPairLen, lib.InsertSD, processT)
+			go paraProcessReadsFile(lib.FnName[i], lib.FnName[i+1], concurrentNum, nodesArr, edgesArr, cf, pc, samHeader, refs, opt, lib, rs, ds, MaxPairLen, InsertSD, processT)
 		}
 	}
 
 	for i := 0; i < totalNumT; i++ {
 		<-processT
 	}
+	if pc != nil {
+		<-pathIndexDone
+	}
+	RejectStatWriter(libArr, rejectStatArr, opt.Prefix+".reject")
 	time.Sleep(time.Second)
 }
 
@@ -1006,7 +1337,7 @@ func Correct(c cli.Command) {
 	if suc == false {
 		log.Fatalf("[Correct] check global Arguments error, opt: %v\n", gOpt)
 	}
-	opt := Options{gOpt, 0, 0, 0, 0, true}
+	opt := Options{gOpt, 0, 0, 0, 0, true, "", false, false, false, false, "", false, false, false}
 	tmp, suc := checkArgs(c)
 	if suc == false {
 		log.Fatalf("[Correct] check Arguments error, opt: %v\n", tmp)
@@ -1016,6 +1347,15 @@ func Correct(c cli.Command) {
 	opt.TipMaxLen = tmp.TipMaxLen
 	opt.WinSize = tmp.WinSize
 	opt.Correct = tmp.Correct
+	opt.SamFormat = tmp.SamFormat
+	opt.GAF = tmp.GAF
+	opt.UseInsert = tmp.UseInsert
+	opt.Fastq = tmp.Fastq
+	opt.Trim = tmp.Trim
+	opt.DupMode = tmp.DupMode
+	opt.PathIndex = tmp.PathIndex
+	opt.Vars = tmp.Vars
+	opt.Reject = tmp.Reject
 	cfgInfo, err := constructcf.ParseCfg(opt.CfgFn, opt.Correct)
 	if err != nil {
 		log.Fatalf("[Correct] ParseCfg 'C': %v err :%v\n", opt.CfgFn, err)
@@ -1031,7 +1371,19 @@ func Correct(c cli.Command) {
 	defer pprof.StopCPUProfile()*/
 
 	// construct cuckoofilter and construct DBG
-	constructcf.CCF(c)
+	if opt.Trim || opt.DupMode != "" {
+		var fnArr []string
+		if opt.Trim {
+			fnArr = TrimLibs(opt, cfgInfo)
+		}
+		// the duplicate pairs not counted by ccf
+		if opt.DupMode != "" {
+			fnArr = DedupLibs(opt, cfgInfo)
+		}
+		constructcf.ConstructCFToFiles(constructcf.Options{ArgsOpt: opt.ArgsOpt, CFSize: opt.CFSize, Correct: opt.Correct}, fnArr)
+	} else {
+		constructcf.CCF(c)
+	}
 	constructdbg.CDBG(c)
 	// smfy DBG
 	// read nodes file and transform to array mode for more quckly access
@@ -1039,16 +1391,13 @@ func Correct(c cli.Command) {
 	nodesSize, edgesSize := constructdbg.DBGStatReader(DBGStatfn)
 	//nodesSize := len(nodeMap)
 	fmt.Printf("[Correct] len(nodesArr): %v, length of edge array: %v\n", nodesSize, edgesSize)
-	nodesArr := make([]constructdbg.DBGNode, nodesSize)
-	{
-		nodesfn := opt.Prefix + ".nodes.mmap"
-		nodeMap := constructdbg.NodeMapMmapReader(nodesfn)
-		constructdbg.NodeMap2NodeArr(nodeMap, nodesArr)
-		//nodeMap = nil // nodeMap any more used
+	nodesfn := opt.Prefix + ".nodes.mmap"
+	nodesArr := constructdbg.NodesArrReader(nodesfn, opt.Kmer)
+	if len(nodesArr) != int(nodesSize) {
+		log.Fatalf("[Correct] len(nodesArr): %v != nodes size: %v in file: %v\n", len(nodesArr), nodesSize, DBGStatfn)
 	}
 	// read edges file
-	edgesfn := opt.Prefix + ".edges.fq"
-	edgesArr := constructdbg.ReadEdgesFromFile(edgesfn, edgesSize)
+	edgesArr := constructdbg.LoadCDBGEdgesArr(opt.Prefix, int(edgesSize), opt.Kmer, opt.NumCPU)
 
 	var copt constructdbg.Options
 	copt.CfgFn, copt.Kmer, copt.MaxNGSReadLen, copt.NumCPU, copt.Prefix, copt.TipMaxLen, copt.WinSize = opt.CfgFn, opt.Kmer, opt.MaxNGSReadLen, opt.NumCPU, opt.Prefix, opt.TipMaxLen, opt.WinSize
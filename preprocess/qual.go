@@ -0,0 +1,121 @@
+package preprocess
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+// NoQual is the quality of read base without quality, as high quality
+const NoQual = 255
+
+// ReadMismatch is a read base disagree with the edge, EPos and Alt on the edge plus strand
+type ReadMismatch struct {
+	RPos int
+	Qual int
+	EID  constructdbg.DBG_MAX_INT
+	EPos int
+	Alt  byte
+}
+
+// CandVariant is a candidate variant of edge supported by the high quality mismatches
+type CandVariant struct {
+	EID  constructdbg.DBG_MAX_INT
+	EPos int
+	Alt  byte
+}
+
+// GetBaseQual return the phred quality of read base, NoQual if read has no quality
+func GetBaseQual(ri constructcf.ReadInfo, pos int, qualBenchmark uint8) int {
+	if len(ri.Qual) != len(ri.Seq) {
+		return NoQual
+	}
+	if qualBenchmark == 0 {
+		qualBenchmark = 33
+	}
+	return int(ri.Qual[pos]) - int(qualBenchmark)
+}
+
+// GetReadMismatches return the mismatches of read mapping, the bases in the overlap of
+// neighbour edges reported on the previous edge
+func GetReadMismatches(ri constructcf.ReadInfo, rm NGSReadMapping, edgesArr []constructdbg.DBGEdge, kmerlen int, qualBenchmark uint8) (misArr []ReadMismatch) {
+	segArr := GetAlignSegments(ri, rm, edgesArr, kmerlen)
+	for k, seg := range segArr {
+		if seg.ErrorNum == 0 {
+			continue
+		}
+		ks := edgesArr[seg.EID].Utg.Ks
+		j := 0
+		if k > 0 {
+			j = kmerlen - 1
+		}
+		for ; j < seg.Len; j++ {
+			rp := seg.RStart + j
+			b := ri.Seq[rp]
+			var m ReadMismatch
+			if seg.Strand == constructdbg.PLUS {
+				m.EPos, m.Alt = seg.EStart+j, b
+			} else {
+				m.EPos, m.Alt = seg.EStart+seg.Len-1-j, bnt.BntRev[b]
+			}
+			if ks[m.EPos] == m.Alt {
+				continue
+			}
+			m.RPos, m.EID = rp, seg.EID
+			m.Qual = GetBaseQual(ri, rp, qualBenchmark)
+			misArr = append(misArr, m)
+		}
+	}
+	return
+}
+
+// CountHighQualMismatches return the number of mismatches that base quality not lower than minQual
+func CountHighQualMismatches(misArr []ReadMismatch, minQual int) (num int) {
+	for _, m := range misArr {
+		if m.Qual >= minQual {
+			num++
+		}
+	}
+	return
+}
+
+// CandVariantsWriter write the candidate variants supported by more than one read to the file,
+// columns: edge ID, position, edge base, alternative base and supported reads number
+func CandVariantsWriter(varMap map[CandVariant]int, edgesArr []constructdbg.DBGEdge, varfn string) (varNum int) {
+	var varArr []CandVariant
+	for v, n := range varMap {
+		if n > 1 {
+			varArr = append(varArr, v)
+		}
+	}
+	sort.Slice(varArr, func(i, j int) bool {
+		if varArr[i].EID != varArr[j].EID {
+			return varArr[i].EID < varArr[j].EID
+		}
+		if varArr[i].EPos != varArr[j].EPos {
+			return varArr[i].EPos < varArr[j].EPos
+		}
+		return varArr[i].Alt < varArr[j].Alt
+	})
+	fp, err := os.Create(varfn)
+	if err != nil {
+		log.Fatalf("[CandVariantsWriter] create file: %s failed, err: %v\n", varfn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriter(fp)
+	fmt.Fprintf(buffp, "#edgeID\tpos\tref\talt\treadsNum\n")
+	for _, v := range varArr {
+		ref := edgesArr[v.EID].Utg.Ks[v.EPos]
+		fmt.Fprintf(buffp, "%d\t%d\t%c\t%c\t%d\n", v.EID, v.EPos, bnt.BitNtCharUp[ref], bnt.BitNtCharUp[v.Alt], varMap[v])
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[CandVariantsWriter] write file: %s failed, err: %v\n", varfn, err)
+	}
+	return len(varArr)
+}
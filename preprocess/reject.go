@@ -0,0 +1,133 @@
+package preprocess
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/mudesheng/ga/cbrotli"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+// the reason code of pair reads not output to the correct reads file
+const (
+	RejectShortRead  = iota // read shorter than kmerlen+20
+	RejectNoSeed            // not found seed kmer in the cuckoofilter
+	RejectLowMapRate        // mapping bases rate lower than LibInfo.MinMapRate
+	RejectHighErr           // high quality errors rate higher than LibInfo.MaxErrRate
+	RejectNoPath            // read mapped but path empty
+	RejectShortMerge        // merged read not longer than read1
+	RejectNum
+)
+
+// RejectName is the name of reject reason code
+var RejectName = [RejectNum]string{"ShortRead", "NoSeed", "LowMapRate", "HighErr", "NoPath", "ShortMerge"}
+
+// RejectPair is the uncorrected pair reads with the reject reason
+type RejectPair struct {
+	PairRI [2]constructcf.ReadInfo
+	Reason int
+}
+
+// RejectStat is the number of pair reads processed and rejected of every reason in a library
+type RejectStat struct {
+	sync.Mutex
+	PairNum int
+	Count   [RejectNum]int
+}
+
+// Add add the counts of a goroutine to the library stat
+func (rs *RejectStat) Add(pairNum int, count [RejectNum]int) {
+	rs.Lock()
+	rs.PairNum += pairNum
+	for i := 0; i < RejectNum; i++ {
+		rs.Count[i] += count[i]
+	}
+	rs.Unlock()
+}
+
+// GetRejectFn return the reject file name of pair reads file, keep the suffix *[1|2].[fa|fq].br
+func GetRejectFn(fn string, idx int) string {
+	return fn[:idx] + ".Reject_" + fn[idx:idx+1] + "." + constructcf.GetReadsFileFormat(fn) + ".br"
+}
+
+func writeRejectRead(buffp *bufio.Writer, ri constructcf.ReadInfo, format string, reason int) {
+	seq := constructdbg.Transform2Char(ri.Seq)
+	if format == "fq" && len(ri.Qual) == len(ri.Seq) {
+		fmt.Fprintf(buffp, "@%d\treject:%s\n%s\n+\n%s\n", ri.ID, RejectName[reason], string(seq), string(ri.Qual))
+	} else {
+		fmt.Fprintf(buffp, ">%d\treject:%s\n%s\n", ri.ID, RejectName[reason], string(seq))
+	}
+}
+
+// writeRejectPairs write the reject pair reads to the pair files until rc closed,
+// the reject pairs number send to done after the files flushed
+func writeRejectPairs(fn1, fn2 string, rc <-chan RejectPair, done chan<- int) {
+	var fnArr = [2]string{fn1, fn2}
+	var fpArr [2]*os.File
+	var cbrofpArr [2]*cbrotli.Writer
+	var buffpArr [2]*bufio.Writer
+	var formatArr [2]string
+	for j := 0; j < 2; j++ {
+		fp, err := os.Create(fnArr[j])
+		if err != nil {
+			log.Fatalf("[writeRejectPairs] failed to create file: %s, err: %v\n", fnArr[j], err)
+		}
+		fpArr[j] = fp
+		cbrofpArr[j] = cbrotli.NewWriter(fp, cbrotli.WriterOptions{Quality: 1})
+		buffpArr[j] = bufio.NewWriterSize(cbrofpArr[j], 1<<20)
+		formatArr[j] = constructcf.GetReadsFileFormat(fnArr[j])
+	}
+	var pairNum int
+	for rp := range rc {
+		for j := 0; j < 2; j++ {
+			writeRejectRead(buffpArr[j], rp.PairRI[j], formatArr[j], rp.Reason)
+		}
+		pairNum++
+	}
+	for j := 0; j < 2; j++ {
+		if err := buffpArr[j].Flush(); err != nil {
+			log.Fatalf("[writeRejectPairs] failed to flush file: %s, err: %v\n", fnArr[j], err)
+		}
+		if err := cbrofpArr[j].Close(); err != nil {
+			log.Fatalf("[writeRejectPairs] failed to close file: %s, err: %v\n", fnArr[j], err)
+		}
+		fpArr[j].Close()
+	}
+	fmt.Printf("[writeRejectPairs] write reject pairs num: %d to files: %s, %s\n", pairNum, fn1, fn2)
+	done <- pairNum
+}
+
+// RejectStatWriter write the reject summary table of libraries to the file
+func RejectStatWriter(libArr []constructcf.LibInfo, statArr []*RejectStat, rejectfn string) {
+	fp, err := os.Create(rejectfn)
+	if err != nil {
+		log.Fatalf("[RejectStatWriter] create file: %s failed, err: %v\n", rejectfn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriter(fp)
+	fmt.Fprintf(buffp, "#library\tpairs")
+	for i := 0; i < RejectNum; i++ {
+		fmt.Fprintf(buffp, "\t%s", RejectName[i])
+	}
+	fmt.Fprintf(buffp, "\trejectPercent\n")
+	for i, rs := range statArr {
+		var rejectNum int
+		fmt.Fprintf(buffp, "%s\t%d", libArr[i].Name, rs.PairNum)
+		for _, n := range rs.Count {
+			fmt.Fprintf(buffp, "\t%d", n)
+			rejectNum += n
+		}
+		var percent float64
+		if rs.PairNum > 0 {
+			percent = float64(rejectNum) * 100 / float64(rs.PairNum)
+		}
+		fmt.Fprintf(buffp, "\t%.2f\n", percent)
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[RejectStatWriter] write file: %s failed, err: %v\n", rejectfn, err)
+	}
+}
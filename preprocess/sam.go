@@ -0,0 +1,343 @@
+package preprocess
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+// MaxMapQ is the mapping quality of the read segment mapped to the edge without mismatch,
+// the kmers of DBG are unique, so the mapping quality only decreased by the mismatches
+const MaxMapQ = 60
+
+// NGSReadMapping is the mapping of NGS read to the DBG edges, the read bases [Pos, Pos+MappingNum)
+// mapped to the edges path without gap
+type NGSReadMapping struct {
+	RMI        constructdbg.ReadMapInfo
+	Pos        int // read position of the seed kmer
+	ErrorNum   int
+	MappingNum int
+	Seeded     bool
+}
+
+// AlignSegment is the part of read mapped to an edge, the edge bases [EStart, EStart+Len)
+// mapped to the read bases [RStart, RStart+Len) of the Strand
+type AlignSegment struct {
+	EID      constructdbg.DBG_MAX_INT
+	Strand   bool
+	RStart   int
+	EStart   int
+	Len      int
+	ErrorNum int
+}
+
+// MapNGSRead locate the seed kmer of read and extend the mapping to the DBG edges
+func MapNGSRead(cf constructdbg.CuckooFilter, ri constructcf.ReadInfo, winSize int, edgesArr []constructdbg.DBGEdge, nodesArr []constructdbg.DBGNode) (rm NGSReadMapping) {
+	dbgK, pos, strand := constructdbg.LocateSeedKmerCF(cf, ri, winSize, edgesArr)
+	if dbgK.GetCount() == 0 {
+		return
+	}
+	rm.Seeded = true
+	rm.Pos = pos
+	rm.ErrorNum, rm.MappingNum, rm.RMI = MappingReadToEdges(dbgK, ri, pos, strand, edgesArr, nodesArr, cf.Kmerlen, true)
+	return
+}
+
+// GetAlignSegments split the mapping of read to the segments of every edge in the path,
+// the neighbour segments overlap kmerlen-1 bases
+func GetAlignSegments(ri constructcf.ReadInfo, rm NGSReadMapping, edgesArr []constructdbg.DBGEdge, kmerlen int) (segArr []AlignSegment) {
+	if !rm.Seeded || len(rm.RMI.PathSeqArr) == 0 {
+		return
+	}
+	readEnd := rm.Pos + rm.MappingNum
+	rs := rm.Pos
+	for i, ps := range rm.RMI.PathSeqArr {
+		e := edgesArr[ps.ID]
+		var seg AlignSegment
+		seg.EID, seg.Strand, seg.RStart = ps.ID, ps.Strand, rs
+		if ps.Strand == constructdbg.PLUS {
+			if i == 0 {
+				seg.EStart = rm.RMI.StartP
+			}
+			seg.Len = constructdbg.Min(len(e.Utg.Ks)-seg.EStart, readEnd-rs)
+		} else {
+			end := len(e.Utg.Ks)
+			if i == 0 {
+				end = rm.RMI.StartP
+			}
+			seg.Len = constructdbg.Min(end, readEnd-rs)
+			seg.EStart = end - seg.Len
+		}
+		if seg.Len < kmerlen {
+			log.Fatalf("[GetAlignSegments] read ID: %v segment: %v shorter than kmerlen: %v, mapping: %v\n", ri.ID, seg, kmerlen, rm)
+		}
+		for j := 0; j < seg.Len; j++ {
+			b := ri.Seq[seg.RStart+j]
+			if ps.Strand == constructdbg.PLUS {
+				if b != e.Utg.Ks[seg.EStart+j] {
+					seg.ErrorNum++
+				}
+			} else if b != bnt.BntRev[e.Utg.Ks[seg.EStart+seg.Len-1-j]] {
+				seg.ErrorNum++
+			}
+		}
+		segArr = append(segArr, seg)
+		rs += seg.Len - (kmerlen - 1)
+	}
+	if last := segArr[len(segArr)-1]; last.RStart+last.Len != readEnd {
+		log.Fatalf("[GetAlignSegments] read ID: %v segments end: %v != mapping end: %v\n", ri.ID, last.RStart+last.Len, readEnd)
+	}
+	return
+}
+
+// GetSamHeader return the SAM header that every edge as a reference named by edge ID,
+// refs[edge ID] is the reference of edge
+func GetSamHeader(edgesArr []constructdbg.DBGEdge) (h *sam.Header, refs []*sam.Reference) {
+	refs = make([]*sam.Reference, len(edgesArr))
+	var refArr []*sam.Reference
+	for i, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 {
+			continue
+		}
+		ref, err := sam.NewReference(strconv.Itoa(int(e.ID)), "", "", len(e.Utg.Ks), nil, nil)
+		if err != nil {
+			log.Fatalf("[GetSamHeader] edge ID: %v create reference err: %v\n", e.ID, err)
+		}
+		refs[i] = ref
+		refArr = append(refArr, ref)
+	}
+	h, err := sam.NewHeader(nil, refArr)
+	if err != nil {
+		log.Fatalf("[GetSamHeader] create header err: %v\n", err)
+	}
+	h.Version = "1.6"
+	h.SortOrder = sam.Unsorted
+	return
+}
+
+func getMapQ(errorNum int) byte {
+	if errorNum*10 >= MaxMapQ {
+		return 0
+	}
+	return byte(MaxMapQ - errorNum*10)
+}
+
+func getPrimarySegIdx(segArr []AlignSegment) (idx int) {
+	for i, seg := range segArr {
+		if seg.Len > segArr[idx].Len {
+			idx = i
+		}
+	}
+	return
+}
+
+func getPathTag(segArr []AlignSegment) string {
+	var s string
+	for i, seg := range segArr {
+		if i > 0 {
+			s += ","
+		}
+		if seg.Strand == constructdbg.PLUS {
+			s += fmt.Sprintf("%d+", seg.EID)
+		} else {
+			s += fmt.Sprintf("%d-", seg.EID)
+		}
+	}
+	return s
+}
+
+// the sequence and phred quality of read in the strand of reference
+func getStrandSeqQual(ri constructcf.ReadInfo, strand bool) (seq, qual []byte) {
+	bs := ri.Seq
+	if strand == constructdbg.MINUS {
+		bs = constructdbg.GetReverseCompByteArr(ri.Seq)
+	}
+	seq = constructdbg.Transform2Char(bs)
+	if len(ri.Qual) == len(ri.Seq) {
+		qual = make([]byte, len(ri.Qual))
+		for i, q := range ri.Qual {
+			if strand == constructdbg.PLUS {
+				qual[i] = q - 33
+			} else {
+				qual[len(qual)-1-i] = q - 33
+			}
+		}
+	}
+	return
+}
+
+func getSegCigar(seg AlignSegment, readLen int) (co []sam.CigarOp) {
+	left, right := seg.RStart, readLen-seg.RStart-seg.Len
+	if seg.Strand == constructdbg.MINUS {
+		left, right = right, left
+	}
+	if left > 0 {
+		co = append(co, sam.NewCigarOp(sam.CigarSoftClipped, left))
+	}
+	co = append(co, sam.NewCigarOp(sam.CigarMatch, seg.Len))
+	if right > 0 {
+		co = append(co, sam.NewCigarOp(sam.CigarSoftClipped, right))
+	}
+	return
+}
+
+// GetPairSamRecords return the SAM records of pair reads, every edge segment of read output a
+// record, the longest segment as the primary and others as the supplementary, the mate fields
+// point to the primary record of mate, read maps to the same edge with mate in opposite strand
+// and template length not longer than maxPairLen set ProperPair flag
+func GetPairSamRecords(pairRI [2]constructcf.ReadInfo, rmArr [2]NGSReadMapping, refs []*sam.Reference, edgesArr []constructdbg.DBGEdge, kmerlen, maxPairLen int) (recArr []*sam.Record) {
+	var segArr [2][]AlignSegment
+	var primary [2]AlignSegment
+	for j := 0; j < 2; j++ {
+		segArr[j] = GetAlignSegments(pairRI[j], rmArr[j], edgesArr, kmerlen)
+		if len(segArr[j]) > 0 {
+			primary[j] = segArr[j][getPrimarySegIdx(segArr[j])]
+		}
+	}
+	// template length and proper pair by the primary segments
+	var tlen [2]int
+	proper := false
+	if len(segArr[0]) > 0 && len(segArr[1]) > 0 && primary[0].EID == primary[1].EID {
+		p0, p1 := primary[0], primary[1]
+		start, end := constructdbg.Min(p0.EStart, p1.EStart), constructdbg.MaxInt(p0.EStart+p0.Len, p1.EStart+p1.Len)
+		if p0.EStart <= p1.EStart {
+			tlen[0], tlen[1] = end-start, start-end
+		} else {
+			tlen[0], tlen[1] = start-end, end-start
+		}
+		if p0.Strand != p1.Strand && end-start <= maxPairLen {
+			plus, minus := p0, p1
+			if p0.Strand == constructdbg.MINUS {
+				plus, minus = p1, p0
+			}
+			proper = plus.EStart <= minus.EStart+minus.Len
+		}
+	}
+
+	name := strconv.FormatInt(pairRI[0].ID, 10)
+	for j := 0; j < 2; j++ {
+		ri := pairRI[j]
+		m := 1 - j
+		mateMapped := len(segArr[m]) > 0
+		flags := sam.Paired
+		if j == 0 {
+			flags |= sam.Read1
+		} else {
+			flags |= sam.Read2
+		}
+		if proper {
+			flags |= sam.ProperPair
+		}
+		if !mateMapped {
+			flags |= sam.MateUnmapped
+		} else if primary[m].Strand == constructdbg.MINUS {
+			flags |= sam.MateReverse
+		}
+		if len(segArr[j]) == 0 {
+			// unmapped read placed at the mate position
+			ref, pos := (*sam.Reference)(nil), -1
+			if mateMapped {
+				ref, pos = refs[primary[m].EID], primary[m].EStart
+			}
+			seq, qual := getStrandSeqQual(ri, constructdbg.PLUS)
+			r, err := sam.NewRecord(name, ref, ref, pos, pos, 0, 0, nil, seq, qual, nil)
+			if err != nil {
+				log.Fatalf("[GetPairSamRecords] read ID: %v create record err: %v\n", ri.ID, err)
+			}
+			r.Flags = flags | sam.Unmapped
+			recArr = append(recArr, r)
+			continue
+		}
+		pathTag, err := sam.NewAux(sam.NewTag("XP"), getPathTag(segArr[j]))
+		if err != nil {
+			log.Fatalf("[GetPairSamRecords] create XP tag err: %v\n", err)
+		}
+		for _, seg := range segArr[j] {
+			ref := refs[seg.EID]
+			mRef, mPos, tl := ref, seg.EStart, 0
+			if mateMapped {
+				mRef, mPos = refs[primary[m].EID], primary[m].EStart
+				if seg.EID == primary[m].EID {
+					tl = tlen[j]
+				}
+			}
+			nm, err := sam.NewAux(sam.NewTag("NM"), int32(seg.ErrorNum))
+			if err != nil {
+				log.Fatalf("[GetPairSamRecords] create NM tag err: %v\n", err)
+			}
+			seq, qual := getStrandSeqQual(ri, seg.Strand)
+			r, err := sam.NewRecord(name, ref, mRef, seg.EStart, mPos, tl, getMapQ(seg.ErrorNum), getSegCigar(seg, len(ri.Seq)), seq, qual, []sam.Aux{nm, pathTag})
+			if err != nil {
+				log.Fatalf("[GetPairSamRecords] read ID: %v create record err: %v\n", ri.ID, err)
+			}
+			r.Flags = flags
+			if seg.Strand == constructdbg.MINUS {
+				r.Flags |= sam.Reverse
+			}
+			if seg != primary[j] {
+				r.Flags |= sam.Supplementary
+			}
+			recArr = append(recArr, r)
+		}
+	}
+	return
+}
+
+type samRecordWriter interface {
+	Write(r *sam.Record) error
+}
+
+// writeSamRecords write the records from sc to the SAM or BAM file decided by format,
+// every mapping goroutine send nil at the end
+func writeSamRecords(fn, format string, h *sam.Header, sc <-chan []*sam.Record, numCPU int, done chan<- int) {
+	fp, err := os.Create(fn)
+	if err != nil {
+		log.Fatalf("[writeSamRecords] failed to create file: %s, err: %v\n", fn, err)
+	}
+	defer fp.Close()
+	var w samRecordWriter
+	var bw *bam.Writer
+	if format == "bam" {
+		bw, err = bam.NewWriter(fp, h, 1)
+		if err != nil {
+			log.Fatalf("[writeSamRecords] create bam writer of file: %s err: %v\n", fn, err)
+		}
+		w = bw
+	} else {
+		sw, err := sam.NewWriter(fp, h, sam.FlagDecimal)
+		if err != nil {
+			log.Fatalf("[writeSamRecords] create sam writer of file: %s err: %v\n", fn, err)
+		}
+		w = sw
+	}
+	var finishNum, recordNum int
+	for recArr := range sc {
+		if recArr == nil {
+			finishNum++
+			if finishNum == numCPU {
+				break
+			}
+			continue
+		}
+		for _, r := range recArr {
+			if err := w.Write(r); err != nil {
+				log.Fatalf("[writeSamRecords] write record: %v to file: %s err: %v\n", r, fn, err)
+			}
+			recordNum++
+		}
+	}
+	if bw != nil {
+		if err := bw.Close(); err != nil {
+			log.Fatalf("[writeSamRecords] failed to close file: %s, err: %v\n", fn, err)
+		}
+	}
+	fmt.Printf("[writeSamRecords] write records num: %d to file: %s\n", recordNum, fn)
+	done <- recordNum
+}
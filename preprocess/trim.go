@@ -0,0 +1,300 @@
+package preprocess
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mudesheng/ga/cbrotli"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+const (
+	TrimMinOverlap       = 12 // the min overlap of read and adapter
+	TrimMaxMisRate       = 10 // the max percent of mismatches in the overlap
+	TrimPairMinOverlap   = 20 // the min overlap of pair reads
+	TrimPairExactOverlap = 30 // the overlap of pair reads shorter than it must match exactly
+)
+
+// TrimCount is the trimming counts of reads
+type TrimCount struct {
+	PairNum, ReadNum       int
+	BaseNum, TrimBaseNum   int64
+	OverlapNum, AdapterNum int // reads trimmed by the pair overlap and by the adapters list
+	QualNum                int // reads trimmed the low quality 3' end
+	DiscardNum             int // pairs(single reads) discarded shorter than min read length
+}
+
+// TrimStat is the trimming counts of a library
+type TrimStat struct {
+	sync.Mutex
+	TrimCount
+}
+
+// Add add the counts of a file to the library stat
+func (ts *TrimStat) Add(c TrimCount) {
+	ts.Lock()
+	ts.PairNum += c.PairNum
+	ts.ReadNum += c.ReadNum
+	ts.BaseNum += c.BaseNum
+	ts.TrimBaseNum += c.TrimBaseNum
+	ts.OverlapNum += c.OverlapNum
+	ts.AdapterNum += c.AdapterNum
+	ts.QualNum += c.QualNum
+	ts.DiscardNum += c.DiscardNum
+	ts.Unlock()
+}
+
+// GetTrimFn return the trimmed file name of reads file, *.[fa|fq].br to *.Trim.[fa|fq].br
+func GetTrimFn(fn string) string {
+	format := constructcf.GetReadsFileFormat(fn)
+	idx := strings.LastIndex(fn[:strings.LastIndex(fn, ".")], ".")
+	return fn[:idx] + ".Trim." + format + ".br"
+}
+
+// GetQualTrimLen return the read length after trimming the low quality 3' end, the cut position
+// maximize the sum of (trimQual - quality) of the trimmed bases
+func GetQualTrimLen(qual []byte, trimQual int, qualBenchmark uint8) int {
+	if qualBenchmark == 0 {
+		qualBenchmark = 33
+	}
+	l := len(qual)
+	var sum, maxSum int
+	for i := len(qual) - 1; i >= 0; i-- {
+		sum += trimQual - (int(qual[i]) - int(qualBenchmark))
+		if sum < 0 {
+			break
+		}
+		if sum > maxSum {
+			maxSum, l = sum, i
+		}
+	}
+	return l
+}
+
+func overlapMatch(s1, s2 []byte, allow int) bool {
+	var mis int
+	for i, b := range s1 {
+		if b != s2[i] {
+			mis++
+			if mis > allow {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// GetAdapterPos return the start position of adapter in the read, the adapter may run out
+// the read end, return len(seq) if not found
+func GetAdapterPos(seq, adapter []byte) int {
+	for p := 0; p+TrimMinOverlap <= len(seq); p++ {
+		l := constructdbg.Min(len(adapter), len(seq)-p)
+		if overlapMatch(seq[p:p+l], adapter[:l], l*TrimMaxMisRate/100) {
+			return p
+		}
+	}
+	return len(seq)
+}
+
+// GetPairOverlapLen return the fragment length of pair reads shorter than both reads, the
+// bases of read after the fragment length are the adapter read-through, the overlap shorter than
+// TrimPairExactOverlap not allow mismatch, return 0 if not found
+func GetPairOverlapLen(seq1, seq2 []byte) int {
+	rseq2 := constructdbg.GetReverseCompByteArr(seq2)
+	for l := constructdbg.Min(len(seq1), len(seq2)) - 1; l >= TrimPairMinOverlap; l-- {
+		var allow int
+		if l >= TrimPairExactOverlap {
+			allow = l * TrimMaxMisRate / 100
+		}
+		if overlapMatch(seq1[:l], rseq2[len(rseq2)-l:], allow) {
+			return l
+		}
+	}
+	return 0
+}
+
+// trimRead trim the read to the length l, qualities trimmed together
+func trimRead(ri *constructcf.ReadInfo, l int) {
+	ri.Seq = ri.Seq[:l]
+	if len(ri.Qual) > l {
+		ri.Qual = ri.Qual[:l]
+	}
+}
+
+// TrimReads trim the adapters and the low quality 3' end of pair(len(riArr) == 2) or
+// single reads, return false if any read shorter than minLen after trimming
+func TrimReads(riArr []constructcf.ReadInfo, lib constructcf.LibInfo, adapters [][]byte, minLen int, tc *TrimCount) bool {
+	for _, ri := range riArr {
+		tc.ReadNum++
+		tc.BaseNum += int64(len(ri.Seq))
+	}
+	if len(riArr) == 2 {
+		tc.PairNum++
+		if l := GetPairOverlapLen(riArr[0].Seq, riArr[1].Seq); l > 0 {
+			for j := 0; j < 2; j++ {
+				tc.TrimBaseNum += int64(len(riArr[j].Seq) - l)
+				trimRead(&riArr[j], l)
+				tc.OverlapNum++
+			}
+		}
+	}
+	ok := true
+	for j := range riArr {
+		ri := &riArr[j]
+		l := len(ri.Seq)
+		for _, ad := range adapters {
+			l = constructdbg.Min(l, GetAdapterPos(ri.Seq[:l], ad))
+		}
+		if l < len(ri.Seq) {
+			tc.AdapterNum++
+			tc.TrimBaseNum += int64(len(ri.Seq) - l)
+			trimRead(ri, l)
+		}
+		if len(ri.Qual) == len(ri.Seq) {
+			if l = GetQualTrimLen(ri.Qual, lib.TrimQual, lib.QualBenchmark); l < len(ri.Seq) {
+				tc.QualNum++
+				tc.TrimBaseNum += int64(len(ri.Seq) - l)
+				trimRead(ri, l)
+			}
+		}
+		if len(ri.Seq) < minLen {
+			ok = false
+		}
+	}
+	if !ok {
+		tc.DiscardNum++
+	}
+	return ok
+}
+
+func writeReadRecord(buffp *bufio.Writer, ri constructcf.ReadInfo, format string) {
+	seq := constructdbg.Transform2Char(ri.Seq)
+	if format == "fq" && len(ri.Qual) == len(ri.Seq) {
+		fmt.Fprintf(buffp, "@%d\n%s\n+\n%s\n", ri.ID, string(seq), string(ri.Qual))
+	} else {
+		fmt.Fprintf(buffp, ">%d\n%s\n", ri.ID, string(seq))
+	}
+}
+
+// paraTrimReadsFile trim the reads of the pair files or the single file if fnArr has one file,
+// write to the files of GetTrimFn
+func paraTrimReadsFile(fnArr []string, lib constructcf.LibInfo, adapters [][]byte, minLen int, ts *TrimStat, processT chan int) {
+	n := len(fnArr)
+	buffpArr := make([]*bufio.Reader, n)
+	wbuffpArr := make([]*bufio.Writer, n)
+	cbrofpArr := make([]*cbrotli.Writer, n)
+	formatArr := make([]string, n)
+	for j, fn := range fnArr {
+		fp, err := os.Open(fn)
+		if err != nil {
+			log.Fatalf("[paraTrimReadsFile] open file: %v failed..., err: %v\n", fn, err)
+		}
+		defer fp.Close()
+		brfp := cbrotli.NewReaderSize(fp, 1<<20)
+		defer brfp.Close()
+		buffpArr[j] = bufio.NewReader(brfp)
+		formatArr[j] = constructcf.GetReadsFileFormat(fn)
+		tfn := GetTrimFn(fn)
+		wfp, err := os.Create(tfn)
+		if err != nil {
+			log.Fatalf("[paraTrimReadsFile] create file: %v failed..., err: %v\n", tfn, err)
+		}
+		defer wfp.Close()
+		cbrofpArr[j] = cbrotli.NewWriter(wfp, cbrotli.WriterOptions{Quality: 1})
+		wbuffpArr[j] = bufio.NewWriterSize(cbrofpArr[j], 1<<20)
+	}
+	var tc TrimCount
+	riArr := make([]constructcf.ReadInfo, n)
+	for {
+		var eofNum int
+		for j := 0; j < n; j++ {
+			var err error
+			riArr[j], err = constructcf.GetReadFileRecord(buffpArr[j], formatArr[j], false)
+			if riArr[j].ID == 0 && err == io.EOF {
+				eofNum++
+			}
+		}
+		if eofNum == n {
+			break
+		} else if eofNum > 0 || riArr[0].ID != riArr[n-1].ID {
+			log.Fatalf("[paraTrimReadsFile] files: %v not consis, read ID: %v != %v\n", fnArr, riArr[0].ID, riArr[n-1].ID)
+		}
+		if !TrimReads(riArr, lib, adapters, minLen, &tc) {
+			continue
+		}
+		for j := 0; j < n; j++ {
+			writeReadRecord(wbuffpArr[j], riArr[j], formatArr[j])
+		}
+	}
+	for j := 0; j < n; j++ {
+		if err := wbuffpArr[j].Flush(); err != nil {
+			log.Fatalf("[paraTrimReadsFile] failed to flush file: %s, err: %v\n", GetTrimFn(fnArr[j]), err)
+		}
+		if err := cbrofpArr[j].Close(); err != nil {
+			log.Fatalf("[paraTrimReadsFile] failed to close file: %s, err: %v\n", GetTrimFn(fnArr[j]), err)
+		}
+	}
+	fmt.Printf("[paraTrimReadsFile] files: %v, trim count: %+v\n", fnArr, tc)
+	ts.Add(tc)
+	processT <- 1
+}
+
+// TrimLibs trim the reads files of libraries used by ccf, write the trimming statistics
+// to the file opt.Prefix+".trim", return the trimmed files
+func TrimLibs(opt Options, cfgInfo constructcf.CfgInfo) (trimFnArr []string) {
+	minLen := constructdbg.MaxInt(cfgInfo.MinRdLen, opt.Kmer)
+	processT := make(chan int, opt.NumCPU)
+	for i := 0; i < opt.NumCPU; i++ {
+		processT <- 1
+	}
+	var libArr []constructcf.LibInfo
+	var statArr []*TrimStat
+	for _, lib := range cfgInfo.Libs {
+		if lib.AsmFlag != constructcf.AllState && lib.SeqProfile != 1 {
+			continue
+		}
+		adapters := make([][]byte, len(lib.Adapters))
+		for i, ad := range lib.Adapters {
+			adapters[i] = constructcf.Transform2BntByte([]byte(ad))
+		}
+		ts := &TrimStat{}
+		libArr = append(libArr, lib)
+		statArr = append(statArr, ts)
+		for i := 0; i < len(lib.FnName); i += 2 {
+			fnArr := lib.FnName[i:constructdbg.Min(i+2, len(lib.FnName))]
+			<-processT
+			go paraTrimReadsFile(fnArr, lib, adapters, minLen, ts, processT)
+		}
+		for _, fn := range lib.FnName {
+			trimFnArr = append(trimFnArr, GetTrimFn(fn))
+		}
+	}
+	for i := 0; i < opt.NumCPU; i++ {
+		<-processT
+	}
+	TrimStatWriter(libArr, statArr, opt.Prefix+".trim")
+	return
+}
+
+// TrimStatWriter write the trimming statistics table of libraries to the file
+func TrimStatWriter(libArr []constructcf.LibInfo, statArr []*TrimStat, trimfn string) {
+	fp, err := os.Create(trimfn)
+	if err != nil {
+		log.Fatalf("[TrimStatWriter] create file: %s failed, err: %v\n", trimfn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriter(fp)
+	fmt.Fprintf(buffp, "#library\tpairs\treads\tbases\ttrimmedBases\toverlapTrimmed\tadapterTrimmed\tqualTrimmed\tdiscarded\n")
+	for i, ts := range statArr {
+		fmt.Fprintf(buffp, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", libArr[i].Name, ts.PairNum, ts.ReadNum, ts.BaseNum, ts.TrimBaseNum, ts.OverlapNum, ts.AdapterNum, ts.QualNum, ts.DiscardNum)
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[TrimStatWriter] write file: %s failed, err: %v\n", trimfn, err)
+	}
+}
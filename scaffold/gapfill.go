@@ -0,0 +1,483 @@
+package scaffold
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/io/seqio/fasta"
+	"github.com/biogo/biogo/seq/linear"
+	"github.com/jwaldrip/odin/cli"
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/constructdbg"
+	"github.com/mudesheng/ga/preprocess"
+	"github.com/mudesheng/ga/utils"
+)
+
+const (
+	GapFillSlack       = 1000 // the fill allowed longer than twice of the gap length
+	GapMinKmerCount    = 2    // the min count of kmer extended in the local assembly
+	GapFlankKmerRegion = 1000 // the right flank region searched for the local assembly closed
+)
+
+// the state of gap after filling
+const (
+	GapOpen = iota
+	GapFillDBG
+	GapFillLocal
+	GapStateNum
+)
+
+// GapStateName is the name of gap state
+var GapStateName = [GapStateNum]string{"Open", "DBG", "Local"}
+
+// Gap is a N run of the scaffold between the pieces Left and Right, closed by Fill, Overlap is the
+// bases of Right piece overlapped with the Left piece
+type Gap struct {
+	SID, Pos, Len int
+	Left, Right   int
+	Fill          []byte
+	Overlap       int
+	State         int
+}
+
+// GapScaffolds is the scaffolds split to the pieces by the gaps
+type GapScaffolds struct {
+	NameArr      []string
+	PieceArr     []Contig
+	ScafPieceArr [][]int
+	GapArr       []Gap
+	LeftGapArr   []int // the gap on the left of piece, -1 for none
+	RightGapArr  []int
+}
+
+// LoadGapScaffolds read the scaffolds of the fasta file, split to the pieces by the runs of 'N'
+func LoadGapScaffolds(fn string) (gs GapScaffolds) {
+	fp, err := os.Open(fn)
+	if err != nil {
+		log.Fatalf("[LoadGapScaffolds] open file: %s failed, err: %v\n", fn, err)
+	}
+	defer fp.Close()
+	fafp := fasta.NewReader(bufio.NewReader(fp), linear.NewSeq("", nil, alphabet.DNA))
+	for {
+		s, err := fafp.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			log.Fatalf("[LoadGapScaffolds] read file: %s failed, err: %v\n", fn, err)
+		}
+		l := s.(*linear.Seq)
+		sid := len(gs.NameArr)
+		gs.NameArr = append(gs.NameArr, l.ID)
+		var pieceIdxArr []int
+		for i := 0; i < len(l.Seq); {
+			j := i
+			isN := l.Seq[i] == 'N' || l.Seq[i] == 'n'
+			for j < len(l.Seq) && (l.Seq[j] == 'N' || l.Seq[j] == 'n') == isN {
+				j++
+			}
+			if isN {
+				if len(pieceIdxArr) > 0 {
+					gs.GapArr = append(gs.GapArr, Gap{SID: sid, Pos: i, Len: j - i, Left: pieceIdxArr[len(pieceIdxArr)-1], Right: -1})
+				}
+			} else {
+				var ctg Contig
+				ctg.Name = fmt.Sprintf("%s:%d-%d", l.ID, i+1, j)
+				ctg.Seq = make([]byte, j-i)
+				for k, v := range l.Seq[i:j] {
+					ctg.Seq[k] = bnt.Base2Bnt[v]
+				}
+				pi := len(gs.PieceArr)
+				gs.PieceArr = append(gs.PieceArr, ctg)
+				gs.LeftGapArr = append(gs.LeftGapArr, -1)
+				gs.RightGapArr = append(gs.RightGapArr, -1)
+				if n := len(gs.GapArr); n > 0 && gs.GapArr[n-1].SID == sid && gs.GapArr[n-1].Right < 0 {
+					gs.GapArr[n-1].Right = pi
+					gs.LeftGapArr[pi] = n - 1
+					gs.RightGapArr[gs.GapArr[n-1].Left] = n - 1
+				}
+				pieceIdxArr = append(pieceIdxArr, pi)
+			}
+			i = j
+		}
+		// the trailing N run not a gap
+		if n := len(gs.GapArr); n > 0 && gs.GapArr[n-1].SID == sid && gs.GapArr[n-1].Right < 0 {
+			gs.GapArr = gs.GapArr[:n-1]
+		}
+		gs.ScafPieceArr = append(gs.ScafPieceArr, pieceIdxArr)
+	}
+	return
+}
+
+// getOrientEdgeSeq return the edge sequence of the strand
+func getOrientEdgeSeq(e constructdbg.DBGEdge, strand bool) []byte {
+	if strand == constructdbg.PLUS {
+		return e.Utg.Ks
+	}
+	return constructdbg.GetReverseCompByteArr(e.Utg.Ks)
+}
+
+// mapFlankAnchor map the anchor to the edge, the anchor must be inside the edge, return the edge,
+// the strand and the start of anchor in the oriented edge
+func mapFlankAnchor(cf constructdbg.CuckooFilter, anchor []byte, winSize int, edgesArr []constructdbg.DBGEdge) (eID constructdbg.DBG_MAX_INT, strand bool, start int, ok bool) {
+	var ri constructcf.ReadInfo
+	ri.Seq = anchor
+	h, ok := MapReadToEdge(cf, ri, winSize, edgesArr)
+	if !ok {
+		return
+	}
+	el := len(edgesArr[h.CID].Utg.Ks)
+	if h.Start < 0 || h.End > el {
+		ok = false
+		return
+	}
+	eID, strand, start = constructdbg.DBG_MAX_INT(h.CID), h.Strand, h.Start
+	if strand == constructdbg.MINUS {
+		start = el - h.End
+	}
+	return
+}
+
+// FillGapByDBG close the gap by the unique path between the edges of flanks in the DBG
+func FillGapByDBG(g *Gap, left, right []byte, cf constructdbg.CuckooFilter, nodesArr []constructdbg.DBGNode, edgesArr []constructdbg.DBGEdge, winSize, kmerlen int) bool {
+	anchorLen := 2*kmerlen + 10*winSize
+	la, ra := left[len(left)-constructdbg.Min(anchorLen, len(left)):], right[:constructdbg.Min(anchorLen, len(right))]
+	eID1, strand1, start1, ok1 := mapFlankAnchor(cf, la, winSize, edgesArr)
+	eID2, strand2, start2, ok2 := mapFlankAnchor(cf, ra, winSize, edgesArr)
+	if !ok1 || !ok2 {
+		return false
+	}
+	e1, e2 := edgesArr[eID1], edgesArr[eID2]
+	seq := getOrientEdgeSeq(e1, strand1)
+	leftEnd, rightStart := start1+len(la), start2
+	if eID1 == eID2 && strand1 == strand2 && start2 >= start1 {
+		// both flanks in the same edge
+	} else {
+		nID1, nID2 := e1.EndNID, e2.StartNID
+		if strand1 == constructdbg.MINUS {
+			nID1 = e1.StartNID
+		}
+		if strand2 == constructdbg.MINUS {
+			nID2 = e2.EndNID
+		}
+		maxAllowLen := len(e1.Utg.Ks) + 2*g.Len + GapFillSlack
+		pathArr := preprocess.GetPairReadsLinkPathArr(e1, e2, nID1, nID2, maxAllowLen, nodesArr, edgesArr, kmerlen)
+		if len(pathArr) != 1 {
+			return false
+		}
+		nID := nID1
+		for _, id := range pathArr[0][1:] {
+			ne := edgesArr[id]
+			strand := constructdbg.PLUS
+			if ne.StartNID == nID {
+				nID = ne.EndNID
+			} else {
+				strand = constructdbg.MINUS
+				nID = ne.StartNID
+			}
+			rightStart = len(seq) - (kmerlen - 1) + start2
+			seq = append(seq[:len(seq):len(seq)], getOrientEdgeSeq(ne, strand)[kmerlen-1:]...)
+		}
+	}
+	if rightStart >= leftEnd {
+		g.Fill = append([]byte(nil), seq[leftEnd:rightStart]...)
+	} else {
+		g.Overlap = leftEnd - rightStart
+	}
+	g.State = GapFillDBG
+	return true
+}
+
+// LocalAssembleGap close the gap by the greedy kmer extension of the left flank, the kmers counted
+// by the reads of both strands, the extension stop at a kmer of the right flank
+func LocalAssembleGap(g *Gap, left, right []byte, readArr [][]byte, kmerlen int) bool {
+	if len(left) < kmerlen || len(right) < kmerlen {
+		return false
+	}
+	countMap := make(map[string]int)
+	for _, r := range readArr {
+		for _, s := range [2][]byte{r, constructdbg.GetReverseCompByteArr(r)} {
+			for i := 0; i+kmerlen <= len(s); i++ {
+				countMap[string(s[i:i+kmerlen])]++
+			}
+		}
+	}
+	rightMap := make(map[string]int)
+	for i := constructdbg.Min(len(right), GapFlankKmerRegion) - kmerlen; i >= 0; i-- {
+		rightMap[string(right[i:i+kmerlen])] = i
+	}
+	maxLen := 2*g.Len + GapFillSlack
+	seq := append([]byte(nil), left[len(left)-kmerlen:]...)
+	visited := make(map[string]bool)
+	for len(seq)-kmerlen <= maxLen {
+		kb := string(seq[len(seq)-kmerlen:])
+		if p, ok := rightMap[kb]; ok {
+			// the right flank start at len(seq)-kmerlen-p of seq
+			if fl := len(seq) - kmerlen - p - kmerlen; fl >= 0 {
+				g.Fill = append([]byte(nil), seq[kmerlen:kmerlen+fl]...)
+			} else {
+				g.Overlap = -fl
+			}
+			g.State = GapFillLocal
+			return true
+		}
+		if visited[kb] {
+			return false
+		}
+		visited[kb] = true
+		var best, second, bestBase int
+		next := []byte(kb[1:] + " ")
+		for b := 0; b < bnt.BaseTypeNum; b++ {
+			next[kmerlen-1] = byte(b)
+			c := countMap[string(next)]
+			if c > best {
+				best, second, bestBase = c, best, b
+			} else if c > second {
+				second = c
+			}
+		}
+		if best < GapMinKmerCount || second*100 >= best*ScafConflictRate {
+			return false
+		}
+		seq = append(seq, byte(bestBase))
+	}
+	return false
+}
+
+// anchorStrand return the read strand of FR orientation
+func anchorStrand(strand bool, j, orient int) bool {
+	if orient == constructcf.OrientRF || (orient == constructcf.OrientFF && j == 1) {
+		return !strand
+	}
+	return strand
+}
+
+// paraCollectGapReads collect the reads of the open gaps, the mates of reads anchored in the flanks
+// and point to the gap, and the reads run out the flanks into the gap
+func paraCollectGapReads(cs <-chan [2]constructcf.ReadInfo, rc chan<- map[int][][]byte, cf constructdbg.CuckooFilter, edgesArr []constructdbg.DBGEdge, gs *GapScaffolds, ins InsertInfo, winSize int) {
+	readMap := make(map[int][][]byte)
+	maxDist := int(ins.Mean + 3*ins.SD)
+	isOpen := func(gi int) bool { return gi >= 0 && gs.GapArr[gi].State == GapOpen }
+	for pairRI := range cs {
+		var hits [2]ReadHit
+		var oks [2]bool
+		for j := 0; j < 2; j++ {
+			hits[j], oks[j] = MapReadToContig(cf, pairRI[j], winSize, edgesArr)
+		}
+		for j := 0; j < 2; j++ {
+			if !oks[j] {
+				continue
+			}
+			h := hits[j]
+			pl := len(gs.PieceArr[h.CID].Seq)
+			if gi := gs.RightGapArr[h.CID]; isOpen(gi) {
+				if h.End > pl {
+					readMap[gi] = append(readMap[gi], pairRI[j].Seq)
+				}
+				if !oks[1-j] && anchorStrand(h.Strand, j, ins.Orient) == constructdbg.PLUS && pl-h.Start < maxDist {
+					readMap[gi] = append(readMap[gi], pairRI[1-j].Seq)
+				}
+			}
+			if gi := gs.LeftGapArr[h.CID]; isOpen(gi) {
+				if h.Start < 0 {
+					readMap[gi] = append(readMap[gi], pairRI[j].Seq)
+				}
+				if !oks[1-j] && anchorStrand(h.Strand, j, ins.Orient) == constructdbg.MINUS && h.End < maxDist {
+					readMap[gi] = append(readMap[gi], pairRI[1-j].Seq)
+				}
+			}
+		}
+	}
+	rc <- readMap
+}
+
+// CollectGapReads return the reads of the open gaps collected from the pairs of library
+func CollectGapReads(lib constructcf.LibInfo, cf constructdbg.CuckooFilter, edgesArr []constructdbg.DBGEdge, gs *GapScaffolds, ins InsertInfo, opt GapOptions) map[int][][]byte {
+	bufSize := 60000
+	readMap := make(map[int][][]byte)
+	for i := 0; i+1 < len(lib.FnName); i += 2 {
+		cs := make(chan [2]constructcf.ReadInfo, bufSize)
+		rc := make(chan map[int][][]byte, opt.NumCPU)
+		go preprocess.LoadNGSReads(lib.FnName[i], lib.FnName[i+1], cs, cf.Kmerlen, bufSize, nil, "")
+		for j := 0; j < opt.NumCPU; j++ {
+			go paraCollectGapReads(cs, rc, cf, edgesArr, gs, ins, opt.WinSize)
+		}
+		for j := 0; j < opt.NumCPU; j++ {
+			for gi, arr := range <-rc {
+				readMap[gi] = append(readMap[gi], arr...)
+			}
+		}
+	}
+	return readMap
+}
+
+// GetGapLibs return the pair libraries used by the gap filling
+func GetGapLibs(cfgInfo constructcf.CfgInfo) (libArr []constructcf.LibInfo) {
+	for _, lib := range cfgInfo.Libs {
+		if lib.AsmFlag != constructcf.AllState && lib.AsmFlag != constructcf.GapState {
+			continue
+		}
+		if lib.SeqProfile != 1 || len(lib.FnName) < 2 || lib.InsertSize <= 0 {
+			continue
+		}
+		libArr = append(libArr, lib)
+	}
+	return
+}
+
+// WriteGapFillScaffolds write the scaffolds with the gaps filled, the open gaps keep the N runs
+func WriteGapFillScaffolds(gs GapScaffolds, fafn string) {
+	fp, err := os.Create(fafn)
+	if err != nil {
+		log.Fatalf("[WriteGapFillScaffolds] create file: %s failed, err: %v\n", fafn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriterSize(fp, 1<<20)
+	for sid, pieceIdxArr := range gs.ScafPieceArr {
+		var seq []byte
+		for _, pi := range pieceIdxArr {
+			ps := gs.PieceArr[pi].Seq
+			if gi := gs.LeftGapArr[pi]; gi >= 0 {
+				g := gs.GapArr[gi]
+				if g.State == GapOpen {
+					for n := 0; n < g.Len; n++ {
+						seq = append(seq, 'N')
+					}
+				} else {
+					seq = append(seq, constructdbg.Transform2Char(g.Fill)...)
+					ps = ps[constructdbg.Min(g.Overlap, len(ps)):]
+				}
+			}
+			seq = append(seq, constructdbg.Transform2Char(ps)...)
+		}
+		fmt.Fprintf(buffp, ">%s\tlen:%d\n", gs.NameArr[sid], len(seq))
+		for p := 0; p < len(seq); p += 80 {
+			buffp.Write(seq[p:constructdbg.Min(p+80, len(seq))])
+			buffp.WriteByte('\n')
+		}
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[WriteGapFillScaffolds] write file: %s failed, err: %v\n", fafn, err)
+	}
+}
+
+// GapStatWriter write the state of every gap to the file
+func GapStatWriter(gs GapScaffolds, gapfn string) {
+	fp, err := os.Create(gapfn)
+	if err != nil {
+		log.Fatalf("[GapStatWriter] create file: %s failed, err: %v\n", gapfn, err)
+	}
+	defer fp.Close()
+	buffp := bufio.NewWriter(fp)
+	var stateNum [GapStateNum]int
+	fmt.Fprintf(buffp, "#scaffold\tstart\tend\tgapLen\tstate\tfillLen\n")
+	for _, g := range gs.GapArr {
+		stateNum[g.State]++
+		fillLen := len(g.Fill) - g.Overlap
+		if g.State == GapOpen {
+			fillLen = 0
+		}
+		fmt.Fprintf(buffp, "%s\t%d\t%d\t%d\t%s\t%d\n", gs.NameArr[g.SID], g.Pos+1, g.Pos+g.Len, g.Len, GapStateName[g.State], fillLen)
+	}
+	if err := buffp.Flush(); err != nil {
+		log.Fatalf("[GapStatWriter] write file: %s failed, err: %v\n", gapfn, err)
+	}
+	fmt.Printf("[GapStatWriter] gaps number: %d, closed by DBG: %d, closed by local assembly: %d, remaining: %d\n", len(gs.GapArr), stateNum[GapFillDBG], stateNum[GapFillLocal], stateNum[GapOpen])
+}
+
+type GapOptions struct {
+	utils.ArgsOpt
+	WinSize     int
+	SeedLen     int
+	ScaffoldsFn string // default prefix+".scaffolds.fa" of scaffold
+}
+
+func checkGapArgs(c cli.Command) (opt GapOptions, succ bool) {
+	var ok bool
+	opt.WinSize, ok = c.Flag("WinSize").Get().(int)
+	if !ok {
+		log.Fatalf("[checkGapArgs] argument 'WinSize': %v set error\n ", c.Flag("WinSize").String())
+	}
+	if opt.WinSize < 1 || opt.WinSize > 100 {
+		log.Fatalf("[checkGapArgs] argument 'WinSize': %v must between 1~100\n", c.Flag("WinSize"))
+	}
+	opt.SeedLen, ok = c.Flag("SeedLen").Get().(int)
+	if !ok {
+		log.Fatalf("[checkGapArgs] argument 'SeedLen': %v set error\n ", c.Flag("SeedLen").String())
+	}
+	if opt.SeedLen < 15 || opt.SeedLen > 127 || opt.SeedLen%2 == 0 {
+		log.Fatalf("[checkGapArgs] argument 'SeedLen': %v must be odd and between 15~127\n", c.Flag("SeedLen"))
+	}
+	opt.ScaffoldsFn = c.Flag("Scaffolds").String()
+	succ = true
+	return
+}
+
+func GapFill(c cli.Command) {
+	gOpt, suc := utils.CheckGlobalArgs(c.Parent())
+	if suc == false {
+		log.Fatalf("[GapFill] check global Arguments error, opt: %v\n", gOpt)
+	}
+	opt := GapOptions{gOpt, 0, 0, ""}
+	tmp, suc := checkGapArgs(c)
+	if suc == false {
+		log.Fatalf("[GapFill] check Arguments error, opt: %v\n", tmp)
+	}
+	opt.WinSize = tmp.WinSize
+	opt.SeedLen = tmp.SeedLen
+	opt.ScaffoldsFn = tmp.ScaffoldsFn
+	if opt.ScaffoldsFn == "" {
+		opt.ScaffoldsFn = opt.Prefix + ".scaffolds.fa"
+	}
+	fmt.Printf("Arguments: %v\n", opt)
+
+	gs := LoadGapScaffolds(opt.ScaffoldsFn)
+	fmt.Printf("[GapFill] scaffolds number: %d, gaps number: %d\n", len(gs.NameArr), len(gs.GapArr))
+
+	// the paths of DBG between the flanks
+	DBGInfofn := opt.Prefix + ".smfy.DBGInfo"
+	eSize, nSize := constructdbg.DBGInfoReader(DBGInfofn)
+	nodesArr := constructdbg.NodesArrReader(opt.Prefix+".nodes.smfy.Arr", opt.Kmer)
+	if len(nodesArr) != nSize {
+		log.Fatalf("[GapFill] len(nodesArr): %v != nodesArr Size: %v in file: %v\n", len(nodesArr), nSize, DBGInfofn)
+	}
+	edgesArr := constructdbg.LoadSmfyEdgesArr(opt.Prefix, eSize, opt.Kmer, opt.NumCPU)
+	cfSize := constructdbg.GetCuckoofilterDBGSampleSize(edgesArr, int64(opt.WinSize), int64(math.MaxInt32), int64(opt.Kmer))
+	cf := constructdbg.MakeCuckooFilter(uint64(cfSize*7), opt.Kmer)
+	constructdbg.ConstructCFDBGMinimizers(cf, edgesArr, opt.WinSize, math.MaxInt32)
+	for i := range gs.GapArr {
+		g := &gs.GapArr[i]
+		FillGapByDBG(g, gs.PieceArr[g.Left].Seq, gs.PieceArr[g.Right].Seq, cf, nodesArr, edgesArr, opt.WinSize, opt.Kmer)
+	}
+	nodesArr, edgesArr = nil, nil
+
+	// the local assembly of reads anchored in the flanks
+	cfgInfo, err := constructcf.ParseCfg(opt.CfgFn, true)
+	if err != nil {
+		log.Fatalf("[GapFill] ParseCfg 'C': %v err: %v\n", opt.CfgFn, err)
+	}
+	pieceEdgesArr := GetContigEdgesArr(gs.PieceArr, opt.SeedLen+opt.WinSize)
+	cfSize = constructdbg.GetCuckoofilterDBGSampleSize(pieceEdgesArr, int64(opt.WinSize), int64(math.MaxInt32), int64(opt.SeedLen))
+	pcf := constructdbg.MakeCuckooFilter(uint64(cfSize*7), opt.SeedLen)
+	constructdbg.ConstructCFDBGMinimizers(pcf, pieceEdgesArr, opt.WinSize, math.MaxInt32)
+	readMap := make(map[int][][]byte)
+	for _, lib := range GetGapLibs(cfgInfo) {
+		ins := GetLibInsert(lib, pcf, pieceEdgesArr, opt.WinSize)
+		for gi, arr := range CollectGapReads(lib, pcf, pieceEdgesArr, &gs, ins, opt) {
+			readMap[gi] = append(readMap[gi], arr...)
+		}
+	}
+	for gi, readArr := range readMap {
+		g := &gs.GapArr[gi]
+		LocalAssembleGap(g, gs.PieceArr[g.Left].Seq, gs.PieceArr[g.Right].Seq, readArr, opt.SeedLen)
+	}
+
+	WriteGapFillScaffolds(gs, opt.Prefix+".gapfill.fa")
+	GapStatWriter(gs, opt.Prefix+".gapfill.gaps")
+}
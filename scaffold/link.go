@@ -0,0 +1,272 @@
+package scaffold
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/mudesheng/ga/constructdbg"
+)
+
+// InsertInfo is the insert size and pair reads orientation of library used for the links
+type InsertInfo struct {
+	Mean, SD float64
+	Orient   int
+}
+
+// ScafElem is a contig in the scaffold, Gap is the estimated gap to the previous contig
+type ScafElem struct {
+	CID    int
+	Strand bool
+	Gap    int
+}
+
+// ContigPos is the position and strand of contig in the scaffold
+type ContigPos struct {
+	SID, Off int
+	Strand   bool
+}
+
+// LinkKey is the pair of scaffold ends, 2*SID for the left end and 2*SID+1 for the right end, End1 < End2
+type LinkKey struct {
+	End1, End2 int
+}
+
+// LinkInfo is the number of pairs support the link and the sum of gaps estimated
+type LinkInfo struct {
+	Num, GapSum int
+}
+
+// GetGapLen return the N number of gap in the scaffold sequence
+func GetGapLen(gap int) int {
+	return constructdbg.MaxInt(gap, ScafMinGap)
+}
+
+// GetContigPosArr return the positions of contigs in the scaffolds and the length of scaffolds
+func GetContigPosArr(scafArr [][]ScafElem, contigArr []Contig) (cpArr []ContigPos, scafLenArr []int) {
+	cpArr = make([]ContigPos, len(contigArr))
+	scafLenArr = make([]int, len(scafArr))
+	for i, sc := range scafArr {
+		var off int
+		for j, se := range sc {
+			if j > 0 {
+				off += GetGapLen(se.Gap)
+			}
+			cpArr[se.CID] = ContigPos{i, off, se.Strand}
+			off += len(contigArr[se.CID].Seq)
+		}
+		scafLenArr[i] = off
+	}
+	return
+}
+
+// GetPairLink return the link of scaffold ends and the gap estimated by the pair reads of FR orientation,
+// the fragment contain more bases of the scaffolds than Mean+3*SD not linked
+func GetPairLink(hits [2]ReadHit, cpArr []ContigPos, scafLenArr []int, edgesArr []constructdbg.DBGEdge, ins InsertInfo) (k LinkKey, gap int, ok bool) {
+	var end, inner [2]int
+	for j, h := range hits {
+		cp := cpArr[h.CID]
+		start, strand := cp.Off+h.Start, h.Strand
+		if cp.Strand == constructdbg.MINUS {
+			start = cp.Off + len(edgesArr[h.CID+2].Utg.Ks) - h.End
+			strand = !strand
+		}
+		if strand == constructdbg.PLUS {
+			end[j] = 2*cp.SID + 1
+			inner[j] = scafLenArr[cp.SID] - start
+		} else {
+			end[j] = 2 * cp.SID
+			inner[j] = start + (h.End - h.Start)
+		}
+	}
+	if end[0]/2 == end[1]/2 || float64(inner[0]+inner[1]) > ins.Mean+3*ins.SD {
+		return
+	}
+	gap = int(ins.Mean) - inner[0] - inner[1]
+	if end[0] > end[1] {
+		end[0], end[1] = end[1], end[0]
+	}
+	k = LinkKey{end[0], end[1]}
+	ok = true
+	return
+}
+
+// reverseScaf return the reverse complement scaffold, the gaps moved with the contigs
+func reverseScaf(sc []ScafElem) []ScafElem {
+	rsc := make([]ScafElem, len(sc))
+	for i, se := range sc {
+		j := len(sc) - 1 - i
+		rsc[j] = ScafElem{CID: se.CID, Strand: !se.Strand}
+		if i > 0 {
+			rsc[j+1].Gap = se.Gap
+		}
+	}
+	return rsc
+}
+
+func findRoot(parent []int, i int) int {
+	for parent[i] != i {
+		parent[i] = parent[parent[i]]
+		i = parent[i]
+	}
+	return i
+}
+
+// JoinScaffolds join the scaffolds by the links supported by at least minLinkNum pairs, a link
+// used only if it is the best link of both ends and not conflict with the second, no cycle created
+func JoinScaffolds(scafArr [][]ScafElem, linkMap map[LinkKey]LinkInfo, minLinkNum int) (newArr [][]ScafElem, joinNum int) {
+	type link struct {
+		LinkKey
+		LinkInfo
+	}
+	var linkArr []link
+	for k, li := range linkMap {
+		if li.Num >= minLinkNum {
+			linkArr = append(linkArr, link{k, li})
+		}
+	}
+	sort.Slice(linkArr, func(i, j int) bool {
+		if linkArr[i].Num != linkArr[j].Num {
+			return linkArr[i].Num > linkArr[j].Num
+		}
+		if linkArr[i].End1 != linkArr[j].End1 {
+			return linkArr[i].End1 < linkArr[j].End1
+		}
+		return linkArr[i].End2 < linkArr[j].End2
+	})
+	best := make(map[int]int)
+	second := make(map[int]int)
+	for i, l := range linkArr {
+		for _, e := range [2]int{l.End1, l.End2} {
+			if _, ok := best[e]; !ok {
+				best[e] = i
+			} else if _, ok := second[e]; !ok {
+				second[e] = l.Num
+			}
+		}
+	}
+	adj := make([]int, 2*len(scafArr))
+	gapArr := make([]int, 2*len(scafArr))
+	for i := range adj {
+		adj[i] = -1
+	}
+	parent := make([]int, len(scafArr))
+	for i := range parent {
+		parent[i] = i
+	}
+	for i, l := range linkArr {
+		if best[l.End1] != i || best[l.End2] != i {
+			continue
+		}
+		if second[l.End1]*100 >= l.Num*ScafConflictRate || second[l.End2]*100 >= l.Num*ScafConflictRate {
+			continue
+		}
+		r1, r2 := findRoot(parent, l.End1/2), findRoot(parent, l.End2/2)
+		if r1 == r2 {
+			continue
+		}
+		parent[r1] = r2
+		adj[l.End1], adj[l.End2] = l.End2, l.End1
+		gapArr[l.End1], gapArr[l.End2] = l.GapSum/l.Num, l.GapSum/l.Num
+		joinNum++
+	}
+	visited := make([]bool, len(scafArr))
+	for i := range scafArr {
+		if visited[i] {
+			continue
+		}
+		// walk to the free end of the chain
+		freeEnd := 2 * i
+		for adj[freeEnd] >= 0 {
+			freeEnd = adj[freeEnd] ^ 1
+		}
+		var sc []ScafElem
+		for e, gap := freeEnd, 0; ; {
+			sid := e / 2
+			visited[sid] = true
+			part := scafArr[sid]
+			if e%2 == 1 {
+				part = reverseScaf(part)
+			}
+			start := len(sc)
+			sc = append(sc, part...)
+			sc[start].Gap = gap
+			next := e ^ 1
+			if adj[next] < 0 {
+				break
+			}
+			e, gap = adj[next], gapArr[next]
+		}
+		newArr = append(newArr, sc)
+	}
+	return
+}
+
+// WriteScaffolds write the scaffolds sequence with N gaps to the fasta file and the layout to
+// the AGP file, scaffolds sorted by length from long to short
+func WriteScaffolds(scafArr [][]ScafElem, contigArr []Contig, fafn, agpfn string) {
+	_, scafLenArr := GetContigPosArr(scafArr, contigArr)
+	idxArr := make([]int, len(scafArr))
+	for i := range idxArr {
+		idxArr[i] = i
+	}
+	sort.SliceStable(idxArr, func(i, j int) bool { return scafLenArr[idxArr[i]] > scafLenArr[idxArr[j]] })
+	fafp, err := os.Create(fafn)
+	if err != nil {
+		log.Fatalf("[WriteScaffolds] create file: %s failed, err: %v\n", fafn, err)
+	}
+	defer fafp.Close()
+	agpfp, err := os.Create(agpfn)
+	if err != nil {
+		log.Fatalf("[WriteScaffolds] create file: %s failed, err: %v\n", agpfn, err)
+	}
+	defer agpfp.Close()
+	fabuf := bufio.NewWriterSize(fafp, 1<<20)
+	agpbuf := bufio.NewWriterSize(agpfp, 1<<20)
+	fmt.Fprintf(agpbuf, "##agp-version\t2.0\n")
+	var totalLen, multiNum int
+	for i, idx := range idxArr {
+		sc := scafArr[idx]
+		name := fmt.Sprintf("scaffold_%d", i+1)
+		if len(sc) > 1 {
+			multiNum++
+		}
+		var seq []byte
+		part := 1
+		for j, se := range sc {
+			if j > 0 {
+				gl := GetGapLen(se.Gap)
+				fmt.Fprintf(agpbuf, "%s\t%d\t%d\t%d\tN\t%d\tscaffold\tyes\tpaired-ends\n", name, len(seq)+1, len(seq)+gl, part, gl)
+				part++
+				for n := 0; n < gl; n++ {
+					seq = append(seq, 'N')
+				}
+			}
+			ctg := contigArr[se.CID]
+			cs := ctg.Seq
+			orient := '+'
+			if se.Strand == constructdbg.MINUS {
+				cs = constructdbg.GetReverseCompByteArr(cs)
+				orient = '-'
+			}
+			fmt.Fprintf(agpbuf, "%s\t%d\t%d\t%d\tW\t%s\t1\t%d\t%c\n", name, len(seq)+1, len(seq)+len(cs), part, ctg.Name, len(cs), orient)
+			part++
+			seq = append(seq, constructdbg.Transform2Char(cs)...)
+		}
+		fmt.Fprintf(fabuf, ">%s\tlen:%d\tcontigs:%d\n", name, len(seq), len(sc))
+		for p := 0; p < len(seq); p += 80 {
+			fabuf.Write(seq[p:constructdbg.Min(p+80, len(seq))])
+			fabuf.WriteByte('\n')
+		}
+		totalLen += len(seq)
+	}
+	if err := fabuf.Flush(); err != nil {
+		log.Fatalf("[WriteScaffolds] write file: %s failed, err: %v\n", fafn, err)
+	}
+	if err := agpbuf.Flush(); err != nil {
+		log.Fatalf("[WriteScaffolds] write file: %s failed, err: %v\n", agpfn, err)
+	}
+	fmt.Printf("[WriteScaffolds] scaffolds number: %d, multi-contigs scaffolds number: %d, total length: %d\n", len(scafArr), multiNum, totalLen)
+}
@@ -0,0 +1,394 @@
+package scaffold
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/io/seqio/fasta"
+	"github.com/biogo/biogo/seq/linear"
+	"github.com/jwaldrip/odin/cli"
+	"github.com/mudesheng/ga/bnt"
+	"github.com/mudesheng/ga/constructcf"
+	"github.com/mudesheng/ga/constructdbg"
+	"github.com/mudesheng/ga/preprocess"
+	"github.com/mudesheng/ga/utils"
+)
+
+const (
+	ScafMaxMisRate   = 5  // the max percent of mismatches of read and contig in the overlap
+	ScafMinGap       = 10 // the min N number of gap, used for the gaps estimated shorter
+	ScafConflictRate = 50 // the scaffold end not joined if the second link not less than this percent of the best
+)
+
+type Options struct {
+	utils.ArgsOpt
+	WinSize      int
+	SeedLen      int
+	MinLinkNum   int
+	MinContigLen int
+	ContigFn     string // default prefix+".edges.DcDBG.fq" of decdbg
+}
+
+func checkArgs(c cli.Command) (opt Options, succ bool) {
+	var ok bool
+	opt.WinSize, ok = c.Flag("WinSize").Get().(int)
+	if !ok {
+		log.Fatalf("[checkArgs] argument 'WinSize': %v set error\n ", c.Flag("WinSize").String())
+	}
+	if opt.WinSize < 1 || opt.WinSize > 100 {
+		log.Fatalf("[checkArgs] argument 'WinSize': %v must between 1~100\n", c.Flag("WinSize"))
+	}
+	opt.SeedLen, ok = c.Flag("SeedLen").Get().(int)
+	if !ok {
+		log.Fatalf("[checkArgs] argument 'SeedLen': %v set error\n ", c.Flag("SeedLen").String())
+	}
+	if opt.SeedLen < 15 || opt.SeedLen > 127 || opt.SeedLen%2 == 0 {
+		log.Fatalf("[checkArgs] argument 'SeedLen': %v must be odd and between 15~127\n", c.Flag("SeedLen"))
+	}
+	opt.MinLinkNum, ok = c.Flag("MinLinkNum").Get().(int)
+	if !ok {
+		log.Fatalf("[checkArgs] argument 'MinLinkNum': %v set error\n ", c.Flag("MinLinkNum").String())
+	}
+	if opt.MinLinkNum < 1 {
+		log.Fatalf("[checkArgs] argument 'MinLinkNum': %v must bigger than 0\n", c.Flag("MinLinkNum"))
+	}
+	opt.MinContigLen, ok = c.Flag("MinContigLen").Get().(int)
+	if !ok {
+		log.Fatalf("[checkArgs] argument 'MinContigLen': %v set error\n ", c.Flag("MinContigLen").String())
+	}
+	opt.ContigFn = c.Flag("Contigs").String()
+	succ = true
+	return
+}
+
+// Contig is the sequence unit of scaffolding
+type Contig struct {
+	Name   string
+	Seq    []byte
+	EIDArr []constructdbg.DBG_MAX_INT // the path of DBG edges annotated by decdbg
+}
+
+// get the edges path of the decdbg contig description "path: 2-5-7\tFreq: 3"
+func getContigPath(desc string) (eIDArr []constructdbg.DBG_MAX_INT) {
+	if !strings.HasPrefix(desc, "path: ") {
+		return
+	}
+	ps := strings.TrimPrefix(strings.Split(desc, "\t")[0], "path: ")
+	for _, f := range strings.Split(ps, "-") {
+		id, err := strconv.Atoi(f)
+		if err != nil {
+			log.Fatalf("[getContigPath] contig description: %s path error, err: %v\n", desc, err)
+		}
+		eIDArr = append(eIDArr, constructdbg.DBG_MAX_INT(id))
+	}
+	return
+}
+
+// LoadContigs read the contigs of the fasta file
+func LoadContigs(fn string) (contigArr []Contig) {
+	fp, err := os.Open(fn)
+	if err != nil {
+		log.Fatalf("[LoadContigs] open file: %s failed, err: %v\n", fn, err)
+	}
+	defer fp.Close()
+	fafp := fasta.NewReader(bufio.NewReader(fp), linear.NewSeq("", nil, alphabet.DNA))
+	for {
+		s, err := fafp.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			log.Fatalf("[LoadContigs] read file: %s failed, err: %v\n", fn, err)
+		}
+		l := s.(*linear.Seq)
+		var ctg Contig
+		ctg.Name = l.ID
+		ctg.EIDArr = getContigPath(l.Annotation.Desc)
+		ctg.Seq = make([]byte, len(l.Seq))
+		for j, v := range l.Seq {
+			ctg.Seq[j] = bnt.Base2Bnt[v]
+		}
+		contigArr = append(contigArr, ctg)
+	}
+	return
+}
+
+// GetUniqueEdgesContigs return the unique edges of the smfy DBG not in the joined set as the contigs
+func GetUniqueEdgesContigs(opt Options, joined map[constructdbg.DBG_MAX_INT]bool) (contigArr []Contig) {
+	DBGInfofn := opt.Prefix + ".smfy.DBGInfo"
+	eSize, nSize := constructdbg.DBGInfoReader(DBGInfofn)
+	nodesArr := constructdbg.NodesArrReader(opt.Prefix+".nodes.smfy.Arr", opt.Kmer)
+	if len(nodesArr) != nSize {
+		log.Fatalf("[GetUniqueEdgesContigs] len(nodesArr): %v != nodesArr Size: %v in file: %v\n", len(nodesArr), nSize, DBGInfofn)
+	}
+	edgesArr := constructdbg.LoadSmfyEdgesArr(opt.Prefix, eSize, opt.Kmer, opt.NumCPU)
+	constructdbg.SetDBGEdgesUniqueFlag(edgesArr, nodesArr)
+	for _, e := range edgesArr {
+		if e.ID < 2 || e.GetDeleteFlag() > 0 || e.GetUniqueFlag() == 0 || joined[e.ID] {
+			continue
+		}
+		contigArr = append(contigArr, Contig{Name: "edge_" + strconv.Itoa(int(e.ID)), Seq: e.Utg.Ks})
+	}
+	return
+}
+
+// GetContigEdgesArr wrap the contigs as the edges for the cuckoofilter sampling, the contig i
+// is the edge i+2, contigs shorter than minLen marked deleted and not mapped
+func GetContigEdgesArr(contigArr []Contig, minLen int) []constructdbg.DBGEdge {
+	edgesArr := make([]constructdbg.DBGEdge, len(contigArr)+2)
+	for i, ctg := range contigArr {
+		e := &edgesArr[i+2]
+		e.ID = constructdbg.DBG_MAX_INT(i + 2)
+		e.Utg.Ks = ctg.Seq
+		if len(ctg.Seq) < minLen {
+			e.SetDeleteFlag()
+		}
+	}
+	return edgesArr
+}
+
+// ReadHit is the ungapped mapping of read to the contig, [Start, End) is the read projected
+// to the contig coordinates and may run out the contig
+type ReadHit struct {
+	CID        int
+	Start, End int
+	Strand     bool
+}
+
+// MapReadToContig locate the read by the seed kmer, the mismatches of overlap checked
+func MapReadToContig(cf constructdbg.CuckooFilter, ri constructcf.ReadInfo, winSize int, edgesArr []constructdbg.DBGEdge) (h ReadHit, ok bool) {
+	h, ok = MapReadToEdge(cf, ri, winSize, edgesArr)
+	h.CID -= 2
+	return
+}
+
+// MapReadToEdge is the same as MapReadToContig, but the hit CID is the edge ID
+func MapReadToEdge(cf constructdbg.CuckooFilter, ri constructcf.ReadInfo, winSize int, edgesArr []constructdbg.DBGEdge) (h ReadHit, ok bool) {
+	if len(ri.Seq) < cf.Kmerlen+winSize {
+		return
+	}
+	dk, pos, strand := constructdbg.LocateSeedKmerCF(cf, ri, winSize, edgesArr)
+	if dk.GetCount() == 0 {
+		return
+	}
+	ks := edgesArr[dk.ID].Utg.Ks
+	seq := ri.Seq
+	h.CID = int(dk.ID)
+	if dk.Strand == strand {
+		h.Strand = constructdbg.PLUS
+		h.Start = int(dk.Pos) - pos
+	} else {
+		h.Strand = constructdbg.MINUS
+		h.Start = int(dk.Pos) + cf.Kmerlen + pos - len(seq)
+		seq = constructdbg.GetReverseCompByteArr(seq)
+	}
+	h.End = h.Start + len(seq)
+	lo, hi := constructdbg.MaxInt(h.Start, 0), constructdbg.Min(h.End, len(ks))
+	var mis int
+	for p := lo; p < hi; p++ {
+		if seq[p-h.Start] != ks[p] {
+			mis++
+		}
+	}
+	ok = mis*100 <= (hi-lo)*ScafMaxMisRate
+	return
+}
+
+// getHitsFragment return the fragment length and orientation of pair reads mapped to the same contig
+func getHitsFragment(hits [2]ReadHit) (fragLen, orient int) {
+	fragLen = constructdbg.MaxInt(hits[0].End, hits[1].End) - constructdbg.Min(hits[0].Start, hits[1].Start)
+	if hits[0].Strand == hits[1].Strand {
+		orient = constructcf.OrientFF
+	} else {
+		p, m := 0, 1
+		if hits[0].Strand == constructdbg.MINUS {
+			p, m = 1, 0
+		}
+		if hits[p].Start <= hits[m].Start {
+			orient = constructcf.OrientFR
+		} else {
+			orient = constructcf.OrientRF
+		}
+	}
+	return
+}
+
+// normalizeHits flip the read strands of the orientation to FR
+func normalizeHits(hits *[2]ReadHit, orient int) {
+	switch orient {
+	case constructcf.OrientRF:
+		hits[0].Strand, hits[1].Strand = !hits[0].Strand, !hits[1].Strand
+	case constructcf.OrientFF:
+		hits[1].Strand = !hits[1].Strand
+	}
+}
+
+// EstimateLibInsert estimate the insert size of library by the sample pairs mapped to the same long contig
+func EstimateLibInsert(lib constructcf.LibInfo, cf constructdbg.CuckooFilter, edgesArr []constructdbg.DBGEdge, winSize int) preprocess.InsertSizeStat {
+	pairArr := preprocess.LoadNGSPairsSample(lib.FnName[0], lib.FnName[1], preprocess.InsertSampleNum, cf.Kmerlen)
+	minLen := constructdbg.MaxInt(preprocess.InsertMinEdgeLen, 2*(lib.InsertSize+lib.InsertSD))
+	var fragArr [constructcf.OrientNum][]int
+	for _, pairRI := range pairArr {
+		var hits [2]ReadHit
+		var ok bool
+		for j := 0; j < 2; j++ {
+			if hits[j], ok = MapReadToContig(cf, pairRI[j], winSize, edgesArr); !ok {
+				break
+			}
+		}
+		if !ok || hits[0].CID != hits[1].CID || len(edgesArr[hits[0].CID+2].Utg.Ks) < minLen {
+			continue
+		}
+		fragLen, orient := getHitsFragment(hits)
+		fragArr[orient] = append(fragArr[orient], fragLen)
+	}
+	return preprocess.GetInsertSizeStat(fragArr, lib.Orient)
+}
+
+// GetLibInsert return the estimated insert size of library, the cfg insert size used if pairs
+// mapped to the same contig not enough, the orientation resolved by preprocess.GetLibOrient
+func GetLibInsert(lib constructcf.LibInfo, cf constructdbg.CuckooFilter, edgesArr []constructdbg.DBGEdge, winSize int) (ins InsertInfo) {
+	stat := EstimateLibInsert(lib, cf, edgesArr, winSize)
+	ins = InsertInfo{float64(lib.InsertSize), float64(lib.InsertSD), preprocess.GetLibOrient(lib, stat)}
+	if stat.Num >= preprocess.InsertMinPairNum {
+		ins.Mean, ins.SD = stat.Mean, stat.SD
+	}
+	fmt.Printf("[GetLibInsert] library: %s, insert size: %.1f, SD: %.1f, orientation: %s, estimated pairs number: %d\n", lib.Name, ins.Mean, ins.SD, constructcf.OrientName[ins.Orient], stat.Num)
+	return
+}
+
+// GetScafLibs return the pair libraries used by scaffolding, sorted by insert size from large to small
+func GetScafLibs(cfgInfo constructcf.CfgInfo) (libArr []constructcf.LibInfo) {
+	for _, lib := range cfgInfo.Libs {
+		if lib.AsmFlag != constructcf.AllState && lib.AsmFlag != constructcf.ScaffState {
+			continue
+		}
+		if lib.SeqProfile != 1 || len(lib.FnName) < 2 || lib.InsertSize <= 0 {
+			continue
+		}
+		libArr = append(libArr, lib)
+	}
+	sort.SliceStable(libArr, func(i, j int) bool { return libArr[i].InsertSize > libArr[j].InsertSize })
+	return
+}
+
+// paraMapPairs map the pair reads to the scaffolds, send the links of scaffold ends after cs closed
+func paraMapPairs(cs <-chan [2]constructcf.ReadInfo, lc chan<- map[LinkKey]LinkInfo, cf constructdbg.CuckooFilter, edgesArr []constructdbg.DBGEdge, cpArr []ContigPos, scafLenArr []int, ins InsertInfo, winSize int) {
+	linkMap := make(map[LinkKey]LinkInfo)
+	for pairRI := range cs {
+		var hits [2]ReadHit
+		var ok bool
+		for j := 0; j < 2; j++ {
+			if hits[j], ok = MapReadToContig(cf, pairRI[j], winSize, edgesArr); !ok {
+				break
+			}
+		}
+		if !ok || hits[0].CID == hits[1].CID {
+			continue
+		}
+		normalizeHits(&hits, ins.Orient)
+		if k, gap, ok := GetPairLink(hits, cpArr, scafLenArr, edgesArr, ins); ok {
+			li := linkMap[k]
+			li.Num++
+			li.GapSum += gap
+			linkMap[k] = li
+		}
+	}
+	lc <- linkMap
+}
+
+// MapLibLinks return the links of scaffold ends supported by the pairs of library
+func MapLibLinks(lib constructcf.LibInfo, cf constructdbg.CuckooFilter, edgesArr []constructdbg.DBGEdge, cpArr []ContigPos, scafLenArr []int, ins InsertInfo, opt Options) map[LinkKey]LinkInfo {
+	bufSize := 60000
+	linkMap := make(map[LinkKey]LinkInfo)
+	for i := 0; i+1 < len(lib.FnName); i += 2 {
+		cs := make(chan [2]constructcf.ReadInfo, bufSize)
+		lc := make(chan map[LinkKey]LinkInfo, opt.NumCPU)
+		go preprocess.LoadNGSReads(lib.FnName[i], lib.FnName[i+1], cs, cf.Kmerlen, bufSize, nil, "")
+		for j := 0; j < opt.NumCPU; j++ {
+			go paraMapPairs(cs, lc, cf, edgesArr, cpArr, scafLenArr, ins, opt.WinSize)
+		}
+		for j := 0; j < opt.NumCPU; j++ {
+			for k, li := range <-lc {
+				t := linkMap[k]
+				t.Num += li.Num
+				t.GapSum += li.GapSum
+				linkMap[k] = t
+			}
+		}
+	}
+	return linkMap
+}
+
+func Scaffold(c cli.Command) {
+	gOpt, suc := utils.CheckGlobalArgs(c.Parent())
+	if suc == false {
+		log.Fatalf("[Scaffold] check global Arguments error, opt: %v\n", gOpt)
+	}
+	opt := Options{gOpt, 0, 0, 0, 0, ""}
+	tmp, suc := checkArgs(c)
+	if suc == false {
+		log.Fatalf("[Scaffold] check Arguments error, opt: %v\n", tmp)
+	}
+	opt.WinSize = tmp.WinSize
+	opt.SeedLen = tmp.SeedLen
+	opt.MinLinkNum = tmp.MinLinkNum
+	opt.MinContigLen = tmp.MinContigLen
+	opt.ContigFn = tmp.ContigFn
+	dcdbg := opt.ContigFn == ""
+	if dcdbg {
+		opt.ContigFn = opt.Prefix + ".edges.DcDBG.fq"
+	}
+	fmt.Printf("Arguments: %v\n", opt)
+
+	var contigArr []Contig
+	if _, err := os.Stat(opt.ContigFn); err == nil {
+		contigArr = LoadContigs(opt.ContigFn)
+		if dcdbg {
+			// decdbg only write the joined paths, the unique edges not joined added
+			joined := make(map[constructdbg.DBG_MAX_INT]bool)
+			for _, ctg := range contigArr {
+				for _, eID := range ctg.EIDArr {
+					joined[eID] = true
+				}
+			}
+			uArr := GetUniqueEdgesContigs(opt, joined)
+			fmt.Printf("[Scaffold] joined contigs number: %d, add the unique edges not joined number: %d\n", len(contigArr), len(uArr))
+			contigArr = append(contigArr, uArr...)
+		}
+	} else {
+		fmt.Printf("[Scaffold] contigs file: %s not found, use the unique edges of smfy DBG\n", opt.ContigFn)
+		contigArr = GetUniqueEdgesContigs(opt, nil)
+	}
+	edgesArr := GetContigEdgesArr(contigArr, constructdbg.MaxInt(opt.MinContigLen, opt.SeedLen+opt.WinSize))
+	cfSize := constructdbg.GetCuckoofilterDBGSampleSize(edgesArr, int64(opt.WinSize), int64(math.MaxInt32), int64(opt.SeedLen))
+	cf := constructdbg.MakeCuckooFilter(uint64(cfSize*7), opt.SeedLen)
+	count := constructdbg.ConstructCFDBGMinimizers(cf, edgesArr, opt.WinSize, math.MaxInt32)
+	fmt.Printf("[Scaffold] contigs number: %d, seed kmers number: %d\n", len(contigArr), count)
+
+	cfgInfo, err := constructcf.ParseCfg(opt.CfgFn, true)
+	if err != nil {
+		log.Fatalf("[Scaffold] ParseCfg 'C': %v err: %v\n", opt.CfgFn, err)
+	}
+	scafArr := make([][]ScafElem, len(contigArr))
+	for i := range contigArr {
+		scafArr[i] = []ScafElem{{CID: i, Strand: constructdbg.PLUS}}
+	}
+	for _, lib := range GetScafLibs(cfgInfo) {
+		ins := GetLibInsert(lib, cf, edgesArr, opt.WinSize)
+		cpArr, scafLenArr := GetContigPosArr(scafArr, contigArr)
+		linkMap := MapLibLinks(lib, cf, edgesArr, cpArr, scafLenArr, ins, opt)
+		var joinNum int
+		scafArr, joinNum = JoinScaffolds(scafArr, linkMap, opt.MinLinkNum)
+		fmt.Printf("[Scaffold] library: %s, links number: %d, joins number: %d, scaffolds number: %d\n", lib.Name, len(linkMap), joinNum, len(scafArr))
+	}
+	WriteScaffolds(scafArr, contigArr, opt.Prefix+".scaffolds.fa", opt.Prefix+".scaffolds.agp")
+}